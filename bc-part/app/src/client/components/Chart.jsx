@@ -1,5 +1,6 @@
 import React from 'react';
 import {ComposedChart, ResponsiveContainer, Line, Bar, XAxis, YAxis, CartesianGrid, Tooltip, Legend} from 'recharts';
+import {toNumber} from './measurement';
 
 class LineBarAreaComposedChart extends React.Component {
   render() {
@@ -12,6 +13,7 @@ class LineBarAreaComposedChart extends React.Component {
     const data = elements.map((r) => {
       return {
         ...r,
+        value: Object.keys(r.value).reduce((value, key) => ({...value, [key]: toNumber(r.value[key])}), {}),
         ts: (new Date(r.value.timestamp * 1000)).toLocaleString()
       };
     })
@@ -1,6 +1,7 @@
 import React from 'react';
 import {Chart} from './Chart';
 import DataTable from 'react-data-table-component';
+import {format} from './measurement';
 
 class DisplayData extends React.Component {
     constructor(props) {
@@ -294,7 +295,7 @@ class DisplayData extends React.Component {
                 name: 'Data',
                 selector: 'value',
                 cell: row => <div style={{textAlign: 'left'}}>{Object.keys(row.value).map((data, i) => <div
-                    key={i}>{data}: {row.value[data]}</div>)}</div>
+                    key={i}>{data}: {format(row.value[data])}</div>)}</div>
             },
         ];
 
@@ -0,0 +1,21 @@
+// Measurements are returned by the chaincode as {value, scale, unit},
+// where value is an integer and the real value is value * 10^-scale
+
+const isMeasurement = (field) => !!field && typeof field === 'object' && 'scale' in field;
+
+const toNumber = (field) => isMeasurement(field) ? field.value / Math.pow(10, field.scale) : field;
+
+const format = (field) => {
+    if (!isMeasurement(field)) {
+        return field;
+    }
+
+    const sign = field.value < 0 ? '-' : '';
+    const digits = Math.abs(field.value).toString().padStart(field.scale + 1, '0');
+    const integer = digits.slice(0, digits.length - field.scale);
+    const fraction = field.scale > 0 ? '.' + digits.slice(digits.length - field.scale) : '';
+
+    return `${sign}${integer}${fraction} ${field.unit}`;
+};
+
+export {toNumber, format};
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/satori/go.uuid"
+	"strconv"
+)
+
+const (
+	accessGrantIndex = "AccessGrant"
+)
+
+const (
+	accessGrantKeyFieldsNumber      = 2
+	accessGrantBasicArgumentsNumber = 3
+	accessGrantSchemaVersion        = 1
+)
+
+// Access grant states
+const (
+	AccessGrantStateUnknown = iota
+	AccessGrantStateRequested
+	AccessGrantStateApproved
+	AccessGrantStateRevoked
+)
+
+var accessGrantStatesAutomaton = map[int][]int{
+	AccessGrantStateRequested: {AccessGrantStateApproved, AccessGrantStateRevoked},
+	AccessGrantStateApproved:  {AccessGrantStateRevoked},
+}
+
+type accessGrantKey struct {
+	DeviceID string `json:"deviceid"`
+	ID       string `json:"id"`
+}
+
+// Readings are kept in the public state, so a grant only controls what the list and query functions return.
+// Sharing private data through implicit organization collections needs Fabric 2.0 and is not supported
+type accessGrantValue struct {
+	// MSP the data is shared with
+	Grantee string `json:"grantee"`
+	// MSP the device is registered by, approves and revokes the grant
+	Owner string `json:"owner"`
+	// device timestamps of the first and the last readings covered by the grant
+	From    int64  `json:"from"`
+	To      int64  `json:"to"`
+	Purpose string `json:"purpose"`
+	State   int    `json:"state"`
+	// MSP of the latest state change
+	UpdatedBy        string `json:"updatedby"`
+	RequestTimestamp int64  `json:"requesttimestamp"`
+	Timestamp        int64  `json:"timestamp"`
+	SchemaVersion    int    `json:"schemaversion"`
+}
+
+type AccessGrant struct {
+	Key   accessGrantKey   `json:"key"`
+	Value accessGrantValue `json:"value"`
+}
+
+func CreateAccessGrant() LedgerData {
+	return new(AccessGrant)
+}
+
+//argument order
+//0			1		2	3
+//DeviceID	From	To	Purpose (optional)
+func (entity *AccessGrant) FillFromArguments(stub shim.ChaincodeStubInterface, args []string) error {
+	if len(args) < accessGrantBasicArgumentsNumber {
+		return errors.New(fmt.Sprintf("arguments array must contain at least %d items", accessGrantBasicArgumentsNumber))
+	}
+
+	u, err := uuid.NewV4()
+	if err != nil {
+		return InternalError(errors.New(fmt.Sprintf("unable to generate uuid: %s", err.Error())))
+	}
+
+	if err := entity.FillFromCompositeKeyParts([]string{args[0], u.String()}); err != nil {
+		return ArgumentError("deviceID", err)
+	}
+
+	from, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return ArgumentError("from", errors.New(fmt.Sprintf("unable to parse the start of the time range: %s", err.Error())))
+	}
+	to, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return ArgumentError("to", errors.New(fmt.Sprintf("unable to parse the end of the time range: %s", err.Error())))
+	}
+	if from < 0 || to < from {
+		return ArgumentError("to", errors.New("time range must be non-negative and end after it starts"))
+	}
+	entity.Value.From = from
+	entity.Value.To = to
+
+	if len(args) > 3 {
+		entity.Value.Purpose = args[3]
+	}
+
+	//getting transaction Timestamp
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return InternalError(errors.New(fmt.Sprintf("unable to get transaction timestamp: %s", err.Error())))
+	}
+	entity.Value.RequestTimestamp = timestamp.Seconds
+	entity.Value.Timestamp = timestamp.Seconds
+
+	entity.Value.State = AccessGrantStateRequested
+
+	return nil
+}
+
+func (entity *AccessGrant) FillFromCompositeKeyParts(compositeKeyParts []string) error {
+	if len(compositeKeyParts) < accessGrantKeyFieldsNumber {
+		return errors.New(fmt.Sprintf("composite key parts array must contain at least %d items", accessGrantKeyFieldsNumber))
+	}
+
+	if compositeKeyParts[0] == "" {
+		return errors.New("device ID must be not empty")
+	}
+
+	if id, err := uuid.FromString(compositeKeyParts[1]); err != nil {
+		return errors.New(fmt.Sprintf("unable to parse an ID from \"%s\"", compositeKeyParts[1]))
+	} else if id.Version() != uuid.V4 {
+		return errors.New("wrong ID format; expected UUID version 4")
+	}
+
+	entity.Key.DeviceID = compositeKeyParts[0]
+	entity.Key.ID = compositeKeyParts[1]
+
+	return nil
+}
+
+func (entity *AccessGrant) FillFromLedgerValue(ledgerValue []byte) error {
+	ledgerValue, err := UpcastLedgerValue(accessGrantIndex, ledgerValue)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(ledgerValue, &entity.Value); err != nil {
+		return err
+	} else {
+		return nil
+	}
+}
+
+func (entity *AccessGrant) ToCompositeKey(stub shim.ChaincodeStubInterface) (string, error) {
+	compositeKeyParts := []string{
+		entity.Key.DeviceID,
+		entity.Key.ID,
+	}
+
+	return stub.CreateCompositeKey(accessGrantIndex, compositeKeyParts)
+}
+
+func (entity *AccessGrant) ToLedgerValue() ([]byte, error) {
+	entity.Value.SchemaVersion = accessGrantSchemaVersion
+	return json.Marshal(entity.Value)
+}
+
+// Covers reports whether the grant exposes a reading of the device owned by the owner;
+// grants approved by another MSP than the owner of the reading never do
+func (entity *AccessGrant) Covers(deviceID string, owner string, timestamp int64) bool {
+	return entity.Value.State == AccessGrantStateApproved && entity.Key.DeviceID == deviceID &&
+		entity.Value.Owner == owner && entity.Value.From <= timestamp && timestamp <= entity.Value.To
+}
+
+// DataAccess decides which readings the creator may see: readings owned by its own MSP
+// and readings covered by grants approved for it
+type DataAccess struct {
+	stub   shim.ChaincodeStubInterface
+	MSPID  string
+	grants []AccessGrant
+	// registered owners of the devices, loaded once per device
+	owners map[string]string
+}
+
+func LoadDataAccess(stub shim.ChaincodeStubInterface) (*DataAccess, error) {
+	mspid, err := GetMSPID(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	access := &DataAccess{stub: stub, MSPID: mspid, owners: map[string]string{}}
+	grantsBytes, err := Query(stub, accessGrantIndex, []string{}, CreateAccessGrant, func(data LedgerData) bool {
+		grant := data.(*AccessGrant)
+		return grant.Value.Grantee == mspid && grant.Value.State == AccessGrantStateApproved
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(grantsBytes, &access.grants); err != nil {
+		return nil, err
+	}
+
+	return access, nil
+}
+
+func (access *DataAccess) Filter(data LedgerData) bool {
+	deviceID, timestamp := readingDevice(data)
+
+	return access.Allows(deviceID, readingSubmitter(data).MSPID, timestamp)
+}
+
+// FilterGeofenceTransition decides on a geofence transition like on the gps reading it was detected in
+func (access *DataAccess) FilterGeofenceTransition(data LedgerData) bool {
+	gps := Gps{}
+	gps.Key.ID = data.(*GeofenceTransition).Value.GpsID
+	if err := LoadFrom(access.stub, &gps, iotGpsIndex); err != nil {
+		return false
+	}
+
+	return access.Filter(&gps)
+}
+
+// Allows decides on a reading of the device at the device timestamp submitted by the MSP
+func (access *DataAccess) Allows(deviceID string, submitterMSPID string, timestamp int64) bool {
+	if _, ok := access.owners[deviceID]; !ok {
+		access.owners[deviceID], _ = GetDeviceOwner(access.stub, deviceID)
+	}
+	// Readings of unregistered devices belong to the MSP which submitted them. This is a decision: the device
+	// certificate is issued by that MSP, and grants need a registered owner, so until the MSP proves the enrollment
+	// by registering the device, nobody else sees its readings
+	owner := access.owners[deviceID]
+	if owner == "" {
+		owner = submitterMSPID
+	}
+	// nobody can approve access to readings of an unknown owner, they stay as visible as before grants
+	if owner == access.MSPID || owner == "" {
+		return true
+	}
+
+	for _, grant := range access.grants {
+		if grant.Covers(deviceID, owner, timestamp) {
+			return true
+		}
+	}
+
+	return false
+}
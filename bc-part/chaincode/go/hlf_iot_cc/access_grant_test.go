@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestFilterGeofenceTransition(t *testing.T) {
+	stub := shim.NewMockStub(chaincodeName, new(SupplyChainChaincode))
+
+	// a gps reading of an unregistered device submitted by org1MSP
+	gpsID := "11111111-1111-4111-8111-111111111111"
+	putLegacy(t, stub, iotGpsIndex, []string{gpsID}, `{"customfield":"device1","mspid":"org1MSP","timestamp":5}`)
+
+	transition := func(gpsID string) *GeofenceTransition {
+		transition := GeofenceTransition{}
+		transition.Key.DeviceID = "device1"
+		transition.Value.GpsID = gpsID
+		transition.Value.Timestamp = 5
+		return &transition
+	}
+
+	tests := []struct {
+		name       string
+		mspid      string
+		transition *GeofenceTransition
+		want       bool
+	}{
+		{"submitting MSP", "org1MSP", transition(gpsID), true},
+		{"another MSP", "org2MSP", transition(gpsID), false},
+		{"missing gps reading", "org1MSP", transition("21111111-1111-4111-8111-111111111111"), false},
+	}
+
+	for _, test := range tests {
+		access := &DataAccess{stub: stub, MSPID: test.mspid, owners: map[string]string{}}
+		if got := access.FilterGeofenceTransition(test.transition); got != test.want {
+			t.Errorf("%s: FilterGeofenceTransition() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestIsNetworkAdmin(t *testing.T) {
+	stub := newCommittedStub()
+	stub.init(t, "", "", "0", "org1MSP")
+
+	ca := newTestCA(t, "org")
+	admin := map[string]string{attributeAdmin: "true"}
+
+	tests := []struct {
+		name    string
+		creator []byte
+		admin   bool
+		network bool
+	}{
+		{"admin of an approver", ca.Identity(t, "org1MSP", "admin1", admin), true, true},
+		{"admin of another MSP", ca.Identity(t, "org2MSP", "admin2", admin), true, false},
+		{"member of an approver", ca.Identity(t, "org1MSP", "user1", nil), false, false},
+		{"admin attribute set to false", ca.Identity(t, "org1MSP", "user2", map[string]string{attributeAdmin: "false"}), false, false},
+	}
+
+	for _, test := range tests {
+		stub.creator = test.creator
+
+		if admin, err := IsAdmin(stub); err != nil || admin != test.admin {
+			t.Errorf("%s: IsAdmin() = %v, %v; want %v", test.name, admin, err, test.admin)
+		}
+		if network, err := IsNetworkAdmin(stub); err != nil || network != test.network {
+			t.Errorf("%s: IsNetworkAdmin() = %v, %v; want %v", test.name, network, err, test.network)
+		}
+	}
+}
@@ -0,0 +1,489 @@
+package main
+
+import (
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"reflect"
+	"strings"
+)
+
+// Roles required to invoke functions. They are advisory: Invoke dispatches without checking them,
+// since most of them depend on the arguments, and each handler checks the creator itself
+const (
+	RoleAny       = "any"
+	RoleDevice    = "device"
+	RoleAdmin     = "admin"
+	RoleApprover  = "approver"
+	RoleOwner     = "owner"
+	RoleManager   = "manager"
+	RoleCreator   = "creator"
+	RoleSupplier  = "supplier"
+	RoleCustodian = "custodian"
+)
+
+var roleDescriptions = map[string]string{
+	RoleAny:       "any identity of the channel",
+	RoleDevice:    "device identity; the device ID is taken from the certificate",
+	RoleAdmin:     "identity with the " + attributeAdmin + " attribute, acting for its own MSP",
+	RoleApprover:  "identity with the " + attributeAdmin + " attribute from one of the certificate approvers",
+	RoleOwner:     "MSP the device is registered by",
+	RoleManager:   "identity from the MSP the device is registered by, other than a device, or identity with the " + attributeAdmin + " attribute from one of the certificate approvers",
+	RoleCreator:   "MSP the entity was created by or identity with the " + attributeAdmin + " attribute from one of the certificate approvers",
+	RoleSupplier:  "MSP set as the supplier of the shipment",
+	RoleCustodian: "MSP holding or accepting the custody of the shipment",
+}
+
+// Types of function arguments; every argument is passed as a string
+const (
+	ArgumentTypeString    = "string"
+	ArgumentTypeInteger   = "integer"
+	ArgumentTypeDecimal   = "decimal"
+	ArgumentTypeTimestamp = "timestamp"
+	ArgumentTypeJSON      = "json"
+	ArgumentTypeList      = "list"
+)
+
+// Handler is a method of the chaincode serving an invoke function
+type Handler func(cc *SupplyChainChaincode, stub shim.ChaincodeStubInterface, args []string) pb.Response
+
+// Schema is a JSON schema generated from the Go types, so it follows the code
+type Schema struct {
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+type ArgumentDescription struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Optional bool   `json:"optional"`
+	// schema of json arguments
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+type FunctionDescription struct {
+	Name        string                `json:"name"`
+	Role        string                `json:"role"`
+	Description string                `json:"description"`
+	Arguments   []ArgumentDescription `json:"arguments"`
+	// schema of the payload; not set for functions returning an empty payload
+	Response *Schema `json:"response,omitempty"`
+	handler  Handler
+}
+
+// APICatalogue is the result of describe
+type APICatalogue struct {
+	Init      []ArgumentDescription `json:"init"`
+	Roles     map[string]string     `json:"roles"`
+	Functions []FunctionDescription `json:"functions"`
+}
+
+var initArguments = []ArgumentDescription{
+	optional("IdentitySource", ArgumentTypeString),
+	optional("ShockThreshold", ArgumentTypeDecimal),
+	optional("CertificateApprovals", ArgumentTypeInteger),
+	optional("CertificateApprovers", ArgumentTypeList),
+	optionalJSON("CACertificates", map[string]string{}),
+	optional("EventRetention", ArgumentTypeInteger),
+	optional("UnpersistedEventSensors", ArgumentTypeList),
+}
+
+// chaincodeFunctions is both the dispatch table of Invoke and the catalogue returned by describe.
+// It is filled in init, since describe refers to it
+var chaincodeFunctions []FunctionDescription
+
+var chaincodeFunctionsByName map[string]*FunctionDescription
+
+func init() {
+	chaincodeFunctions = []FunctionDescription{
+		{"addIotGps", RoleDevice, "stores a gps reading of the creator's device",
+			[]ArgumentDescription{
+				required("Longitude", ArgumentTypeDecimal),
+				required("Latitude", ArgumentTypeDecimal),
+				required("Altitude", ArgumentTypeDecimal),
+				required("Timestamp", ArgumentTypeTimestamp),
+			}, nil, (*SupplyChainChaincode).addIotGps},
+		{"listIotGps", RoleAny, "lists gps readings accessible to the creator",
+			[]ArgumentDescription{optionalJSON("Options", ListOptions{})},
+			SchemaOf([]Gps{}), (*SupplyChainChaincode).listIotGps},
+		{"addIotBarometer", RoleDevice, "stores a barometer reading of the creator's device",
+			[]ArgumentDescription{
+				required("Pressure", ArgumentTypeDecimal),
+				required("Altitude", ArgumentTypeDecimal),
+				required("Temperature", ArgumentTypeDecimal),
+				required("Timestamp", ArgumentTypeTimestamp),
+			}, nil, (*SupplyChainChaincode).addIotBarometer},
+		{"listIotBarometer", RoleAny, "lists barometer readings accessible to the creator",
+			[]ArgumentDescription{optionalJSON("Options", ListOptions{})},
+			SchemaOf([]Barometer{}), (*SupplyChainChaincode).listIotBarometer},
+		{"addIotGyroscope", RoleDevice, "stores a gyroscope reading of the creator's device",
+			[]ArgumentDescription{
+				required("Xout", ArgumentTypeDecimal),
+				required("XoutScaled", ArgumentTypeDecimal),
+				required("Yout", ArgumentTypeDecimal),
+				required("YoutScaled", ArgumentTypeDecimal),
+				required("Zout", ArgumentTypeDecimal),
+				required("ZoutScaled", ArgumentTypeDecimal),
+				required("AccelerationXout", ArgumentTypeDecimal),
+				required("AccelerationXoutScaled", ArgumentTypeDecimal),
+				required("AccelerationYout", ArgumentTypeDecimal),
+				required("AccelerationYoutScaled", ArgumentTypeDecimal),
+				required("AccelerationZout", ArgumentTypeDecimal),
+				required("AccelerationZoutScaled", ArgumentTypeDecimal),
+				required("Timestamp", ArgumentTypeTimestamp),
+			}, nil, (*SupplyChainChaincode).addIotGyroscope},
+		{"listIotGyroscope", RoleAny, "lists gyroscope readings accessible to the creator",
+			[]ArgumentDescription{optionalJSON("Options", ListOptions{})},
+			SchemaOf([]Gyroscope{}), (*SupplyChainChaincode).listIotGyroscope},
+		{"listIotShocks", RoleAny, "lists gyroscope readings with an acceleration above the shock threshold",
+			[]ArgumentDescription{optionalJSON("Options", ListOptions{})},
+			SchemaOf([]Gyroscope{}), (*SupplyChainChaincode).listIotShocks},
+		{"addIotHumidity", RoleDevice, "stores a humidity reading of the creator's device",
+			[]ArgumentDescription{
+				required("Humidity", ArgumentTypeDecimal),
+				required("Temperature", ArgumentTypeDecimal),
+				required("Timestamp", ArgumentTypeTimestamp),
+			}, nil, (*SupplyChainChaincode).addIotHumidity},
+		{"listIotHumidity", RoleAny, "lists humidity readings accessible to the creator",
+			[]ArgumentDescription{optionalJSON("Options", ListOptions{})},
+			SchemaOf([]Humidity{}), (*SupplyChainChaincode).listIotHumidity},
+		{"addIotVibration", RoleDevice, "stores a vibration reading of the creator's device",
+			[]ArgumentDescription{
+				required("Vibration", ArgumentTypeInteger),
+				required("Timestamp", ArgumentTypeTimestamp),
+			}, nil, (*SupplyChainChaincode).addIotVibration},
+		{"listIotVibration", RoleAny, "lists vibration readings accessible to the creator",
+			[]ArgumentDescription{optionalJSON("Options", ListOptions{})},
+			SchemaOf([]Vibration{}), (*SupplyChainChaincode).listIotVibration},
+		{"addIotLight", RoleDevice, "stores a light reading of the creator's device",
+			[]ArgumentDescription{
+				required("Light", ArgumentTypeInteger),
+				required("Timestamp", ArgumentTypeTimestamp),
+			}, nil, (*SupplyChainChaincode).addIotLight},
+		{"listIotLight", RoleAny, "lists light readings accessible to the creator",
+			[]ArgumentDescription{optionalJSON("Options", ListOptions{})},
+			SchemaOf([]Light{}), (*SupplyChainChaincode).listIotLight},
+		{"registerSensorType", RoleApprover, "registers a custom sensor type with the schema of its readings",
+			[]ArgumentDescription{
+				required("Name", ArgumentTypeString),
+				requiredJSON("Fields", []sensorFieldArgument{}),
+			}, nil, (*SupplyChainChaincode).registerSensorType},
+		{"listSensorTypes", RoleAny, "lists custom sensor types",
+			[]ArgumentDescription{},
+			SchemaOf([]SensorType{}), (*SupplyChainChaincode).listSensorTypes},
+		{"addIotReading", RoleDevice, "stores a reading of a custom sensor type and returns its ID",
+			[]ArgumentDescription{
+				required("SensorType", ArgumentTypeString),
+				requiredJSON("Values", map[string]interface{}{}),
+				required("Timestamp", ArgumentTypeTimestamp),
+			}, textSchema(), (*SupplyChainChaincode).addIotReading},
+		{"listIotReading", RoleAny, "lists readings of a custom sensor type accessible to the creator",
+			[]ArgumentDescription{
+				required("SensorType", ArgumentTypeString),
+				optionalJSON("Options", ListOptions{}),
+			}, SchemaOf([]Reading{}), (*SupplyChainChaincode).listIotReading},
+		{"addIotBatch", RoleDevice, "stores readings of several sensors of the creator's device at once",
+			[]ArgumentDescription{requiredJSON("Readings", []BatchItem{})},
+			SchemaOf([]BatchItemResult{}), (*SupplyChainChaincode).addIotBatch},
+		{"addIotCertificate", RoleAdmin, "registers a PEM device certificate and returns its ID",
+			[]ArgumentDescription{required("Certificate", ArgumentTypeString)},
+			textSchema(), (*SupplyChainChaincode).addIotCertificate},
+		{"approveIotCertificate", RoleApprover, "approves a proposed certificate",
+			[]ArgumentDescription{required("ID", ArgumentTypeString)},
+			nil, (*SupplyChainChaincode).approveIotCertificate},
+		{"checkIotCertificate", RoleAny, "checks a PEM certificate at the transaction time",
+			[]ArgumentDescription{required("Certificate", ArgumentTypeString)},
+			SchemaOf(CertificateCheck{}), (*SupplyChainChaincode).checkIotCertificate},
+		{"listIotCertificates", RoleAny, "lists registered certificates with their status",
+			[]ArgumentDescription{
+				optionalJSON("Options", CertificateListOptions{}),
+				optional("PageSize", ArgumentTypeInteger),
+				optional("Bookmark", ArgumentTypeString),
+			}, SchemaOf(CertificatePage{}), (*SupplyChainChaincode).listIotCertificates},
+		{"getIotCertificate", RoleAny, "returns a certificate with its status and usage",
+			[]ArgumentDescription{required("ID", ArgumentTypeString)},
+			SchemaOf(CertificateDetails{}), (*SupplyChainChaincode).getIotCertificate},
+		{"addIotAnchor", RoleDevice, "stores the Merkle root of readings kept off the chain",
+			[]ArgumentDescription{
+				required("From", ArgumentTypeTimestamp),
+				required("To", ArgumentTypeTimestamp),
+				required("SampleCount", ArgumentTypeInteger),
+				required("MerkleRoot", ArgumentTypeString),
+			}, nil, (*SupplyChainChaincode).addIotAnchor},
+		{"verifyIotSample", RoleAny, "checks a sample against an anchor; returns 1 when it is included",
+			[]ArgumentDescription{
+				required("AnchorID", ArgumentTypeString),
+				required("Sample", ArgumentTypeString),
+				requiredJSON("Proof", []MerkleProofItem{}),
+			}, SchemaOf(byte(0)), (*SupplyChainChaincode).verifyIotSample},
+		{"registerDevice", RoleAdmin, "registers a device; the creator's MSP must have proposed an active certificate of it and becomes its owner",
+			[]ArgumentDescription{required("DeviceID", ArgumentTypeString)},
+			nil, (*SupplyChainChaincode).registerDevice},
+		{"heartbeat", RoleDevice, "updates the last seen time of the creator's device",
+			[]ArgumentDescription{required("Timestamp", ArgumentTypeTimestamp)},
+			nil, (*SupplyChainChaincode).heartbeat},
+		{"listStaleDevices", RoleAny, "lists devices silent for more than MaxSilence seconds",
+			[]ArgumentDescription{required("MaxSilence", ArgumentTypeInteger)},
+			SchemaOf([]StaleDevice{}), (*SupplyChainChaincode).listStaleDevices},
+		{"setDesiredConfiguration", RoleManager, "sets the configuration a device should apply",
+			[]ArgumentDescription{
+				required("DeviceID", ArgumentTypeString),
+				requiredJSON("Configuration", DeviceConfiguration{}),
+			}, SchemaOf(DeviceTwin{}), (*SupplyChainChaincode).setDesiredConfiguration},
+		{"reportConfiguration", RoleDevice, "reports the configuration applied by the creator's device",
+			[]ArgumentDescription{
+				required("Version", ArgumentTypeInteger),
+				requiredJSON("Configuration", DeviceConfiguration{}),
+			}, nil, (*SupplyChainChaincode).reportConfiguration},
+		{"getDeviceTwin", RoleAny, "returns the desired and reported configuration of a device",
+			[]ArgumentDescription{required("DeviceID", ArgumentTypeString)},
+			SchemaOf(DeviceTwin{}), (*SupplyChainChaincode).getDeviceTwin},
+		{"issueCommand", RoleManager, "queues a command for a device",
+			[]ArgumentDescription{
+				required("DeviceID", ArgumentTypeString),
+				required("Command", ArgumentTypeString),
+				optionalJSON("Parameters", []string{}),
+			}, SchemaOf(DeviceCommand{}), (*SupplyChainChaincode).issueCommand},
+		{"listPendingCommands", RoleAny, "lists commands not yet acknowledged by a device",
+			[]ArgumentDescription{required("DeviceID", ArgumentTypeString)},
+			SchemaOf([]DeviceCommand{}), (*SupplyChainChaincode).listPendingCommands},
+		{"listCommands", RoleAny, "lists commands of all devices or of one device",
+			[]ArgumentDescription{optional("DeviceID", ArgumentTypeString)},
+			SchemaOf([]DeviceCommand{}), (*SupplyChainChaincode).listCommands},
+		{"acknowledgeCommand", RoleDevice, "sets the state and result of a command of the creator's device",
+			[]ArgumentDescription{
+				required("ID", ArgumentTypeString),
+				required("State", ArgumentTypeInteger),
+				required("Result", ArgumentTypeString),
+			}, nil, (*SupplyChainChaincode).acknowledgeCommand},
+		{"requestDataAccess", RoleAny, "requests access to the readings of a registered device for a time window; readings of unregistered devices are visible to the MSP which submitted them only",
+			[]ArgumentDescription{
+				required("DeviceID", ArgumentTypeString),
+				required("From", ArgumentTypeTimestamp),
+				required("To", ArgumentTypeTimestamp),
+				optional("Purpose", ArgumentTypeString),
+			}, SchemaOf(AccessGrant{}), (*SupplyChainChaincode).requestDataAccess},
+		{"approveDataAccess", RoleOwner, "approves a data access request; readings stay in the public state, so the grant limits what list, query and export functions return, and sharing through implicit private data collections is not supported before Fabric 2.0",
+			[]ArgumentDescription{
+				required("DeviceID", ArgumentTypeString),
+				required("ID", ArgumentTypeString),
+			}, nil, (*SupplyChainChaincode).approveDataAccess},
+		{"revokeDataAccess", RoleOwner, "revokes a data access grant; the grantee may withdraw its request as well",
+			[]ArgumentDescription{
+				required("DeviceID", ArgumentTypeString),
+				required("ID", ArgumentTypeString),
+			}, nil, (*SupplyChainChaincode).revokeDataAccess},
+		{"listAccessGrants", RoleAny, "lists access grants of all devices or of one device",
+			[]ArgumentDescription{optional("DeviceID", ArgumentTypeString)},
+			SchemaOf([]AccessGrant{}), (*SupplyChainChaincode).listAccessGrants},
+		{"addCalibration", RoleManager, "stores a calibration of a sensor field of a device",
+			[]ArgumentDescription{
+				required("DeviceID", ArgumentTypeString),
+				required("Sensor", ArgumentTypeString),
+				required("Field", ArgumentTypeString),
+				required("Offset", ArgumentTypeDecimal),
+				required("Scale", ArgumentTypeDecimal),
+				required("ValidFrom", ArgumentTypeTimestamp),
+				required("Certificate", ArgumentTypeString),
+			}, SchemaOf(Calibration{}), (*SupplyChainChaincode).addCalibration},
+		{"listCalibrations", RoleAny, "lists calibrations by a prefix of DeviceID, Sensor and Field",
+			[]ArgumentDescription{
+				optional("DeviceID", ArgumentTypeString),
+				optional("Sensor", ArgumentTypeString),
+				optional("Field", ArgumentTypeString),
+			}, SchemaOf([]Calibration{}), (*SupplyChainChaincode).listCalibrations},
+		{"addGeofence", RoleManager, "stores a geofence checked against gps readings of the devices",
+			[]ArgumentDescription{
+				required("Name", ArgumentTypeString),
+				required("Type", ArgumentTypeString),
+				requiredJSON("Points", []GeoPoint{}),
+				required("Radius", ArgumentTypeDecimal),
+				requiredJSON("DeviceIDs", []string{}),
+			}, SchemaOf(Geofence{}), (*SupplyChainChaincode).addGeofence},
+		{"listGeofences", RoleAny, "lists geofences of all devices or of one device",
+			[]ArgumentDescription{optional("DeviceID", ArgumentTypeString)},
+			SchemaOf([]Geofence{}), (*SupplyChainChaincode).listGeofences},
+		{"deleteGeofence", RoleCreator, "deletes a geofence; identities of the creator MSP must also be managers of its devices",
+			[]ArgumentDescription{required("ID", ArgumentTypeString)},
+			nil, (*SupplyChainChaincode).deleteGeofence},
+		{"listGeofenceTransitions", RoleAny, "lists geofence entries and exits accessible to the creator",
+			[]ArgumentDescription{
+				optional("DeviceID", ArgumentTypeString),
+				optional("GeofenceID", ArgumentTypeString),
+			}, SchemaOf([]GeofenceTransition{}), (*SupplyChainChaincode).listGeofenceTransitions},
+		{"listTamperIncidents", RoleAny, "lists tamper incidents",
+			[]ArgumentDescription{
+				optional("ShipmentID", ArgumentTypeString),
+				optional("DeviceID", ArgumentTypeString),
+			}, SchemaOf([]TamperIncident{}), (*SupplyChainChaincode).listTamperIncidents},
+		{"addShipment", RoleSupplier, "creates a shipment tracked by devices; Conditions may be empty",
+			[]ArgumentDescription{
+				required("ID", ArgumentTypeString),
+				required("Supplier", ArgumentTypeString),
+				required("Buyer", ArgumentTypeString),
+				required("Origin", ArgumentTypeString),
+				required("Destination", ArgumentTypeString),
+				requiredJSON("DeviceIDs", []string{}),
+				requiredJSON("Conditions", map[string]ConditionRange{}),
+			}, nil, (*SupplyChainChaincode).addShipment},
+		{"getShipment", RoleAny, "returns a shipment",
+			[]ArgumentDescription{required("ID", ArgumentTypeString)},
+			SchemaOf(Shipment{}), (*SupplyChainChaincode).getShipment},
+		{"listShipments", RoleAny, "lists shipments",
+			[]ArgumentDescription{},
+			SchemaOf([]Shipment{}), (*SupplyChainChaincode).listShipments},
+		{"updateShipmentState", RoleCustodian, "moves a shipment to the next state; delivery is confirmed by the buyer",
+			[]ArgumentDescription{
+				required("ID", ArgumentTypeString),
+				required("State", ArgumentTypeInteger),
+			}, nil, (*SupplyChainChaincode).updateShipmentState},
+		{"transferShipmentCustody", RoleCustodian, "proposes the transfer of the custody to another MSP",
+			[]ArgumentDescription{
+				required("ID", ArgumentTypeString),
+				required("NewCustodian", ArgumentTypeString),
+			}, nil, (*SupplyChainChaincode).transferShipmentCustody},
+		{"acceptShipmentCustody", RoleCustodian, "accepts the custody proposed to the creator",
+			[]ArgumentDescription{required("ID", ArgumentTypeString)},
+			nil, (*SupplyChainChaincode).acceptShipmentCustody},
+		{"getShipmentCompliance", RoleAny, "checks trusted readings of the shipment devices accessible to the creator against its conditions",
+			[]ArgumentDescription{required("ID", ArgumentTypeString)},
+			SchemaOf(ComplianceReport{}), (*SupplyChainChaincode).getShipmentCompliance},
+		{"queryIot", RoleAny, "queries readings of a built-in or registered sensor type with a CouchDB selector",
+			[]ArgumentDescription{
+				required("SensorType", ArgumentTypeString),
+				requiredJSON("Selector", map[string]interface{}{}),
+				optional("PageSize", ArgumentTypeInteger),
+				optional("Bookmark", ArgumentTypeString),
+			}, SchemaOf(PaginatedResult{}), (*SupplyChainChaincode).queryIot},
+		{"exportIot", RoleAny, "exports readings of built-in or registered sensor types as csv or jsonl",
+			[]ArgumentDescription{
+				required("SensorTypes", ArgumentTypeList),
+				required("Format", ArgumentTypeString),
+				optional("PageSize", ArgumentTypeInteger),
+				optional("Bookmark", ArgumentTypeString),
+			}, SchemaOf(ExportPage{}), (*SupplyChainChaincode).exportIot},
+		{"migrateSchema", RoleAny, "continues the migration of values stored by previous versions and the filling of new indexes",
+			[]ArgumentDescription{optional("BatchSize", ArgumentTypeInteger)},
+			SchemaOf(SchemaMigration{}), (*SupplyChainChaincode).migrateSchema},
+		{"compactEvents", RoleApprover, "deletes persisted events older than the event retention",
+			[]ArgumentDescription{
+				optional("BatchSize", ArgumentTypeInteger),
+				optional("LastKey", ArgumentTypeString),
+			}, SchemaOf(EventCompaction{}), (*SupplyChainChaincode).compactEvents},
+		{"describe", RoleAny, "returns this catalogue, or the description of one function",
+			[]ArgumentDescription{optional("Name", ArgumentTypeString)},
+			SchemaOf(APICatalogue{}), (*SupplyChainChaincode).describe},
+	}
+
+	chaincodeFunctionsByName = map[string]*FunctionDescription{}
+	for i := range chaincodeFunctions {
+		chaincodeFunctionsByName[chaincodeFunctions[i].Name] = &chaincodeFunctions[i]
+	}
+}
+
+func required(name string, argumentType string) ArgumentDescription {
+	return ArgumentDescription{Name: name, Type: argumentType}
+}
+
+func optional(name string, argumentType string) ArgumentDescription {
+	return ArgumentDescription{Name: name, Type: argumentType, Optional: true}
+}
+
+func requiredJSON(name string, sample interface{}) ArgumentDescription {
+	return ArgumentDescription{Name: name, Type: ArgumentTypeJSON, Schema: SchemaOf(sample)}
+}
+
+func optionalJSON(name string, sample interface{}) ArgumentDescription {
+	return ArgumentDescription{Name: name, Type: ArgumentTypeJSON, Optional: true, Schema: SchemaOf(sample)}
+}
+
+// textSchema is the schema of payloads returned as plain text rather than JSON
+func textSchema() *Schema {
+	return &Schema{Type: "string", Format: "text"}
+}
+
+func GetFunctionDescription(name string) (*FunctionDescription, bool) {
+	description, ok := chaincodeFunctionsByName[name]
+	return description, ok
+}
+
+func FunctionNames() []string {
+	names := []string{}
+	for _, description := range chaincodeFunctions {
+		names = append(names, description.Name)
+	}
+
+	return names
+}
+
+func FunctionList() string {
+	return "{" + strings.Join(FunctionNames(), ", ") + "}"
+}
+
+// SchemaOf builds the schema of the JSON encoding of the sample's type
+func SchemaOf(sample interface{}) *Schema {
+	return typeSchema(reflect.TypeOf(sample), map[reflect.Type]bool{})
+}
+
+func typeSchema(t reflect.Type, visiting map[reflect.Type]bool) *Schema {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeSchema(t.Elem(), visiting)
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		// byte slices are encoded as base64 strings
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "base64"}
+		}
+		return &Schema{Type: "array", Items: typeSchema(t.Elem(), visiting)}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: typeSchema(t.Elem(), visiting)}
+	case reflect.Struct:
+		schema := &Schema{Type: "object"}
+		if visiting[t] {
+			return schema
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+
+		schema.Properties = map[string]*Schema{}
+		addProperties(schema, t, visiting)
+		return schema
+	}
+
+	// interfaces may hold any value
+	return &Schema{}
+}
+
+// addProperties adds the fields of a struct the way encoding/json marshals them,
+// embedded structs without a tag are flattened
+func addProperties(schema *Schema, t reflect.Type, visiting map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || (field.PkgPath != "" && !field.Anonymous) {
+			continue
+		}
+
+		name := strings.Split(tag, ",")[0]
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			addProperties(schema, field.Type, visiting)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema.Properties[name] = typeSchema(field.Type, visiting)
+	}
+}
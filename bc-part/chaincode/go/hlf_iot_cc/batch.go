@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"sort"
+	"strings"
+)
+
+const (
+	iotBatchMaxItems = 100
+)
+
+// BatchItem is a reading of addIotBatch with the arguments of the addIot* function of its sensor type;
+// readings of registered sensor types take the arguments of addIotReading after the sensor type
+type BatchItem struct {
+	Sensor string   `json:"sensor"`
+	Args   []string `json:"args"`
+}
+
+type BatchItemResult struct {
+	Index  int    `json:"index"`
+	Sensor string `json:"sensor"`
+	ID     string `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// argument of the item which failed validation, if it is known
+	Field string `json:"field,omitempty"`
+}
+
+type BatchReading struct {
+	Sensor  string     `json:"sensor"`
+	Reading LedgerData `json:"reading"`
+}
+
+type Batch struct {
+	Readings []BatchReading
+	Results  []BatchItemResult
+}
+
+// BatchGroup is the readings of one sensor type of a batch
+type BatchGroup struct {
+	Sensor   string
+	Index    string
+	Readings []BatchReading
+}
+
+// readingIndex returns the index the reading of the sensor type is stored in
+func readingIndex(sensor string) string {
+	if sensorType, ok := iotSensorTypes[sensor]; ok {
+		return sensorType.Index
+	}
+
+	return iotReadingIndex
+}
+
+// GroupBySensor splits the readings by sensor type in the order the sensor types first appear in the batch
+func (batch *Batch) GroupBySensor() []BatchGroup {
+	groups := []BatchGroup{}
+	positions := map[string]int{}
+	for _, reading := range batch.Readings {
+		position, ok := positions[reading.Sensor]
+		if !ok {
+			position = len(groups)
+			positions[reading.Sensor] = position
+			groups = append(groups, BatchGroup{Sensor: reading.Sensor, Index: readingIndex(reading.Sensor)})
+		}
+		groups[position].Readings = append(groups[position].Readings, reading)
+	}
+
+	return groups
+}
+
+// ParseBatch fills readings from the items; the batch is rejected as a whole if any of them is invalid
+func ParseBatch(stub shim.ChaincodeStubInterface, itemsString string) (Batch, error) {
+	batch := Batch{}
+
+	items := []BatchItem{}
+	if err := json.Unmarshal([]byte(itemsString), &items); err != nil {
+		return batch, errors.New(fmt.Sprintf("cannot unmarshaling readings: %s", err.Error()))
+	}
+	if len(items) == 0 || len(items) > iotBatchMaxItems {
+		return batch, errors.New(fmt.Sprintf("batch must contain between 1 and %d readings", iotBatchMaxItems))
+	}
+
+	invalid := []string{}
+	internal, identity := false, false
+	for i, item := range items {
+		result := BatchItemResult{Index: i, Sensor: item.Sensor}
+
+		var reading LedgerData
+		args := item.Args
+		var err error
+		if sensorType, ok := iotSensorTypes[item.Sensor]; ok {
+			reading = sensorType.Create()
+		} else if _, err = GetSensorType(stub, item.Sensor); err == nil {
+			reading, args = CreateReading(), append([]string{item.Sensor}, item.Args...)
+		}
+		if err == nil {
+			if err = reading.FillFromArguments(stub, args); err == nil {
+				result.ID = readingID(reading)
+				batch.Readings = append(batch.Readings, BatchReading{Sensor: item.Sensor, Reading: reading})
+			}
+		}
+		if err != nil {
+			result.Error = err.Error()
+			result.Field = ErrorField(err)
+			invalid = append(invalid, fmt.Sprintf("readings[%d]: %s", i, err.Error()))
+			internal = internal || FillErrorStatus(err) == 500
+			identity = identity || FillErrorStatus(err) == 403
+		}
+
+		batch.Results = append(batch.Results, result)
+	}
+
+	if internal {
+		return batch, InternalError(errors.New(fmt.Sprintf("cannot fill %d of %d readings: %s", len(invalid), len(items), strings.Join(invalid, "; "))))
+	}
+	if identity {
+		return batch, IdentityError(errors.New(fmt.Sprintf("cannot fill %d of %d readings: %s", len(invalid), len(items), strings.Join(invalid, "; "))))
+	}
+	if len(invalid) != 0 {
+		return batch, errors.New(fmt.Sprintf("%d of %d readings are invalid: %s", len(invalid), len(items), strings.Join(invalid, "; ")))
+	}
+
+	return batch, nil
+}
+
+// Store puts the readings and updates the last seen records once per device and sensor type.
+// Geofences and tamper rules are checked for every gps and light reading in the order of the batch,
+// so that they take the vibrations and transitions of the readings before into account;
+// the event values of the rules are returned
+func (batch *Batch) Store(stub shim.ChaincodeStubInterface) ([]EventValue, error) {
+	eventValues := []EventValue{}
+
+	checker := NewRuleChecker(stub)
+	lastSeen := map[string]int64{}
+	for _, item := range batch.Readings {
+		if err := UpdateOrInsertIn(stub, item.Reading, readingIndex(item.Sensor), []string{""}, ""); err != nil {
+			return nil, err
+		}
+		if err := IndexCertificateUsage(stub, item.Sensor, item.Reading); err != nil {
+			return nil, err
+		}
+
+		deviceID, timestamp := readingDevice(item.Reading)
+		key := deviceID + "\x00" + item.Sensor
+		if _, ok := lastSeen[key]; !ok || timestamp > lastSeen[key] {
+			lastSeen[key] = timestamp
+		}
+
+		switch reading := item.Reading.(type) {
+		case *Vibration:
+			if err := checker.IndexVibration(reading); err != nil {
+				return nil, err
+			}
+		case *Gps:
+			geofenceEventValues, err := checker.CheckGeofences(deviceID, reading)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("cannot check geofences: %s", err.Error()))
+			}
+			eventValues = append(eventValues, geofenceEventValues...)
+		case *Light:
+			tamperEventValues, err := checker.CheckTamper(reading.Value.CustomField, reading)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("cannot check tamper rules: %s", err.Error()))
+			}
+			eventValues = append(eventValues, tamperEventValues...)
+		}
+	}
+
+	// sorted, so that all endorsers write in the same order
+	keys := []string{}
+	for key := range lastSeen {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		parts := strings.SplitN(key, "\x00", 2)
+		if err := UpdateLastSeen(stub, parts[0], parts[1], lastSeen[key]); err != nil {
+			return nil, err
+		}
+	}
+
+	return eventValues, nil
+}
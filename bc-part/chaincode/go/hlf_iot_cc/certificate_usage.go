@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"sort"
+)
+
+// Readings by the fingerprint of the certificate they are submitted with
+const (
+	certificateUsageIndex = "ReadingByCertificate"
+)
+
+// what access to the reading depends on, so that the usage is filtered without loading the reading
+type certificateUsageValue struct {
+	DeviceID  string `json:"deviceid"`
+	MSPID     string `json:"mspid"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// IndexCertificateUsage records the reading of the sensor type under the certificate it is submitted with
+func IndexCertificateUsage(stub shim.ChaincodeStubInterface, sensor string, reading LedgerData) error {
+	submitter := readingSubmitter(reading)
+	if submitter.Fingerprint == "" {
+		return nil
+	}
+
+	deviceID, timestamp := readingDevice(reading)
+	value, err := json.Marshal(certificateUsageValue{DeviceID: deviceID, MSPID: submitter.MSPID, Timestamp: timestamp})
+	if err != nil {
+		return err
+	}
+
+	return putIndexEntry(stub, certificateUsageIndex, []string{submitter.Fingerprint, sensor, readingID(reading)}, string(value))
+}
+
+// indexCertificateUsageOf returns the indexer of readings of the sensor type stored before the certificate index
+// was introduced; it is a step of the schema migration
+func indexCertificateUsageOf(sensor string) Indexer {
+	return func(stub shim.ChaincodeStubInterface, entry LedgerData) error {
+		return IndexCertificateUsage(stub, sensor, entry)
+	}
+}
+
+func indexReadingCertificateUsage(stub shim.ChaincodeStubInterface, entry LedgerData) error {
+	return IndexCertificateUsage(stub, entry.(*Reading).Key.SensorType, entry)
+}
+
+// LoadUsage counts the readings submitted with the certificate which the creator has access to
+func (details *CertificateDetails) LoadUsage(stub shim.ChaincodeStubInterface, access *DataAccess) error {
+	details.Devices = []string{}
+	details.Readings = map[string]int{}
+	if details.Fingerprint == "" {
+		return nil
+	}
+
+	entries, err := getIndexEntries(stub, certificateUsageIndex, []string{details.Fingerprint})
+	if err != nil {
+		return err
+	}
+
+	devices := map[string]bool{}
+	for _, entry := range entries {
+		usage := certificateUsageValue{}
+		if err := json.Unmarshal(entry.Value, &usage); err != nil {
+			return errors.New(fmt.Sprintf("unable to unmarshal %s: %s", entry.Key, err.Error()))
+		}
+		if !access.Allows(usage.DeviceID, usage.MSPID, usage.Timestamp) {
+			continue
+		}
+
+		devices[usage.DeviceID] = true
+		details.Readings[entry.KeyParts[1]]++
+	}
+
+	for deviceID := range devices {
+		details.Devices = append(details.Devices, deviceID)
+	}
+	sort.Strings(details.Devices)
+
+	return nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"math"
+	"sort"
+)
+
+type Excursion struct {
+	Condition string  `json:"condition"`
+	DeviceID  string  `json:"deviceid"`
+	Start     int64   `json:"start"`
+	End       int64   `json:"end"`
+	Peak      float64 `json:"peak"`
+	Duration  int64   `json:"duration"`
+}
+
+type ComplianceReport struct {
+	ShipmentID string      `json:"shipmentid"`
+	From       int64       `json:"from"`
+	To         int64       `json:"to"`
+	Compliant  bool        `json:"compliant"`
+	Excursions []Excursion `json:"excursions"`
+}
+
+type conditionSample struct {
+	DeviceID  string
+	Timestamp int64
+	Value     float64
+}
+
+// BuildComplianceReport checks readings of the shipment's devices within [from, to] against its conditions.
+// Light and vibration are sent on state change only, so the last reading before the window
+// is taken as the state at its start, and an excursion lasts until the next in-range reading.
+// Readings not passing filterEntry are left out, so the report covers the data the creator has access to;
+// readings sent with untrusted certificates are left out too, so that they cannot fake or hide excursions.
+func BuildComplianceReport(stub shim.ChaincodeStubInterface, shipment *Shipment, from, to int64,
+	filterEntry FilterFunction) (ComplianceReport, error) {
+
+	report := ComplianceReport{}
+	report.ShipmentID = shipment.Key.ID
+	report.From = from
+	report.To = to
+	report.Excursions = []Excursion{}
+
+	conditionNames := []string{}
+	for name := range shipment.Value.Conditions {
+		conditionNames = append(conditionNames, name)
+	}
+	sort.Strings(conditionNames)
+
+	for _, name := range conditionNames {
+		samples, err := getConditionSamples(stub, name, shipment, to, filterEntry)
+		if err != nil {
+			return report, err
+		}
+
+		// grouping samples by device
+		devices := map[string][]conditionSample{}
+		for _, sample := range samples {
+			devices[sample.DeviceID] = append(devices[sample.DeviceID], sample)
+		}
+
+		for _, deviceID := range shipment.Value.DeviceIDs {
+			excursions := findExcursions(name, shipment.Value.Conditions[name], devices[deviceID], from, to)
+			report.Excursions = append(report.Excursions, excursions...)
+		}
+	}
+
+	report.Compliant = len(report.Excursions) == 0
+
+	return report, nil
+}
+
+func findExcursions(name string, condition ConditionRange, samples []conditionSample, from, to int64) []Excursion {
+	excursions := []Excursion{}
+
+	sort.SliceStable(samples, func(i, j int) bool {
+		return samples[i].Timestamp < samples[j].Timestamp
+	})
+
+	// the state at the beginning of the window
+	start := 0
+	for i, sample := range samples {
+		if sample.Timestamp <= from {
+			start = i
+		}
+	}
+
+	var current *Excursion
+	var currentDeviation float64
+	for _, sample := range samples[start:] {
+		timestamp := sample.Timestamp
+		if timestamp < from {
+			timestamp = from
+		}
+
+		deviation := 0.0
+		if condition.Min != nil && sample.Value < *condition.Min {
+			deviation = *condition.Min - sample.Value
+		}
+		if condition.Max != nil && sample.Value > *condition.Max {
+			deviation = sample.Value - *condition.Max
+		}
+
+		if deviation > 0 {
+			if current == nil {
+				current = &Excursion{Condition: name, DeviceID: sample.DeviceID, Start: timestamp, Peak: sample.Value}
+				currentDeviation = deviation
+			} else if deviation > currentDeviation {
+				current.Peak = sample.Value
+				currentDeviation = deviation
+			}
+		} else if current != nil {
+			current.End = timestamp
+			current.Duration = current.End - current.Start
+			excursions = append(excursions, *current)
+			current = nil
+		}
+	}
+
+	if current != nil {
+		current.End = to
+		current.Duration = current.End - current.Start
+		excursions = append(excursions, *current)
+	}
+
+	return excursions
+}
+
+// Returns readings of the shipment's devices up to the end of the window for the condition
+func getConditionSamples(stub shim.ChaincodeStubInterface, name string, shipment *Shipment, to int64,
+	filterEntry FilterFunction) ([]conditionSample, error) {
+
+	samples := []conditionSample{}
+
+	switch name {
+	case ConditionHumidity:
+		entries := []Humidity{}
+		if err := queryConditionEntries(stub, iotHumidityIndex, CreateHumidity, shipment, to, filterEntry, &entries); err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			samples = append(samples, conditionSample{entry.Value.CustomField, entry.Value.Timestamp, entry.Value.Humidity.Float64()})
+		}
+	case ConditionTemperature:
+		entries := []Barometer{}
+		if err := queryConditionEntries(stub, iotBarometerIndex, CreateBarometer, shipment, to, filterEntry, &entries); err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			samples = append(samples, conditionSample{entry.Value.CustomField, entry.Value.Timestamp, entry.Value.Temperature.Float64()})
+		}
+	case ConditionVibration:
+		entries := []Vibration{}
+		if err := queryConditionEntries(stub, iotVibrationIndex, CreateVibration, shipment, to, filterEntry, &entries); err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			samples = append(samples, conditionSample{entry.Value.CustomField, entry.Value.Timestamp, float64(entry.Value.Vibration)})
+		}
+	case ConditionLight:
+		entries := []Light{}
+		if err := queryConditionEntries(stub, iotLightIndex, CreateLight, shipment, to, filterEntry, &entries); err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			samples = append(samples, conditionSample{entry.Value.CustomField, entry.Value.Timestamp, float64(entry.Value.Light)})
+		}
+	case ConditionAcceleration:
+		entries := []Gyroscope{}
+		if err := queryConditionEntries(stub, iotGyroscopeIndex, CreateGyroscope, shipment, to, filterEntry, &entries); err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			x := entry.Value.AccelerationXoutScaled.Float64()
+			y := entry.Value.AccelerationYoutScaled.Float64()
+			z := entry.Value.AccelerationZoutScaled.Float64()
+			samples = append(samples, conditionSample{entry.Value.CustomField, entry.Value.Timestamp, math.Sqrt(x*x + y*y + z*z)})
+		}
+	default:
+		return nil, errors.New(fmt.Sprintf("unknown condition %s", name))
+	}
+
+	return samples, nil
+}
+
+func queryConditionEntries(stub shim.ChaincodeStubInterface, index string, createEntry FactoryMethod, shipment *Shipment,
+	to int64, filterEntry FilterFunction, entries interface{}) error {
+
+	entriesBytes, err := Query(stub, index, []string{}, createEntry, func(data LedgerData) bool {
+		customField, timestamp := readingDevice(data)
+		return shipment.IsBoundTo(customField) && timestamp <= to && readingTrusted(data) && filterEntry(data)
+	})
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(entriesBytes, entries)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestComplianceSkipsUntrustedReadings(t *testing.T) {
+	stub := shim.NewMockStub(chaincodeName, new(SupplyChainChaincode))
+
+	light := func(id string, valid int, timestamp int) {
+		putLegacy(t, stub, iotLightIndex, []string{id}, `{"light":1,"customfield":"device1","mspid":"org1MSP","valid":`+
+			strconv.Itoa(valid)+`,"timestamp":`+strconv.Itoa(timestamp)+`,"schemaversion":`+strconv.Itoa(iotLightSchemaVersion)+`}`)
+	}
+	light("11111111-1111-4111-8111-111111111111", 0, 110)
+	light("21111111-1111-4111-8111-111111111111", 1, 130)
+
+	shipment := Shipment{}
+	shipment.Key.ID = "S1"
+	shipment.Value.DeviceIDs = []string{"device1"}
+	dark := 0.0
+	shipment.Value.Conditions = map[string]ConditionRange{ConditionLight: {Max: &dark}}
+
+	stub.MockTransactionStart("report")
+	defer stub.MockTransactionEnd("report")
+	report, err := BuildComplianceReport(stub, &shipment, 100, 200, func(LedgerData) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Excursions) != 1 || report.Excursions[0].Start != 130 {
+		t.Errorf("excursions %+v, want one starting at the trusted reading", report.Excursions)
+	}
+}
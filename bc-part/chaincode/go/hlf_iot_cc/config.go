@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"strconv"
+	"strings"
 )
 
 const chaincodeName = "SupplyChainChaincode"
@@ -14,6 +16,22 @@ const (
 	configIndex = "ConfigSC"
 )
 
+// Sources of device identity
+const (
+	// e-mail addresses of the certificate
+	identitySourceEmail = "email"
+	// Fabric CA attributes of the certificate
+	identitySourceAttribute = "attribute"
+)
+
+// Fabric CA attributes of device certificates
+const (
+	attributeDeviceID = "iot.deviceId"
+	attributeOwner    = "iot.owner"
+	// "true" for identities allowed to register device certificates
+	attributeAdmin = "iot.admin"
+)
+
 // OrganizationalUnit constants
 var (
 	Buyer    = []string{"Buyer"}
@@ -22,19 +40,44 @@ var (
 
 // Type of events
 const (
-	eventAddIotGps         = "addIotGps"
-	eventAddIotBarometer   = "addIotBarometer"
-	eventAddIotGyroscope   = "addIotGyroscope"
-	eventAddIotHumidity    = "addIotHumidity"
-	eventAddIotVibration   = "addIotVibration"
-	eventAddIotLight       = "addIotLight"
-	eventAddIotCertificate = "addIotCertificate"
+	eventAddIotGps               = "addIotGps"
+	eventAddIotBarometer         = "addIotBarometer"
+	eventAddIotGyroscope         = "addIotGyroscope"
+	eventAddIotHumidity          = "addIotHumidity"
+	eventAddIotVibration         = "addIotVibration"
+	eventAddIotLight             = "addIotLight"
+	eventAddIotCertificate       = "addIotCertificate"
+	eventApproveIotCertificate   = "approveIotCertificate"
+	eventAddIotAnchor            = "addIotAnchor"
+	eventAddIotBatch             = "addIotBatch"
+	eventRegisterSensorType      = "registerSensorType"
+	eventAddIotReading           = "addIotReading"
+	eventAddCalibration          = "addCalibration"
+	eventAddGeofence             = "addGeofence"
+	eventDeleteGeofence          = "deleteGeofence"
+	eventGeofenceEnter           = "geofenceEnter"
+	eventGeofenceExit            = "geofenceExit"
+	eventAddShipment             = "addShipment"
+	eventUpdateShipmentState     = "updateShipmentState"
+	eventTransferShipmentCustody = "transferShipmentCustody"
+	eventAcceptShipmentCustody   = "acceptShipmentCustody"
+	eventTamperIncident          = "tamperIncident"
+	eventTamperIncidentEnd       = "tamperIncidentEnd"
+	eventRegisterDevice          = "registerDevice"
+	eventSetDesiredConfiguration = "setDesiredConfiguration"
+	eventReportConfiguration     = "reportConfiguration"
+	eventIssueCommand            = "issueCommand"
+	eventAcknowledgeCommand      = "acknowledgeCommand"
+	eventRequestDataAccess       = "requestDataAccess"
+	eventApproveDataAccess       = "approveDataAccess"
+	eventRevokeDataAccess        = "revokeDataAccess"
 )
 
 // Numerical constants
 const (
 	configKeyFieldsNumber      = 0
 	configBasicArgumentsNumber = 2
+	configSchemaVersion        = 6
 )
 
 var Logger = shim.NewLogger(chaincodeName)
@@ -48,8 +91,22 @@ type ConfigKey struct {
 }
 
 type ConfigValue struct {
-	Collections   []Collection `json:"collections"`
-	ChaincodeName string       `json:"chaincodeName"`
+	Collections    []Collection `json:"collections"`
+	ChaincodeName  string       `json:"chaincodeName"`
+	IdentitySource string       `json:"identitysource"`
+	ShockThreshold Measurement  `json:"shockthreshold"`
+	// number of member organizations out of the approvers which must approve a device certificate;
+	// zero activates certificates on registration
+	CertificateApprovals int      `json:"certificateapprovals"`
+	CertificateApprovers []string `json:"certificateapprovers"`
+	// PEM bundles of root and intermediate CA certificates by MSP ID; device certificates
+	// of organizations without a bundle cannot be registered and are reported as untrusted
+	CACertificates map[string]string `json:"cacertificates"`
+	// seconds Event entities are kept for before compactEvents deletes them; zero keeps them forever
+	EventRetention int64 `json:"eventretention"`
+	// sensor types whose readings emit chaincode events without storing Event entities
+	UnpersistedEventSensors []string `json:"unpersistedeventsensors"`
+	SchemaVersion           int      `json:"schemaversion"`
 }
 
 type Collection struct {
@@ -95,6 +152,11 @@ func (data *Config) FillFromCompositeKeyParts(compositeKeyParts []string) error
 }
 
 func (data *Config) FillFromLedgerValue(ledgerBytes []byte) error {
+	ledgerBytes, err := UpcastLedgerValue(configIndex, ledgerBytes)
+	if err != nil {
+		return err
+	}
+
 	if err := json.Unmarshal(ledgerBytes, &data.Value); err != nil {
 		return err
 	} else {
@@ -109,6 +171,7 @@ func (data *Config) ToCompositeKey(stub shim.ChaincodeStubInterface) (string, er
 }
 
 func (data *Config) ToLedgerValue() ([]byte, error) {
+	data.Value.SchemaVersion = configSchemaVersion
 	return json.Marshal(data.Value)
 }
 
@@ -124,3 +187,189 @@ func (data *Config) ExistsIn(stub shim.ChaincodeStubInterface, collection string
 
 	return true
 }
+
+// upcastIdentitySource keeps e-mail identities of configurations stored before the source was configurable
+func upcastIdentitySource(value map[string]interface{}) error {
+	if source, ok := value["identitysource"].(string); !ok || source == "" {
+		value["identitysource"] = identitySourceEmail
+	}
+
+	return nil
+}
+
+func CheckIdentitySource(source string) error {
+	if source != identitySourceEmail && source != identitySourceAttribute {
+		return errors.New(fmt.Sprintf("unknown identity source %s: expected %s or %s", source, identitySourceEmail, identitySourceAttribute))
+	}
+
+	return nil
+}
+
+// LoadConfig returns the stored config or an empty one if it has not been stored yet
+func LoadConfig(stub shim.ChaincodeStubInterface) (Config, error) {
+	config := Config{}
+	if !config.ExistsIn(stub, "") {
+		return config, nil
+	}
+
+	if err := LoadFrom(stub, &config, configIndex); err != nil {
+		return config, errors.New(fmt.Sprintf("unable to load the config: %s", err.Error()))
+	}
+
+	return config, nil
+}
+
+// GetIdentitySource returns the configured source of device identity, e-mail by default
+func GetIdentitySource(stub shim.ChaincodeStubInterface) (string, error) {
+	config, err := LoadConfig(stub)
+	if err != nil {
+		return "", err
+	}
+	if config.Value.IdentitySource == "" {
+		return identitySourceEmail, nil
+	}
+
+	return config.Value.IdentitySource, nil
+}
+
+// SetIdentitySource sets the source of device identity.
+// The setters change the loaded config only: a transaction does not read its own writes,
+// so Init applies all of its arguments to one config and stores it once
+func (config *Config) SetIdentitySource(source string) error {
+	if err := CheckIdentitySource(source); err != nil {
+		return err
+	}
+	config.Value.IdentitySource = source
+
+	return nil
+}
+
+// GetShockThreshold returns the configured acceleration above which a gyroscope reading is a shock
+func GetShockThreshold(stub shim.ChaincodeStubInterface) (Measurement, error) {
+	config, err := LoadConfig(stub)
+	if err != nil {
+		return Measurement{}, err
+	}
+	if config.Value.ShockThreshold.Value == 0 {
+		return defaultShockThreshold, nil
+	}
+
+	return config.Value.ShockThreshold, nil
+}
+
+func (config *Config) SetShockThreshold(thresholdString string) error {
+	threshold, err := ParseMeasurement(thresholdString, shockThresholdFormat)
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to parse the shock threshold: %s", err.Error()))
+	}
+	if threshold.Value <= 0 {
+		return errors.New("shock threshold must be larger than zero")
+	}
+	config.Value.ShockThreshold = threshold
+
+	return nil
+}
+
+// GetCertificateApproval returns the number of approvals a device certificate needs and the MSPs which may approve it
+func GetCertificateApproval(stub shim.ChaincodeStubInterface) (int, []string, error) {
+	config, err := LoadConfig(stub)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return config.Value.CertificateApprovals, config.Value.CertificateApprovers, nil
+}
+
+func (config *Config) SetCertificateApproval(approvalsString string, approversString string) error {
+	approvals, err := strconv.Atoi(approvalsString)
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to parse the number of certificate approvals: %s", err.Error()))
+	}
+
+	approvers := []string{}
+	for _, approver := range strings.Split(approversString, ",") {
+		if approver = strings.TrimSpace(approver); approver != "" {
+			approvers = append(approvers, approver)
+		}
+	}
+	if approvals < 0 || approvals > len(approvers) {
+		return errors.New(fmt.Sprintf("number of certificate approvals must be between 0 and the number of approvers %d", len(approvers)))
+	}
+
+	config.Value.CertificateApprovals = approvals
+	config.Value.CertificateApprovers = approvers
+
+	return nil
+}
+
+// GetCACertificates returns the PEM bundle of the CA certificates of the MSP, empty if it is not configured
+func GetCACertificates(stub shim.ChaincodeStubInterface, mspid string) (string, error) {
+	config, err := LoadConfig(stub)
+	if err != nil {
+		return "", err
+	}
+
+	return config.Value.CACertificates[mspid], nil
+}
+
+// SetCACertificates replaces the CA certificates with a JSON object of PEM bundles by MSP ID
+func (config *Config) SetCACertificates(bundlesString string) error {
+	bundles := map[string]string{}
+	if err := json.Unmarshal([]byte(bundlesString), &bundles); err != nil {
+		return errors.New(fmt.Sprintf("cannot unmarshaling CA certificates: %s", err.Error()))
+	}
+	for mspid, bundle := range bundles {
+		if _, err := ParseCertificatePool(bundle); err != nil {
+			return errors.New(fmt.Sprintf("CA certificates of %s: %s", mspid, err.Error()))
+		}
+	}
+
+	config.Value.CACertificates = bundles
+
+	return nil
+}
+
+func (config *Config) SetEventPersistence(stub shim.ChaincodeStubInterface, retentionString string, sensorsString string) error {
+	retention := int64(0)
+	if retentionString != "" {
+		var err error
+		retention, err = strconv.ParseInt(retentionString, 10, 64)
+		if err != nil {
+			return errors.New(fmt.Sprintf("unable to parse the event retention: %s", err.Error()))
+		}
+		if retention < 0 {
+			return errors.New("event retention must not be negative")
+		}
+	}
+
+	sensors := []string{}
+	for _, sensor := range strings.Split(sensorsString, ",") {
+		if sensor = strings.TrimSpace(sensor); sensor == "" {
+			continue
+		}
+		if _, err := GetIotSensorType(stub, sensor); err != nil {
+			return err
+		}
+		sensors = append(sensors, sensor)
+	}
+
+	config.Value.EventRetention = retention
+	config.Value.UnpersistedEventSensors = sensors
+
+	return nil
+}
+
+// IsEventPersisted reports whether the event is stored as an Event entity; readings of registered sensor types
+// share an entity type, so their events are told apart by the sensor type
+func (config *Config) IsEventPersisted(event EventValue) bool {
+	for _, sensor := range config.Value.UnpersistedEventSensors {
+		if sensorType, ok := iotSensorTypes[sensor]; ok && sensorType.Index == event.EntityType {
+			return false
+		}
+		if sensor == event.Sensor {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+const (
+	deviceIndex = "Device"
+)
+
+const (
+	deviceKeyFieldsNumber      = 1
+	deviceBasicArgumentsNumber = 1
+	deviceSchemaVersion        = 1
+)
+
+type deviceKey struct {
+	DeviceID string `json:"deviceid"`
+}
+
+// The owner is set once on registration; it approves access to the device data and manages the device
+type deviceValue struct {
+	Owner         string `json:"owner"`
+	RegisteredBy  string `json:"registeredby"`
+	Timestamp     int64  `json:"timestamp"`
+	SchemaVersion int    `json:"schemaversion"`
+}
+
+type Device struct {
+	Key   deviceKey   `json:"key"`
+	Value deviceValue `json:"value"`
+}
+
+func CreateDevice() LedgerData {
+	return new(Device)
+}
+
+//argument order
+//0
+//DeviceID
+func (entity *Device) FillFromArguments(stub shim.ChaincodeStubInterface, args []string) error {
+	if len(args) < deviceBasicArgumentsNumber {
+		return errors.New(fmt.Sprintf("arguments array must contain at least %d items", deviceBasicArgumentsNumber))
+	}
+
+	if err := entity.FillFromCompositeKeyParts(args[:deviceKeyFieldsNumber]); err != nil {
+		return ArgumentError("deviceID", err)
+	}
+
+	return nil
+}
+
+func (entity *Device) FillFromCompositeKeyParts(compositeKeyParts []string) error {
+	if len(compositeKeyParts) < deviceKeyFieldsNumber {
+		return errors.New(fmt.Sprintf("composite key parts array must contain at least %d items", deviceKeyFieldsNumber))
+	}
+
+	if compositeKeyParts[0] == "" {
+		return errors.New("device ID must be not empty")
+	}
+
+	entity.Key.DeviceID = compositeKeyParts[0]
+
+	return nil
+}
+
+func (entity *Device) FillFromLedgerValue(ledgerValue []byte) error {
+	ledgerValue, err := UpcastLedgerValue(deviceIndex, ledgerValue)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(ledgerValue, &entity.Value); err != nil {
+		return err
+	} else {
+		return nil
+	}
+}
+
+func (entity *Device) ToCompositeKey(stub shim.ChaincodeStubInterface) (string, error) {
+	compositeKeyParts := []string{
+		entity.Key.DeviceID,
+	}
+
+	return stub.CreateCompositeKey(deviceIndex, compositeKeyParts)
+}
+
+func (entity *Device) ToLedgerValue() ([]byte, error) {
+	entity.Value.SchemaVersion = deviceSchemaVersion
+	return json.Marshal(entity.Value)
+}
+
+// GetDeviceOwner returns the MSP the device is registered by, or an empty string for unregistered devices
+func GetDeviceOwner(stub shim.ChaincodeStubInterface, deviceID string) (string, error) {
+	device := Device{}
+	if err := device.FillFromCompositeKeyParts([]string{deviceID}); err != nil {
+		return "", err
+	}
+
+	if !ExistsIn(stub, &device, deviceIndex) {
+		return "", nil
+	}
+
+	if err := LoadFrom(stub, &device, deviceIndex); err != nil {
+		return "", err
+	}
+
+	return device.Value.Owner, nil
+}
+
+// CanManageDevice reports whether the creator may configure, command or calibrate the device:
+// members of the owner MSP and admins of the certificate approvers may, devices themselves never do
+func CanManageDevice(stub shim.ChaincodeStubInterface, deviceID string) (bool, error) {
+	if device, err := IsDevice(stub); err != nil || device {
+		return false, err
+	}
+
+	if admin, err := IsNetworkAdmin(stub); err != nil || admin {
+		return admin, err
+	}
+
+	owner, err := GetDeviceOwner(stub, deviceID)
+	if err != nil || owner == "" {
+		return false, err
+	}
+
+	creator, err := GetMSPID(stub)
+	if err != nil {
+		return false, err
+	}
+
+	return creator == owner, nil
+}
+
+// IsDevice reports whether the creator is a device: its certificate carries the device ID attribute
+// or, with identities read from emails, its device ID belongs to a registered device
+func IsDevice(stub shim.ChaincodeStubInterface) (bool, error) {
+	if _, found, err := cid.GetAttributeValue(stub, attributeDeviceID); err != nil || found {
+		return found, err
+	}
+
+	creatorID, found, err := LookupDeviceID(stub)
+	if err != nil || !found {
+		return false, err
+	}
+
+	owner, err := GetDeviceOwner(stub, creatorID)
+	return owner != "", err
+}
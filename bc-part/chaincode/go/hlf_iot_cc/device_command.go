@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/satori/go.uuid"
+	"strconv"
+)
+
+const (
+	deviceCommandIndex = "DeviceCommand"
+)
+
+const (
+	deviceCommandKeyFieldsNumber      = 2
+	deviceCommandBasicArgumentsNumber = 2
+	deviceCommandSchemaVersion        = 1
+)
+
+// Command states
+const (
+	CommandStateUnknown = iota
+	CommandStatePending
+	CommandStateAcknowledged
+	CommandStateFailed
+)
+
+var commandStatesAutomaton = map[int][]int{
+	CommandStatePending: {CommandStateAcknowledged, CommandStateFailed},
+}
+
+// Commands devices are able to execute
+const (
+	CommandFlushQueue      = "flushQueue"
+	CommandRereadKeys      = "rereadKeys"
+	CommandBlinkLed        = "blinkLed"
+	CommandSwitchSensorOff = "switchSensorOff"
+	CommandSwitchSensorOn  = "switchSensorOn"
+)
+
+var deviceCommands = []string{CommandFlushQueue, CommandRereadKeys, CommandBlinkLed, CommandSwitchSensorOff, CommandSwitchSensorOn}
+
+// The device does not poll for commands while blinking, so the number of blinks is bounded
+const maxBlinkLedTimes = 20
+
+type deviceCommandKey struct {
+	DeviceID string `json:"deviceid"`
+	ID       string `json:"id"`
+}
+
+type deviceCommandValue struct {
+	Command        string   `json:"command"`
+	Parameters     []string `json:"parameters"`
+	State          int      `json:"state"`
+	IssuedBy       string   `json:"issuedby"`
+	IssueTimestamp int64    `json:"issuetimestamp"`
+	// output of the device for acknowledged commands, the error for failed ones
+	Result        string `json:"result"`
+	Timestamp     int64  `json:"timestamp"`
+	SchemaVersion int    `json:"schemaversion"`
+}
+
+type DeviceCommand struct {
+	Key   deviceCommandKey   `json:"key"`
+	Value deviceCommandValue `json:"value"`
+}
+
+func CreateDeviceCommand() LedgerData {
+	return new(DeviceCommand)
+}
+
+//argument order
+//0			1		2
+//DeviceID	Command	Parameters (optional)
+func (entity *DeviceCommand) FillFromArguments(stub shim.ChaincodeStubInterface, args []string) error {
+	if len(args) < deviceCommandBasicArgumentsNumber {
+		return errors.New(fmt.Sprintf("arguments array must contain at least %d items", deviceCommandBasicArgumentsNumber))
+	}
+
+	u, err := uuid.NewV4()
+	if err != nil {
+		return InternalError(errors.New(fmt.Sprintf("unable to generate uuid: %s", err.Error())))
+	}
+
+	if err := entity.FillFromCompositeKeyParts([]string{args[0], u.String()}); err != nil {
+		return ArgumentError("deviceID", err)
+	}
+
+	// checking the command
+	command := args[1]
+	known := false
+	for _, deviceCommand := range deviceCommands {
+		if command == deviceCommand {
+			known = true
+		}
+	}
+	if !known {
+		return ArgumentError("command", errors.New(fmt.Sprintf("unknown command %s; expected one of %v", command, deviceCommands)))
+	}
+	entity.Value.Command = command
+
+	parameters := []string{}
+	if len(args) > 2 && len(args[2]) != 0 {
+		if err := json.Unmarshal([]byte(args[2]), &parameters); err != nil {
+			return ArgumentError("parameters", errors.New(fmt.Sprintf("cannot unmarshaling parameters: %s", err.Error())))
+		}
+	}
+	if command == CommandSwitchSensorOff || command == CommandSwitchSensorOn {
+		if len(parameters) != 1 {
+			return ArgumentError("parameters", errors.New(fmt.Sprintf("command %s takes exactly one sensor", command)))
+		}
+		if _, err := GetIotSensorType(stub, parameters[0]); err != nil {
+			return ArgumentError("parameters", err)
+		}
+	}
+	if command == CommandBlinkLed && len(parameters) != 0 {
+		if len(parameters) != 1 {
+			return ArgumentError("parameters", errors.New(fmt.Sprintf("command %s takes at most one parameter", command)))
+		}
+		if times, err := strconv.Atoi(parameters[0]); err != nil || times < 1 || times > maxBlinkLedTimes {
+			return ArgumentError("parameters", errors.New(fmt.Sprintf("number of blinks must be an integer from 1 to %d", maxBlinkLedTimes)))
+		}
+	}
+	entity.Value.Parameters = parameters
+
+	//getting transaction Timestamp
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return InternalError(errors.New(fmt.Sprintf("unable to get transaction timestamp: %s", err.Error())))
+	}
+	entity.Value.IssueTimestamp = timestamp.Seconds
+	entity.Value.Timestamp = timestamp.Seconds
+
+	entity.Value.State = CommandStatePending
+
+	return nil
+}
+
+func (entity *DeviceCommand) FillFromCompositeKeyParts(compositeKeyParts []string) error {
+	if len(compositeKeyParts) < deviceCommandKeyFieldsNumber {
+		return errors.New(fmt.Sprintf("composite key parts array must contain at least %d items", deviceCommandKeyFieldsNumber))
+	}
+
+	if compositeKeyParts[0] == "" {
+		return errors.New("device ID must be not empty")
+	}
+
+	if id, err := uuid.FromString(compositeKeyParts[1]); err != nil {
+		return errors.New(fmt.Sprintf("unable to parse an ID from \"%s\"", compositeKeyParts[1]))
+	} else if id.Version() != uuid.V4 {
+		return errors.New("wrong ID format; expected UUID version 4")
+	}
+
+	entity.Key.DeviceID = compositeKeyParts[0]
+	entity.Key.ID = compositeKeyParts[1]
+
+	return nil
+}
+
+func (entity *DeviceCommand) FillFromLedgerValue(ledgerValue []byte) error {
+	ledgerValue, err := UpcastLedgerValue(deviceCommandIndex, ledgerValue)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(ledgerValue, &entity.Value); err != nil {
+		return err
+	} else {
+		return nil
+	}
+}
+
+func (entity *DeviceCommand) ToCompositeKey(stub shim.ChaincodeStubInterface) (string, error) {
+	compositeKeyParts := []string{
+		entity.Key.DeviceID,
+		entity.Key.ID,
+	}
+
+	return stub.CreateCompositeKey(deviceCommandIndex, compositeKeyParts)
+}
+
+func (entity *DeviceCommand) ToLedgerValue() ([]byte, error) {
+	entity.Value.SchemaVersion = deviceCommandSchemaVersion
+	return json.Marshal(entity.Value)
+}
+
+func (entity *DeviceCommand) IsPending() bool {
+	return entity.Value.State == CommandStatePending
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"sort"
+	"strconv"
+)
+
+const (
+	deviceLastSeenIndex = "DeviceLastSeen"
+)
+
+const (
+	deviceLastSeenKeyFieldsNumber      = 2
+	deviceLastSeenBasicArgumentsNumber = 1
+	deviceLastSeenSchemaVersion        = 2
+)
+
+// Sources of last-seen timestamps besides the sensor types
+const (
+	lastSeenHeartbeat = "heartbeat"
+	lastSeenAnchor    = "anchor"
+)
+
+// Last-seen timestamps are kept per device and sensor, so that readings of different sensors
+// submitted in the same block do not conflict with each other
+type deviceLastSeenKey struct {
+	DeviceID string `json:"deviceid"`
+	Sensor   string `json:"sensor"`
+}
+
+type deviceLastSeenValue struct {
+	// transaction timestamp of the latest submission
+	LastSeen int64 `json:"lastseen"`
+	// device timestamp of the latest reading of the latest submission
+	ReadingTimestamp int64 `json:"readingtimestamp"`
+	// MSP of the latest submission; empty until the next submission after version 1.
+	// It is not the owner of the device, which is set by registerDevice
+	MSPID         string `json:"mspid"`
+	SchemaVersion int    `json:"schemaversion"`
+}
+
+type DeviceLastSeen struct {
+	Key   deviceLastSeenKey   `json:"key"`
+	Value deviceLastSeenValue `json:"value"`
+}
+
+func CreateDeviceLastSeen() LedgerData {
+	return new(DeviceLastSeen)
+}
+
+//argument order
+//0
+//Timestamp
+func (entity *DeviceLastSeen) FillFromArguments(stub shim.ChaincodeStubInterface, args []string) error {
+	if len(args) < deviceLastSeenBasicArgumentsNumber {
+		return errors.New(fmt.Sprintf("arguments array must contain at least %d items", deviceLastSeenBasicArgumentsNumber))
+	}
+
+	timestampString := args[0]
+	if timestampString == "" {
+		message := fmt.Sprintf("timestamp must be not empty")
+		return ArgumentError("timestamp", errors.New(message))
+	}
+	timestamp, err := strconv.ParseInt(timestampString, 10, 64)
+	if err != nil {
+		return ArgumentError("timestamp", errors.New(fmt.Sprintf("unable to parse the timestamp: %s", err.Error())))
+	}
+	if timestamp < 0 {
+		return ArgumentError("timestamp", errors.New("timestamp must be larger than zero"))
+	}
+
+	//get device identity from certificate
+	deviceID, err := GetDeviceID(stub)
+	if err != nil {
+		return IdentityError(errors.New(fmt.Sprintf("cannot obtain creator's device identity: %s", err.Error())))
+	}
+
+	if err := entity.FillFromCompositeKeyParts([]string{deviceID, lastSeenHeartbeat}); err != nil {
+		return err
+	}
+	entity.Value.ReadingTimestamp = timestamp
+
+	return nil
+}
+
+func (entity *DeviceLastSeen) FillFromCompositeKeyParts(compositeKeyParts []string) error {
+	if len(compositeKeyParts) < deviceLastSeenKeyFieldsNumber {
+		return errors.New(fmt.Sprintf("composite key parts array must contain at least %d items", deviceLastSeenKeyFieldsNumber))
+	}
+
+	if compositeKeyParts[0] == "" {
+		return errors.New("device ID must be not empty")
+	}
+	if compositeKeyParts[1] == "" {
+		return errors.New("sensor must be not empty")
+	}
+
+	entity.Key.DeviceID = compositeKeyParts[0]
+	entity.Key.Sensor = compositeKeyParts[1]
+
+	return nil
+}
+
+func (entity *DeviceLastSeen) FillFromLedgerValue(ledgerValue []byte) error {
+	ledgerValue, err := UpcastLedgerValue(deviceLastSeenIndex, ledgerValue)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(ledgerValue, &entity.Value); err != nil {
+		return err
+	} else {
+		return nil
+	}
+}
+
+func (entity *DeviceLastSeen) ToCompositeKey(stub shim.ChaincodeStubInterface) (string, error) {
+	compositeKeyParts := []string{
+		entity.Key.DeviceID,
+		entity.Key.Sensor,
+	}
+
+	return stub.CreateCompositeKey(deviceLastSeenIndex, compositeKeyParts)
+}
+
+func (entity *DeviceLastSeen) ToLedgerValue() ([]byte, error) {
+	entity.Value.SchemaVersion = deviceLastSeenSchemaVersion
+	return json.Marshal(entity.Value)
+}
+
+// UpdateLastSeen records a submission of the device for the sensor. The record is written blindly,
+// without reading the previous one, so that concurrent submissions of the device do not fail
+// the MVCC validation of each other; the latest write wins and staleness is decided at query time.
+// Submissions of certificates without a device identity are not tracked
+func UpdateLastSeen(stub shim.ChaincodeStubInterface, deviceID string, sensor string, readingTimestamp int64) error {
+	if deviceID == "" {
+		return nil
+	}
+
+	lastSeen := DeviceLastSeen{}
+	if err := lastSeen.FillFromCompositeKeyParts([]string{deviceID, sensor}); err != nil {
+		return err
+	}
+
+	//getting transaction Timestamp
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to get transaction timestamp: %s", err.Error()))
+	}
+	lastSeen.Value.LastSeen = timestamp.Seconds
+	lastSeen.Value.ReadingTimestamp = readingTimestamp
+
+	mspid, err := GetMSPID(stub)
+	if err != nil {
+		return err
+	}
+	lastSeen.Value.MSPID = mspid
+
+	return UpdateOrInsertIn(stub, &lastSeen, deviceLastSeenIndex, []string{""}, "")
+}
+
+type StaleDevice struct {
+	DeviceID string `json:"deviceid"`
+	// latest submission of any sensor
+	LastSeen int64 `json:"lastseen"`
+	// latest submission of every sensor of the device
+	Sensors      map[string]int64 `json:"sensors"`
+	StaleSensors []string         `json:"stalesensors"`
+	// no sensor of the device is heard of within the silence
+	Silent bool `json:"silent"`
+}
+
+// FindStaleDevices returns devices with at least one sensor which has not submitted anything
+// for more than maxSilence seconds before now
+func FindStaleDevices(stub shim.ChaincodeStubInterface, maxSilence int64, now int64) ([]StaleDevice, error) {
+	lastSeens := []DeviceLastSeen{}
+	lastSeensBytes, err := Query(stub, deviceLastSeenIndex, []string{}, CreateDeviceLastSeen, EmptyFilter)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(lastSeensBytes, &lastSeens); err != nil {
+		return nil, err
+	}
+
+	devices := map[string]*StaleDevice{}
+	for _, lastSeen := range lastSeens {
+		device, ok := devices[lastSeen.Key.DeviceID]
+		if !ok {
+			device = &StaleDevice{DeviceID: lastSeen.Key.DeviceID, Sensors: map[string]int64{}, StaleSensors: []string{}}
+			devices[lastSeen.Key.DeviceID] = device
+		}
+
+		device.Sensors[lastSeen.Key.Sensor] = lastSeen.Value.LastSeen
+		if lastSeen.Value.LastSeen > device.LastSeen {
+			device.LastSeen = lastSeen.Value.LastSeen
+		}
+		if now-lastSeen.Value.LastSeen > maxSilence {
+			device.StaleSensors = append(device.StaleSensors, lastSeen.Key.Sensor)
+		}
+	}
+
+	staleDevices := []StaleDevice{}
+	for _, device := range devices {
+		if len(device.StaleSensors) == 0 {
+			continue
+		}
+		device.Silent = now-device.LastSeen > maxSilence
+		staleDevices = append(staleDevices, *device)
+	}
+
+	sort.Slice(staleDevices, func(i, j int) bool {
+		return staleDevices[i].DeviceID < staleDevices[j].DeviceID
+	})
+
+	return staleDevices, nil
+}
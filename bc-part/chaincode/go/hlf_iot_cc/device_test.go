@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCanManageDevice(t *testing.T) {
+	stub := newCommittedStub()
+	stub.init(t, "", "", "0", "org1MSP")
+
+	key, err := stub.CreateCompositeKey(deviceIndex, []string{"device1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.putCommitted(t, key, []byte(`{"owner":"org2MSP","registeredby":"org2MSP","timestamp":1,"schemaversion":1}`))
+
+	ca := newTestCA(t, "org")
+	device := map[string]string{attributeDeviceID: "device1"}
+
+	tests := []struct {
+		name    string
+		creator []byte
+		want    bool
+	}{
+		{"member of the owner MSP", ca.Identity(t, "org2MSP", "user2", nil), true},
+		{"the device itself", ca.Identity(t, "org2MSP", "device1", device), false},
+		{"another device of the owner MSP", ca.Identity(t, "org2MSP", "device2", map[string]string{attributeDeviceID: "device2"}), false},
+		{"member of another MSP", ca.Identity(t, "org3MSP", "user3", nil), false},
+		{"admin of a certificate approver", ca.Identity(t, "org1MSP", "admin1", map[string]string{attributeAdmin: "true"}), true},
+		{"device with the admin attribute", ca.Identity(t, "org1MSP", "device3",
+			map[string]string{attributeDeviceID: "device3", attributeAdmin: "true"}), false},
+	}
+
+	for _, test := range tests {
+		stub.creator = test.creator
+
+		if got, err := CanManageDevice(stub, "device1"); err != nil || got != test.want {
+			t.Errorf("%s: CanManageDevice() = %v, %v; want %v", test.name, got, err, test.want)
+		}
+	}
+}
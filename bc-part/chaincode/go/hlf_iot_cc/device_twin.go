@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"strconv"
+)
+
+const (
+	deviceTwinIndex = "DeviceTwin"
+)
+
+const (
+	deviceTwinKeyFieldsNumber      = 1
+	deviceTwinBasicArgumentsNumber = 2
+	deviceTwinSchemaVersion        = 1
+)
+
+// DeviceConfiguration is the runtime configuration of a device, applied by the device without rebuilding it
+type DeviceConfiguration struct {
+	// delay between readings of the polled sensors
+	GatheringIntervalSeconds int `json:"gatheringintervalseconds"`
+	// debounce of the sensors with callbacks
+	CallbackDelaySeconds int `json:"callbackdelayseconds"`
+	// sensor types which are switched on; sensors which are not listed keep their state
+	Sensors map[string]bool `json:"sensors"`
+}
+
+type deviceTwinKey struct {
+	DeviceID string `json:"deviceid"`
+}
+
+type deviceTwinValue struct {
+	Desired           DeviceConfiguration `json:"desired"`
+	DesiredVersion    int                 `json:"desiredversion"`
+	DesiredBy         string              `json:"desiredby"`
+	DesiredTimestamp  int64               `json:"desiredtimestamp"`
+	Reported          DeviceConfiguration `json:"reported"`
+	ReportedVersion   int                 `json:"reportedversion"`
+	ReportedTimestamp int64               `json:"reportedtimestamp"`
+	SchemaVersion     int                 `json:"schemaversion"`
+}
+
+type DeviceTwin struct {
+	Key   deviceTwinKey   `json:"key"`
+	Value deviceTwinValue `json:"value"`
+}
+
+func CreateDeviceTwin() LedgerData {
+	return new(DeviceTwin)
+}
+
+func ParseDeviceConfiguration(stub shim.ChaincodeStubInterface, configurationString string) (DeviceConfiguration, error) {
+	configuration := DeviceConfiguration{}
+	if configurationString == "" {
+		return configuration, errors.New("configuration must be not empty")
+	}
+
+	if err := json.Unmarshal([]byte(configurationString), &configuration); err != nil {
+		return configuration, errors.New(fmt.Sprintf("cannot unmarshaling configuration: %s", err.Error()))
+	}
+
+	if configuration.GatheringIntervalSeconds <= 0 {
+		return configuration, errors.New("gathering interval must be larger than zero")
+	}
+	if configuration.CallbackDelaySeconds <= 0 {
+		return configuration, errors.New("callback delay must be larger than zero")
+	}
+	for sensor := range configuration.Sensors {
+		if _, err := GetIotSensorType(stub, sensor); err != nil {
+			return configuration, err
+		}
+	}
+
+	return configuration, nil
+}
+
+//argument order
+//0			1
+//DeviceID	Configuration
+func (entity *DeviceTwin) FillFromArguments(stub shim.ChaincodeStubInterface, args []string) error {
+	if len(args) < deviceTwinBasicArgumentsNumber {
+		return errors.New(fmt.Sprintf("arguments array must contain at least %d items", deviceTwinBasicArgumentsNumber))
+	}
+
+	if err := entity.FillFromCompositeKeyParts(args[:deviceTwinKeyFieldsNumber]); err != nil {
+		return ArgumentError("deviceID", err)
+	}
+
+	configuration, err := ParseDeviceConfiguration(stub, args[1])
+	if err != nil {
+		return ArgumentError("configuration", err)
+	}
+	entity.Value.Desired = configuration
+
+	return nil
+}
+
+func (entity *DeviceTwin) FillFromCompositeKeyParts(compositeKeyParts []string) error {
+	if len(compositeKeyParts) < deviceTwinKeyFieldsNumber {
+		return errors.New(fmt.Sprintf("composite key parts array must contain at least %d items", deviceTwinKeyFieldsNumber))
+	}
+
+	if compositeKeyParts[0] == "" {
+		return errors.New("device ID must be not empty")
+	}
+
+	entity.Key.DeviceID = compositeKeyParts[0]
+
+	return nil
+}
+
+func (entity *DeviceTwin) FillFromLedgerValue(ledgerValue []byte) error {
+	ledgerValue, err := UpcastLedgerValue(deviceTwinIndex, ledgerValue)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(ledgerValue, &entity.Value); err != nil {
+		return err
+	} else {
+		return nil
+	}
+}
+
+func (entity *DeviceTwin) ToCompositeKey(stub shim.ChaincodeStubInterface) (string, error) {
+	compositeKeyParts := []string{
+		entity.Key.DeviceID,
+	}
+
+	return stub.CreateCompositeKey(deviceTwinIndex, compositeKeyParts)
+}
+
+func (entity *DeviceTwin) ToLedgerValue() ([]byte, error) {
+	entity.Value.SchemaVersion = deviceTwinSchemaVersion
+	return json.Marshal(entity.Value)
+}
+
+//argument order
+//0			1
+//Version	Configuration
+func (entity *DeviceTwin) FillReportedFromArguments(stub shim.ChaincodeStubInterface, args []string) error {
+	if len(args) < 2 {
+		return errors.New(fmt.Sprintf("arguments array must contain at least %d items", 2))
+	}
+
+	version, err := strconv.Atoi(args[0])
+	if err != nil {
+		return ArgumentError("version", errors.New(fmt.Sprintf("unable to parse the version: %s", err.Error())))
+	}
+	// version 0 is the configuration the device was built with
+	if version < 0 || version > entity.Value.DesiredVersion {
+		return ArgumentError("version", errors.New(fmt.Sprintf("version must be between 0 and the desired version %d", entity.Value.DesiredVersion)))
+	}
+	if version < entity.Value.ReportedVersion {
+		return ArgumentError("version", errors.New(fmt.Sprintf("version %d is older than the reported version %d", version, entity.Value.ReportedVersion)))
+	}
+
+	configuration, err := ParseDeviceConfiguration(stub, args[1])
+	if err != nil {
+		return ArgumentError("configuration", err)
+	}
+
+	entity.Value.Reported = configuration
+	entity.Value.ReportedVersion = version
+
+	return nil
+}
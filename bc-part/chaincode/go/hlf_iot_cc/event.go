@@ -6,15 +6,27 @@ import (
 	"fmt"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	"github.com/satori/go.uuid"
+	"strings"
 )
 
 const (
 	eventIndex = "Event"
+	// simple keys ordered by the event timestamp, so that expired events are found by a range query
+	eventTimeIndex = "EventByTime"
 )
 
 const (
+	eventCompactionBatchSize  = 500
 	eventKeyFieldsNumber      = 1
 	eventBasicArgumentsNumber = 5
+	eventSchemaVersion        = 3
+)
+
+// Priorities of events
+const (
+	EventPriorityNormal = "normal"
+	// events which need attention of a person, e.g. tamper incidents
+	EventPriorityHigh = "high"
 )
 
 type EventKey struct {
@@ -22,12 +34,15 @@ type EventKey struct {
 }
 
 type EventValue struct {
-	Timestamp  int64       `json:"timestamp"`
-	Creator    string      `json:"creator"`
-	EntityType string      `json:"entityType"`
-	EntityID   string      `json:"entityID"`
-	Action     string      `json:"action"`
-	Other      interface{} `json:"other"`
+	Timestamp     int64       `json:"timestamp"`
+	Creator       string      `json:"creator"`
+	EntityType    string      `json:"entityType"`
+	EntityID      string      `json:"entityID"`
+	Action        string      `json:"action"`
+	Sensor        string      `json:"sensor,omitempty"`
+	Other         interface{} `json:"other"`
+	Priority      string      `json:"priority"`
+	SchemaVersion int         `json:"schemaversion"`
 }
 
 type Event struct {
@@ -71,6 +86,11 @@ func (entity *Event) FillFromCompositeKeyParts(compositeKeyParts []string) error
 }
 
 func (entity *Event) FillFromLedgerValue(ledgerValue []byte) error {
+	ledgerValue, err := UpcastLedgerValue(eventIndex, ledgerValue)
+	if err != nil {
+		return err
+	}
+
 	if err := json.Unmarshal(ledgerValue, &entity.Value); err != nil {
 		return err
 	} else {
@@ -87,5 +107,95 @@ func (entity *Event) ToCompositeKey(stub shim.ChaincodeStubInterface) (string, e
 }
 
 func (entity *Event) ToLedgerValue() ([]byte, error) {
+	entity.Value.SchemaVersion = eventSchemaVersion
 	return json.Marshal(entity.Value)
 }
+
+func upcastEventPriority(value map[string]interface{}) error {
+	value["priority"] = EventPriorityNormal
+	return nil
+}
+
+type EventCompaction struct {
+	Visited int `json:"visited"`
+	Deleted int `json:"deleted"`
+	// key to pass to the next call; empty when all events are visited
+	LastKey   string `json:"lastkey"`
+	Completed bool   `json:"completed"`
+}
+
+// eventTimeKey returns the key of the event in the time index; timestamps are zero-padded to sort as numbers
+func eventTimeKey(timestamp int64, id string) string {
+	return fmt.Sprintf("%s.%020d.%s", eventTimeIndex, timestamp, id)
+}
+
+// IndexEventTime writes the entry of the event to the time index; the value is the event ID
+func IndexEventTime(stub shim.ChaincodeStubInterface, entry LedgerData) error {
+	event := entry.(*Event)
+	return stub.PutState(eventTimeKey(event.Value.Timestamp, event.Key.ID), []byte(event.Key.ID))
+}
+
+// CompactEvents deletes events older than the retention, visiting at most batchSize events after the last key.
+// Expired events are read from the time index, so that a call costs the number of events it deletes
+func CompactEvents(stub shim.ChaincodeStubInterface, retention int64, batchSize int, lastKey string) (EventCompaction, error) {
+	compaction := EventCompaction{}
+
+	//getting transaction Timestamp
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return compaction, errors.New(fmt.Sprintf("unable to get transaction timestamp: %s", err.Error()))
+	}
+	expiry := timestamp.Seconds - retention
+	if expiry <= 0 {
+		compaction.Completed = true
+		return compaction, nil
+	}
+
+	// keys of previous versions are composite keys of the events, so the compaction starts over
+	startKey := eventTimeIndex + "."
+	if strings.HasPrefix(lastKey, startKey) {
+		startKey = lastKey + "\x00"
+	}
+	endKey := fmt.Sprintf("%s.%020d", eventTimeIndex, expiry)
+
+	it, err := stub.GetStateByRange(startKey, endKey)
+	if err != nil {
+		return compaction, errors.New(fmt.Sprintf("unable to get state by range %s: %s", eventTimeIndex, err.Error()))
+	}
+	defer it.Close()
+
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			return compaction, errors.New(fmt.Sprintf("unable to get an element next to a query iterator: %s", err.Error()))
+		}
+
+		if compaction.Visited >= batchSize {
+			return compaction, nil
+		}
+		compaction.Visited++
+		compaction.LastKey = response.Key
+
+		event := Event{}
+		if err := event.FillFromCompositeKeyParts([]string{string(response.Value)}); err != nil {
+			return compaction, errors.New(fmt.Sprintf("cannot fill entry key of %s: %s", response.Key, err.Error()))
+		}
+		key, err := event.ToCompositeKey(stub)
+		if err != nil {
+			return compaction, err
+		}
+
+		if err := stub.DelState(key); err != nil {
+			return compaction, err
+		}
+		if err := stub.DelState(response.Key); err != nil {
+			return compaction, err
+		}
+		compaction.Deleted++
+	}
+
+	compaction.LastKey = ""
+	compaction.Completed = true
+
+	return compaction, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestCompactEventsAfterMigration(t *testing.T) {
+	stub := shim.NewMockStub(chaincodeName, new(SupplyChainChaincode))
+
+	// events persisted before the time index was introduced
+	expired := []string{"11111111-1111-4111-8111-111111111111", "21111111-1111-4111-8111-111111111111", "31111111-1111-4111-8111-111111111111"}
+	recent := "41111111-1111-4111-8111-111111111111"
+	for _, id := range expired {
+		putLegacy(t, stub, eventIndex, []string{id}, `{"timestamp":5,"priority":"normal","schemaversion":`+strconv.Itoa(eventSchemaVersion)+`}`)
+	}
+	putLegacy(t, stub, eventIndex, []string{recent},
+		`{"timestamp":`+strconv.FormatInt(time.Now().Unix()+1000, 10)+`,"priority":"normal","schemaversion":`+strconv.Itoa(eventSchemaVersion)+`}`)
+
+	migrate(t, stub, 2)
+
+	deleted, lastKey := 0, ""
+	for calls := 1; ; calls++ {
+		stub.MockTransactionStart("compact")
+		compaction, err := CompactEvents(stub, 100, 2, lastKey)
+		stub.MockTransactionEnd("compact")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if compaction.Visited != compaction.Deleted {
+			t.Errorf("compaction visited %d events and deleted %d", compaction.Visited, compaction.Deleted)
+		}
+		deleted += compaction.Deleted
+		lastKey = compaction.LastKey
+		if compaction.Completed {
+			break
+		}
+		if calls > len(expired) {
+			t.Fatal("compaction is not completed")
+		}
+	}
+	if deleted != len(expired) {
+		t.Errorf("%d events deleted, want %d", deleted, len(expired))
+	}
+
+	entries, err := getIndexEntries(stub, eventIndex, []string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].KeyParts[0] != recent {
+		t.Errorf("%d events left, want the recent one only", len(entries))
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"sort"
+	"strings"
+)
+
+// Formats of exportIot
+const (
+	exportFormatCSV   = "csv"
+	exportFormatJSONL = "jsonl"
+)
+
+// Columns every exported reading starts with
+var exportCommonColumns = []string{"sensor", "id", "device", "mspid", "enrollmentid", "fingerprint", "owner", "valid", "timestamp"}
+
+// Groups the values of readings of registered sensor types are stored in
+var readingValueGroups = []string{"measurements", "flags", "labels"}
+
+// exportBookmark points to the next reading of an export; it is passed to clients base64-encoded,
+// so that they do not depend on the position within the sensor types
+type exportBookmark struct {
+	Sensor   string `json:"sensor"`
+	Bookmark string `json:"bookmark"`
+}
+
+type ExportPage struct {
+	// CSV rows or JSON lines of the page; the CSV header is set on the first page only
+	Data                string `json:"data"`
+	FetchedRecordsCount int32  `json:"fetchedrecordscount"`
+	// empty when all readings are exported
+	Bookmark string `json:"bookmark"`
+}
+
+func ParseExportSensors(stub shim.ChaincodeStubInterface, sensorsString string) ([]string, error) {
+	sensors := []string{}
+	for _, sensor := range strings.Split(sensorsString, ",") {
+		sensor = strings.TrimSpace(sensor)
+		if sensor == "" {
+			continue
+		}
+		if _, err := GetIotSensorType(stub, sensor); err != nil {
+			return nil, err
+		}
+		sensors = append(sensors, sensor)
+	}
+
+	if len(sensors) == 0 {
+		return nil, errors.New("at least one sensor type must be set")
+	}
+
+	return sensors, nil
+}
+
+// ExportColumns returns the common columns followed by the value fields of the sensor types
+func ExportColumns(sensorTypes []iotSensorType) []string {
+	fields := map[string]bool{}
+	for _, sensorType := range sensorTypes {
+		for _, field := range sensorType.Fields {
+			fields[exportColumn(field)] = true
+		}
+	}
+
+	valueColumns := []string{}
+	for field := range fields {
+		valueColumns = append(valueColumns, field)
+	}
+	sort.Strings(valueColumns)
+
+	return append(append([]string{}, exportCommonColumns...), valueColumns...)
+}
+
+// exportColumn returns the column of a query field; values of registered sensor types are exported by field name
+func exportColumn(field string) string {
+	for _, group := range readingValueGroups {
+		field = strings.TrimPrefix(field, group+".")
+	}
+
+	return strings.TrimSuffix(field, ".value")
+}
+
+// ParseExportBookmark decodes the bookmark of the next page; it is nil for the first page
+func ParseExportBookmark(sensors []string, bookmarkString string) (*exportBookmark, error) {
+	if bookmarkString == "" {
+		return nil, nil
+	}
+
+	bookmarkBytes, err := base64.StdEncoding.DecodeString(bookmarkString)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("cannot decode bookmark: %s", err.Error()))
+	}
+	bookmark := &exportBookmark{}
+	if err := json.Unmarshal(bookmarkBytes, bookmark); err != nil {
+		return nil, errors.New(fmt.Sprintf("cannot unmarshaling bookmark: %s", err.Error()))
+	}
+
+	for _, sensor := range sensors {
+		if sensor == bookmark.Sensor {
+			return bookmark, nil
+		}
+	}
+
+	return nil, errors.New(fmt.Sprintf("bookmark of sensor type %s does not belong to the export", bookmark.Sensor))
+}
+
+// ExportIot reads up to pageSize readings of the sensor types, in the order of the types, and formats the ones
+// passing the filter. Only one page is loaded at a time, so the history is exported with as many calls as it takes
+func ExportIot(stub shim.ChaincodeStubInterface, sensors []string, format string, pageSize int32, start *exportBookmark,
+	filterEntry FilterFunction) (ExportPage, error) {
+	page := ExportPage{}
+
+	position := 0
+	bookmark := exportBookmark{Sensor: sensors[0]}
+	if start != nil {
+		bookmark = *start
+		for i, sensor := range sensors {
+			if sensor == bookmark.Sensor {
+				position = i
+			}
+		}
+	}
+
+	sensorTypes := []iotSensorType{}
+	for _, sensor := range sensors {
+		sensorType, err := GetIotSensorType(stub, sensor)
+		if err != nil {
+			return page, err
+		}
+		sensorTypes = append(sensorTypes, sensorType)
+	}
+
+	columns := ExportColumns(sensorTypes)
+	buffer := &bytes.Buffer{}
+	csvWriter := csv.NewWriter(buffer)
+	if format == exportFormatCSV && start == nil {
+		csvWriter.Write(columns)
+	}
+
+	for position < len(sensors) && page.FetchedRecordsCount < pageSize {
+		sensorType := sensorTypes[position]
+		requested := pageSize - page.FetchedRecordsCount
+
+		it, metadata, err := stub.GetStateByPartialCompositeKeyWithPagination(sensorType.Index, append([]string{}, sensorType.KeyParts...),
+			requested, bookmark.Bookmark)
+		if err != nil {
+			return page, errors.New(fmt.Sprintf("unable to get state by partial composite key %s: %s", sensorType.Index, err.Error()))
+		}
+		entries, err := queryImpl(it, sensorType.Create, stub, filterEntry)
+		it.Close()
+		if err != nil {
+			return page, err
+		}
+
+		for _, entry := range entries {
+			row, err := exportRow(sensors[position], entry)
+			if err != nil {
+				return page, err
+			}
+
+			if format == exportFormatCSV {
+				record := make([]string, len(columns))
+				for i, column := range columns {
+					record[i] = row[column]
+				}
+				csvWriter.Write(record)
+			} else {
+				line, err := json.Marshal(row)
+				if err != nil {
+					return page, err
+				}
+				buffer.Write(line)
+				buffer.WriteString("\n")
+			}
+		}
+		fetched := int32(0)
+		if metadata != nil {
+			fetched = metadata.FetchedRecordsCount
+		}
+		page.FetchedRecordsCount += fetched
+
+		// a short page means the sensor type is exported
+		if fetched < requested {
+			position++
+			if position < len(sensors) {
+				bookmark = exportBookmark{Sensor: sensors[position]}
+			}
+		} else {
+			bookmark.Bookmark = metadata.Bookmark
+		}
+	}
+
+	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		return page, err
+	}
+	page.Data = buffer.String()
+
+	if position < len(sensors) {
+		bookmarkBytes, err := json.Marshal(bookmark)
+		if err != nil {
+			return page, err
+		}
+		page.Bookmark = base64.StdEncoding.EncodeToString(bookmarkBytes)
+	}
+
+	return page, nil
+}
+
+// exportRow flattens a reading; measurements are written as exact decimals
+func exportRow(sensor string, entry LedgerData) (map[string]string, error) {
+	entryBytes, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	reading := struct {
+		Key   map[string]interface{} `json:"key"`
+		Value map[string]interface{} `json:"value"`
+	}{}
+	decoder := json.NewDecoder(bytes.NewReader(entryBytes))
+	decoder.UseNumber()
+	if err := decoder.Decode(&reading); err != nil {
+		return nil, err
+	}
+
+	row := map[string]string{"sensor": sensor, "id": fmt.Sprint(reading.Key["id"])}
+	for field, value := range reading.Value {
+		switch field {
+		case "customfield":
+			row["device"] = fmt.Sprint(value)
+		case "schemaversion":
+		case "measurements", "flags", "labels":
+			values, _ := value.(map[string]interface{})
+			for name, groupValue := range values {
+				if row[name], err = exportValue(name, groupValue); err != nil {
+					return nil, err
+				}
+			}
+		default:
+			if row[field], err = exportValue(field, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return row, nil
+}
+
+func exportValue(field string, value interface{}) (string, error) {
+	measurement, ok := value.(map[string]interface{})
+	if !ok {
+		return fmt.Sprint(value), nil
+	}
+
+	number, _ := measurement["value"].(json.Number)
+	scaled, err := number.Int64()
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("cannot export %s: %s", field, err.Error()))
+	}
+	scale, _ := measurement["scale"].(json.Number)
+	digits, err := scale.Int64()
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("cannot export %s: %s", field, err.Error()))
+	}
+
+	return Measurement{Value: scaled, Scale: int(digits)}.String(), nil
+}
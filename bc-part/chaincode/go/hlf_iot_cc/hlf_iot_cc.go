@@ -4,58 +4,107 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/core/chaincode/shim/ext/statebased"
 	pb "github.com/hyperledger/fabric/protos/peer"
+	"sort"
+	"strconv"
+	"time"
 )
 
 type SupplyChainChaincode struct {
 }
 
+//0							1							2								3								4							5							6
+//IdentitySource (optional)	ShockThreshold (optional)	CertificateApprovals (optional)	CertificateApprovers (optional)	CACertificates (optional)	EventRetention (optional)	UnpersistedEventSensors (optional)
 func (cc *SupplyChainChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
 	Logger.Debug("Init")
 
+	// config is set on instantiation or upgrade only, so that it is approved by channel admins
+	_, args := stub.GetFunctionAndParameters()
+	config, err := LoadConfig(stub)
+	if err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+	if len(args) > 0 && args[0] != "" {
+		if err := config.SetIdentitySource(args[0]); err != nil {
+			message := fmt.Sprintf("unable to set identity source: %s", err.Error())
+			Logger.Error(message)
+			return ErrorResponse(400, "identitySource", message)
+		}
+	}
+	if len(args) > 1 && args[1] != "" {
+		if err := config.SetShockThreshold(args[1]); err != nil {
+			message := fmt.Sprintf("unable to set shock threshold: %s", err.Error())
+			Logger.Error(message)
+			return ErrorResponse(400, "shockThreshold", message)
+		}
+	}
+	if len(args) > 2 && args[2] != "" {
+		approvers := ""
+		if len(args) > 3 {
+			approvers = args[3]
+		}
+		if err := config.SetCertificateApproval(args[2], approvers); err != nil {
+			message := fmt.Sprintf("unable to set certificate approval: %s", err.Error())
+			Logger.Error(message)
+			return ErrorResponse(400, "certificateApprovals", message)
+		}
+	}
+	if len(args) > 4 && args[4] != "" {
+		if err := config.SetCACertificates(args[4]); err != nil {
+			message := fmt.Sprintf("unable to set CA certificates: %s", err.Error())
+			Logger.Error(message)
+			return ErrorResponse(400, "caCertificates", message)
+		}
+	}
+	if len(args) > 5 && args[5] != "" {
+		sensors := ""
+		if len(args) > 6 {
+			sensors = args[6]
+		}
+		if err := config.SetEventPersistence(stub, args[5], sensors); err != nil {
+			message := fmt.Sprintf("unable to set event persistence: %s", err.Error())
+			Logger.Error(message)
+			return ErrorResponse(400, "eventRetention", message)
+		}
+	}
+
+	// stored once and in the current version, so the migration leaves the config alone
+	if err := UpdateOrInsertIn(stub, &config, configIndex, []string{""}, ""); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	// upgrading values stored by previous versions of the chaincode
+	migration, err := MigrateSchema(stub, schemaMigrationBatchSize)
+	if err != nil {
+		message := fmt.Sprintf("unable to migrate schema: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+	if !migration.Value.Completed {
+		Logger.Info(fmt.Sprintf("schema migration is incomplete: %d values migrated; invoke migrateSchema to continue", migration.Value.Migrated))
+	}
+
 	return shim.Success(nil)
 }
 
 func (cc *SupplyChainChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 	Logger.Debug("Invoke")
 
+	// functions are dispatched by the catalogue, which is returned by describe as well
 	function, args := stub.GetFunctionAndParameters()
-	if function == "addIotGps" {
-		return cc.addIotGps(stub, args)
-	} else if function == "listIotGps" {
-		return cc.listIotGps(stub, args)
-	} else if function == "addIotBarometer" {
-		return cc.addIotBarometer(stub, args)
-	} else if function == "listIotBarometer" {
-		return cc.listIotBarometer(stub, args)
-	} else if function == "addIotGyroscope" {
-		return cc.addIotGyroscope(stub, args)
-	} else if function == "listIotGyroscope" {
-		return cc.listIotGyroscope(stub, args)
-	} else if function == "addIotHumidity" {
-		return cc.addIotHumidity(stub, args)
-	} else if function == "listIotHumidity" {
-		return cc.listIotHumidity(stub, args)
-	} else if function == "addIotVibration" {
-		return cc.addIotVibration(stub, args)
-	} else if function == "listIotVibration" {
-		return cc.listIotVibration(stub, args)
-	} else if function == "addIotLight" {
-		return cc.addIotLight(stub, args)
-	} else if function == "listIotLight" {
-		return cc.listIotLight(stub, args)
-	} else if function == "addIotCertificate" {
-		return cc.addIotCertificate(stub, args)
-	} else if function == "checkIotCertificate" {
-		return cc.checkIotCertificate(stub, args)
-	}
-	// (optional) add other query functions
-
-	fnList := "{addIotGps, listIotGps, addIotBarometer, listIotBarometer, addIotGyroscope, listIotGyroscope, addIotHumidity, listIotHumidity, addIotVibration, listIotVibration, addIotLight, listIotLight, addIotCertificate, checkIotCertificate}"
-	message := fmt.Sprintf("invalid invoke function name: expected one of %s, got %s", fnList, function)
+	if description, ok := GetFunctionDescription(function); ok {
+		return description.handler(cc, stub, args)
+	}
+
+	message := fmt.Sprintf("invalid invoke function name: expected one of %s, got %s", FunctionList(), function)
 	Logger.Debug(message)
 
-	return pb.Response{Status: 400, Message: message}
+	return ErrorResponse(400, "function", message)
 }
 
 //0			1			2			3
@@ -69,7 +118,7 @@ func (cc *SupplyChainChaincode) addIotGps(stub shim.ChaincodeStubInterface, args
 	if err := gps.FillFromArguments(stub, args); err != nil {
 		message := fmt.Sprintf("cannot fill a gps data from arguments: %s", err.Error())
 		Logger.Error(message)
-		return shim.Error(message)
+		return ErrorResponse(FillErrorStatus(err), ErrorField(err), message)
 	}
 
 	//updating state in ledger
@@ -80,7 +129,27 @@ func (cc *SupplyChainChaincode) addIotGps(stub shim.ChaincodeStubInterface, args
 	if err := UpdateOrInsertIn(stub, &gps, iotGpsIndex, []string{""}, ""); err != nil {
 		message := fmt.Sprintf("persistence error: %s", err.Error())
 		Logger.Error(message)
-		return pb.Response{Status: 500, Message: message}
+		return ErrorResponse(500, "", message)
+	}
+
+	if err := UpdateLastSeen(stub, gps.Value.CustomField, "gps", gps.Value.Timestamp); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	if err := IndexCertificateUsage(stub, "gps", &gps); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	//checking geofences
+	geofenceEventValues, err := CheckGeofences(stub, gps.Value.CustomField, &gps)
+	if err != nil {
+		message := fmt.Sprintf("cannot check geofences: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
 	}
 
 	//emitting Event
@@ -93,11 +162,12 @@ func (cc *SupplyChainChaincode) addIotGps(stub shim.ChaincodeStubInterface, args
 	eventValue.Action = eventAddIotGps
 
 	events.Values = append(events.Values, eventValue)
+	events.Values = append(events.Values, geofenceEventValues...)
 
 	if err := events.EmitEvent(stub); err != nil {
-		message := fmt.Sprintf("Cannot emite event: %s", err.Error())
+		message := fmt.Sprintf("cannot emit event: %s", err.Error())
 		Logger.Error(message)
-		return pb.Response{Status: 500, Message: message}
+		return ErrorResponse(500, "", message)
 	}
 
 	Notifier(stub, NoticeSuccessType)
@@ -106,20 +176,41 @@ func (cc *SupplyChainChaincode) addIotGps(stub shim.ChaincodeStubInterface, args
 
 func (cc *SupplyChainChaincode) listIotGps(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	Notifier(stub, NoticeRuningType)
+
+	options, err := ParseListOptions(args)
+	if err != nil {
+		Logger.Error(err.Error())
+		return ErrorResponse(400, "options", err.Error())
+	}
+	options.Access, err = LoadDataAccess(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot load data access of the creator: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
 	gps := []Gps{}
-	gpsBytes, err := Query(stub, iotGpsIndex, []string{}, CreateGps, EmptyFilter)
+	gpsBytes, err := Query(stub, iotGpsIndex, []string{}, CreateGps, options.Filter)
 	if err != nil {
 		message := fmt.Sprintf("unable to perform method: %s", err.Error())
 		Logger.Error(message)
-		return shim.Error(message)
+		return ErrorResponse(500, "", message)
 	}
 	if err := json.Unmarshal(gpsBytes, &gps); err != nil {
 		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
 		Logger.Error(message)
-		return shim.Error(message)
+		return ErrorResponse(500, "", message)
 	}
 
 	resultBytes, err := json.Marshal(gps)
+	if options.Corrected {
+		resultBytes, err = CorrectReadings(stub, "gps", resultBytes)
+		if err != nil {
+			message := fmt.Sprintf("unable to correct readings: %s", err.Error())
+			Logger.Error(message)
+			return ErrorResponse(500, "", message)
+		}
+	}
 
 	Logger.Debug("Result: " + string(resultBytes))
 
@@ -138,7 +229,7 @@ func (cc *SupplyChainChaincode) addIotBarometer(stub shim.ChaincodeStubInterface
 	if err := barometer.FillFromArguments(stub, args); err != nil {
 		message := fmt.Sprintf("cannot fill a barometer data from arguments: %s", err.Error())
 		Logger.Error(message)
-		return shim.Error(message)
+		return ErrorResponse(FillErrorStatus(err), ErrorField(err), message)
 	}
 
 	//updating state in ledger
@@ -149,7 +240,19 @@ func (cc *SupplyChainChaincode) addIotBarometer(stub shim.ChaincodeStubInterface
 	if err := UpdateOrInsertIn(stub, &barometer, iotBarometerIndex, []string{""}, ""); err != nil {
 		message := fmt.Sprintf("persistence error: %s", err.Error())
 		Logger.Error(message)
-		return pb.Response{Status: 500, Message: message}
+		return ErrorResponse(500, "", message)
+	}
+
+	if err := UpdateLastSeen(stub, barometer.Value.CustomField, "barometer", barometer.Value.Timestamp); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	if err := IndexCertificateUsage(stub, "barometer", &barometer); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
 	}
 
 	//emitting Event
@@ -164,9 +267,9 @@ func (cc *SupplyChainChaincode) addIotBarometer(stub shim.ChaincodeStubInterface
 	events.Values = append(events.Values, eventValue)
 
 	if err := events.EmitEvent(stub); err != nil {
-		message := fmt.Sprintf("Cannot emite event: %s", err.Error())
+		message := fmt.Sprintf("cannot emit event: %s", err.Error())
 		Logger.Error(message)
-		return pb.Response{Status: 500, Message: message}
+		return ErrorResponse(500, "", message)
 	}
 
 	Notifier(stub, NoticeSuccessType)
@@ -175,20 +278,41 @@ func (cc *SupplyChainChaincode) addIotBarometer(stub shim.ChaincodeStubInterface
 
 func (cc *SupplyChainChaincode) listIotBarometer(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	Notifier(stub, NoticeRuningType)
+
+	options, err := ParseListOptions(args)
+	if err != nil {
+		Logger.Error(err.Error())
+		return ErrorResponse(400, "options", err.Error())
+	}
+	options.Access, err = LoadDataAccess(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot load data access of the creator: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
 	barometer := []Barometer{}
-	barometerBytes, err := Query(stub, iotBarometerIndex, []string{}, CreateBarometer, EmptyFilter)
+	barometerBytes, err := Query(stub, iotBarometerIndex, []string{}, CreateBarometer, options.Filter)
 	if err != nil {
 		message := fmt.Sprintf("unable to perform method: %s", err.Error())
 		Logger.Error(message)
-		return shim.Error(message)
+		return ErrorResponse(500, "", message)
 	}
 	if err := json.Unmarshal(barometerBytes, &barometer); err != nil {
 		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
 		Logger.Error(message)
-		return shim.Error(message)
+		return ErrorResponse(500, "", message)
 	}
 
 	resultBytes, err := json.Marshal(barometer)
+	if options.Corrected {
+		resultBytes, err = CorrectReadings(stub, "barometer", resultBytes)
+		if err != nil {
+			message := fmt.Sprintf("unable to correct readings: %s", err.Error())
+			Logger.Error(message)
+			return ErrorResponse(500, "", message)
+		}
+	}
 
 	Logger.Debug("Result: " + string(resultBytes))
 
@@ -207,7 +331,7 @@ func (cc *SupplyChainChaincode) addIotGyroscope(stub shim.ChaincodeStubInterface
 	if err := gyroscope.FillFromArguments(stub, args); err != nil {
 		message := fmt.Sprintf("cannot fill a gyroscope data from arguments: %s", err.Error())
 		Logger.Error(message)
-		return shim.Error(message)
+		return ErrorResponse(FillErrorStatus(err), ErrorField(err), message)
 	}
 
 	//updating state in ledger
@@ -218,7 +342,19 @@ func (cc *SupplyChainChaincode) addIotGyroscope(stub shim.ChaincodeStubInterface
 	if err := UpdateOrInsertIn(stub, &gyroscope, iotGyroscopeIndex, []string{""}, ""); err != nil {
 		message := fmt.Sprintf("persistence error: %s", err.Error())
 		Logger.Error(message)
-		return pb.Response{Status: 500, Message: message}
+		return ErrorResponse(500, "", message)
+	}
+
+	if err := UpdateLastSeen(stub, gyroscope.Value.CustomField, "gyroscope", gyroscope.Value.Timestamp); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	if err := IndexCertificateUsage(stub, "gyroscope", &gyroscope); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
 	}
 
 	//emitting Event
@@ -233,9 +369,9 @@ func (cc *SupplyChainChaincode) addIotGyroscope(stub shim.ChaincodeStubInterface
 	events.Values = append(events.Values, eventValue)
 
 	if err := events.EmitEvent(stub); err != nil {
-		message := fmt.Sprintf("Cannot emite event: %s", err.Error())
+		message := fmt.Sprintf("cannot emit event: %s", err.Error())
 		Logger.Error(message)
-		return pb.Response{Status: 500, Message: message}
+		return ErrorResponse(500, "", message)
 	}
 
 	Notifier(stub, NoticeSuccessType)
@@ -244,20 +380,88 @@ func (cc *SupplyChainChaincode) addIotGyroscope(stub shim.ChaincodeStubInterface
 
 func (cc *SupplyChainChaincode) listIotGyroscope(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	Notifier(stub, NoticeRuningType)
+
+	options, err := ParseListOptions(args)
+	if err != nil {
+		Logger.Error(err.Error())
+		return ErrorResponse(400, "options", err.Error())
+	}
+	options.Access, err = LoadDataAccess(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot load data access of the creator: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	gyroscope := []Gyroscope{}
+	gyroscopeBytes, err := Query(stub, iotGyroscopeIndex, []string{}, CreateGyroscope, options.Filter)
+	if err != nil {
+		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+	if err := json.Unmarshal(gyroscopeBytes, &gyroscope); err != nil {
+		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	resultBytes, err := json.Marshal(gyroscope)
+	if options.Corrected {
+		resultBytes, err = CorrectReadings(stub, "gyroscope", resultBytes)
+		if err != nil {
+			message := fmt.Sprintf("unable to correct readings: %s", err.Error())
+			Logger.Error(message)
+			return ErrorResponse(500, "", message)
+		}
+	}
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+// gyroscope readings with an acceleration above the shock threshold
+func (cc *SupplyChainChaincode) listIotShocks(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	options, err := ParseListOptions(args)
+	if err != nil {
+		Logger.Error(err.Error())
+		return ErrorResponse(400, "options", err.Error())
+	}
+	options.Access, err = LoadDataAccess(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot load data access of the creator: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
 	gyroscope := []Gyroscope{}
-	gyroscopeBytes, err := Query(stub, iotGyroscopeIndex, []string{}, CreateGyroscope, EmptyFilter)
+	gyroscopeBytes, err := Query(stub, iotGyroscopeIndex, []string{}, CreateGyroscope, func(data LedgerData) bool {
+		return data.(*Gyroscope).Value.Shock && options.Filter(data)
+	})
 	if err != nil {
 		message := fmt.Sprintf("unable to perform method: %s", err.Error())
 		Logger.Error(message)
-		return shim.Error(message)
+		return ErrorResponse(500, "", message)
 	}
 	if err := json.Unmarshal(gyroscopeBytes, &gyroscope); err != nil {
 		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
 		Logger.Error(message)
-		return shim.Error(message)
+		return ErrorResponse(500, "", message)
 	}
 
 	resultBytes, err := json.Marshal(gyroscope)
+	if options.Corrected {
+		resultBytes, err = CorrectReadings(stub, "gyroscope", resultBytes)
+		if err != nil {
+			message := fmt.Sprintf("unable to correct readings: %s", err.Error())
+			Logger.Error(message)
+			return ErrorResponse(500, "", message)
+		}
+	}
 
 	Logger.Debug("Result: " + string(resultBytes))
 
@@ -276,7 +480,7 @@ func (cc *SupplyChainChaincode) addIotHumidity(stub shim.ChaincodeStubInterface,
 	if err := humidity.FillFromArguments(stub, args); err != nil {
 		message := fmt.Sprintf("cannot fill a humidity data from arguments: %s", err.Error())
 		Logger.Error(message)
-		return shim.Error(message)
+		return ErrorResponse(FillErrorStatus(err), ErrorField(err), message)
 	}
 
 	//updating state in ledger
@@ -287,7 +491,19 @@ func (cc *SupplyChainChaincode) addIotHumidity(stub shim.ChaincodeStubInterface,
 	if err := UpdateOrInsertIn(stub, &humidity, iotHumidityIndex, []string{""}, ""); err != nil {
 		message := fmt.Sprintf("persistence error: %s", err.Error())
 		Logger.Error(message)
-		return pb.Response{Status: 500, Message: message}
+		return ErrorResponse(500, "", message)
+	}
+
+	if err := UpdateLastSeen(stub, humidity.Value.CustomField, "humidity", humidity.Value.Timestamp); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	if err := IndexCertificateUsage(stub, "humidity", &humidity); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
 	}
 
 	//emitting Event
@@ -302,9 +518,9 @@ func (cc *SupplyChainChaincode) addIotHumidity(stub shim.ChaincodeStubInterface,
 	events.Values = append(events.Values, eventValue)
 
 	if err := events.EmitEvent(stub); err != nil {
-		message := fmt.Sprintf("Cannot emite event: %s", err.Error())
+		message := fmt.Sprintf("cannot emit event: %s", err.Error())
 		Logger.Error(message)
-		return pb.Response{Status: 500, Message: message}
+		return ErrorResponse(500, "", message)
 	}
 
 	Notifier(stub, NoticeSuccessType)
@@ -313,20 +529,41 @@ func (cc *SupplyChainChaincode) addIotHumidity(stub shim.ChaincodeStubInterface,
 
 func (cc *SupplyChainChaincode) listIotHumidity(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	Notifier(stub, NoticeRuningType)
+
+	options, err := ParseListOptions(args)
+	if err != nil {
+		Logger.Error(err.Error())
+		return ErrorResponse(400, "options", err.Error())
+	}
+	options.Access, err = LoadDataAccess(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot load data access of the creator: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
 	humidity := []Humidity{}
-	humidityBytes, err := Query(stub, iotHumidityIndex, []string{}, CreateHumidity, EmptyFilter)
+	humidityBytes, err := Query(stub, iotHumidityIndex, []string{}, CreateHumidity, options.Filter)
 	if err != nil {
 		message := fmt.Sprintf("unable to perform method: %s", err.Error())
 		Logger.Error(message)
-		return shim.Error(message)
+		return ErrorResponse(500, "", message)
 	}
 	if err := json.Unmarshal(humidityBytes, &humidity); err != nil {
 		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
 		Logger.Error(message)
-		return shim.Error(message)
+		return ErrorResponse(500, "", message)
 	}
 
 	resultBytes, err := json.Marshal(humidity)
+	if options.Corrected {
+		resultBytes, err = CorrectReadings(stub, "humidity", resultBytes)
+		if err != nil {
+			message := fmt.Sprintf("unable to correct readings: %s", err.Error())
+			Logger.Error(message)
+			return ErrorResponse(500, "", message)
+		}
+	}
 
 	Logger.Debug("Result: " + string(resultBytes))
 
@@ -345,7 +582,7 @@ func (cc *SupplyChainChaincode) addIotVibration(stub shim.ChaincodeStubInterface
 	if err := vibration.FillFromArguments(stub, args); err != nil {
 		message := fmt.Sprintf("cannot fill a vibration data from arguments: %s", err.Error())
 		Logger.Error(message)
-		return shim.Error(message)
+		return ErrorResponse(FillErrorStatus(err), ErrorField(err), message)
 	}
 
 	//updating state in ledger
@@ -356,7 +593,25 @@ func (cc *SupplyChainChaincode) addIotVibration(stub shim.ChaincodeStubInterface
 	if err := UpdateOrInsertIn(stub, &vibration, iotVibrationIndex, []string{""}, ""); err != nil {
 		message := fmt.Sprintf("persistence error: %s", err.Error())
 		Logger.Error(message)
-		return pb.Response{Status: 500, Message: message}
+		return ErrorResponse(500, "", message)
+	}
+
+	if err := UpdateLastSeen(stub, vibration.Value.CustomField, "vibration", vibration.Value.Timestamp); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	if err := IndexCertificateUsage(stub, "vibration", &vibration); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	if err := IndexVibration(stub, &vibration); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
 	}
 
 	//emitting Event
@@ -371,9 +626,9 @@ func (cc *SupplyChainChaincode) addIotVibration(stub shim.ChaincodeStubInterface
 	events.Values = append(events.Values, eventValue)
 
 	if err := events.EmitEvent(stub); err != nil {
-		message := fmt.Sprintf("Cannot emite event: %s", err.Error())
+		message := fmt.Sprintf("cannot emit event: %s", err.Error())
 		Logger.Error(message)
-		return pb.Response{Status: 500, Message: message}
+		return ErrorResponse(500, "", message)
 	}
 
 	Notifier(stub, NoticeSuccessType)
@@ -382,17 +637,30 @@ func (cc *SupplyChainChaincode) addIotVibration(stub shim.ChaincodeStubInterface
 
 func (cc *SupplyChainChaincode) listIotVibration(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	Notifier(stub, NoticeRuningType)
+
+	options, err := ParseListOptions(args)
+	if err != nil {
+		Logger.Error(err.Error())
+		return ErrorResponse(400, "options", err.Error())
+	}
+	options.Access, err = LoadDataAccess(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot load data access of the creator: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
 	vibration := []Vibration{}
-	vibrationBytes, err := Query(stub, iotVibrationIndex, []string{}, CreateVibration, EmptyFilter)
+	vibrationBytes, err := Query(stub, iotVibrationIndex, []string{}, CreateVibration, options.Filter)
 	if err != nil {
 		message := fmt.Sprintf("unable to perform method: %s", err.Error())
 		Logger.Error(message)
-		return shim.Error(message)
+		return ErrorResponse(500, "", message)
 	}
 	if err := json.Unmarshal(vibrationBytes, &vibration); err != nil {
 		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
 		Logger.Error(message)
-		return shim.Error(message)
+		return ErrorResponse(500, "", message)
 	}
 
 	resultBytes, err := json.Marshal(vibration)
@@ -414,7 +682,7 @@ func (cc *SupplyChainChaincode) addIotLight(stub shim.ChaincodeStubInterface, ar
 	if err := light.FillFromArguments(stub, args); err != nil {
 		message := fmt.Sprintf("cannot fill a light data from arguments: %s", err.Error())
 		Logger.Error(message)
-		return shim.Error(message)
+		return ErrorResponse(FillErrorStatus(err), ErrorField(err), message)
 	}
 
 	//updating state in ledger
@@ -425,7 +693,27 @@ func (cc *SupplyChainChaincode) addIotLight(stub shim.ChaincodeStubInterface, ar
 	if err := UpdateOrInsertIn(stub, &light, iotLightIndex, []string{""}, ""); err != nil {
 		message := fmt.Sprintf("persistence error: %s", err.Error())
 		Logger.Error(message)
-		return pb.Response{Status: 500, Message: message}
+		return ErrorResponse(500, "", message)
+	}
+
+	if err := UpdateLastSeen(stub, light.Value.CustomField, "light", light.Value.Timestamp); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	if err := IndexCertificateUsage(stub, "light", &light); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	//checking tamper rules
+	tamperEventValues, err := CheckTamper(stub, light.Value.CustomField, &light)
+	if err != nil {
+		message := fmt.Sprintf("cannot check tamper rules: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
 	}
 
 	//emitting Event
@@ -438,11 +726,12 @@ func (cc *SupplyChainChaincode) addIotLight(stub shim.ChaincodeStubInterface, ar
 	eventValue.Action = eventAddIotLight
 
 	events.Values = append(events.Values, eventValue)
+	events.Values = append(events.Values, tamperEventValues...)
 
 	if err := events.EmitEvent(stub); err != nil {
-		message := fmt.Sprintf("Cannot emite event: %s", err.Error())
+		message := fmt.Sprintf("cannot emit event: %s", err.Error())
 		Logger.Error(message)
-		return pb.Response{Status: 500, Message: message}
+		return ErrorResponse(500, "", message)
 	}
 
 	Notifier(stub, NoticeSuccessType)
@@ -451,17 +740,30 @@ func (cc *SupplyChainChaincode) addIotLight(stub shim.ChaincodeStubInterface, ar
 
 func (cc *SupplyChainChaincode) listIotLight(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	Notifier(stub, NoticeRuningType)
+
+	options, err := ParseListOptions(args)
+	if err != nil {
+		Logger.Error(err.Error())
+		return ErrorResponse(400, "options", err.Error())
+	}
+	options.Access, err = LoadDataAccess(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot load data access of the creator: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
 	light := []Light{}
-	lightBytes, err := Query(stub, iotLightIndex, []string{}, CreateLight, EmptyFilter)
+	lightBytes, err := Query(stub, iotLightIndex, []string{}, CreateLight, options.Filter)
 	if err != nil {
 		message := fmt.Sprintf("unable to perform method: %s", err.Error())
 		Logger.Error(message)
-		return shim.Error(message)
+		return ErrorResponse(500, "", message)
 	}
 	if err := json.Unmarshal(lightBytes, &light); err != nil {
 		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
 		Logger.Error(message)
-		return shim.Error(message)
+		return ErrorResponse(500, "", message)
 	}
 
 	resultBytes, err := json.Marshal(light)
@@ -472,82 +774,2646 @@ func (cc *SupplyChainChaincode) listIotLight(stub shim.ChaincodeStubInterface, a
 	return shim.Success(resultBytes)
 }
 
-//0
-//Certificate
-func (cc *SupplyChainChaincode) addIotCertificate(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+//0		1
+//Name	Fields
+func (cc *SupplyChainChaincode) registerSensorType(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 
 	Notifier(stub, NoticeRuningType)
 
+	//checking creator
+	if admin, err := IsNetworkAdmin(stub); err != nil {
+		message := fmt.Sprintf("cannot check creator's role: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	} else if !admin {
+		message := fmt.Sprintf("sensor types can be registered by identities of the certificate approvers with the %s attribute only", attributeAdmin)
+		Logger.Error(message)
+		return ErrorResponse(403, "", message)
+	}
+
 	//filling from arguments
-	certificate := Certificate{}
-	if err := certificate.FillFromArguments(stub, args); err != nil {
-		message := fmt.Sprintf("cannot fill a certificate data from arguments: %s", err.Error())
+	sensorType := SensorType{}
+	if err := sensorType.FillFromArguments(stub, args); err != nil {
+		message := fmt.Sprintf("cannot fill a sensor type from arguments: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(FillErrorStatus(err), ErrorField(err), message)
+	}
+
+	// readings are validated against the fields they were stored with, so a sensor type cannot be changed
+	if ExistsIn(stub, &sensorType, sensorTypeIndex) {
+		message := fmt.Sprintf("sensor type %s is already registered", sensorType.Key.Name)
+		Logger.Error(message)
+		return ErrorResponse(409, "", message)
+	}
+
+	mspid, err := GetMSPID(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's MSP ID: %s", err.Error())
 		Logger.Error(message)
-		return shim.Error(message)
+		return ErrorResponse(500, "", message)
 	}
+	sensorType.Value.RegisteredBy = mspid
 
 	//updating state in ledger
-	if bytes, err := json.Marshal(certificate); err == nil {
-		Logger.Debug("certificate: " + string(bytes))
+	if bytes, err := json.Marshal(sensorType); err == nil {
+		Logger.Debug("sensor type: " + string(bytes))
 	}
 
-	if err := UpdateOrInsertIn(stub, &certificate, iotCertificateIndex, []string{""}, ""); err != nil {
+	if err := UpdateOrInsertIn(stub, &sensorType, sensorTypeIndex, []string{""}, ""); err != nil {
 		message := fmt.Sprintf("persistence error: %s", err.Error())
 		Logger.Error(message)
-		return pb.Response{Status: 500, Message: message}
+		return ErrorResponse(500, "", message)
 	}
 
 	//emitting Event
 	events := Events{}
 
 	eventValue := EventValue{}
-	eventValue.EntityType = iotCertificateIndex
-	eventValue.EntityID = certificate.Key.ID
-	eventValue.Other = certificate.Value
-	eventValue.Action = eventAddIotCertificate
+	eventValue.EntityType = sensorTypeIndex
+	eventValue.EntityID = sensorType.Key.Name
+	eventValue.Other = sensorType.Value
+	eventValue.Action = eventRegisterSensorType
 
 	events.Values = append(events.Values, eventValue)
 
 	if err := events.EmitEvent(stub); err != nil {
-		message := fmt.Sprintf("Cannot emite event: %s", err.Error())
+		message := fmt.Sprintf("cannot emit event: %s", err.Error())
 		Logger.Error(message)
-		return pb.Response{Status: 500, Message: message}
+		return ErrorResponse(500, "", message)
 	}
 
 	Notifier(stub, NoticeSuccessType)
 	return shim.Success(nil)
 }
 
-//0
-//Certificate
-func (cc *SupplyChainChaincode) checkIotCertificate(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+func (cc *SupplyChainChaincode) listSensorTypes(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	resultBytes, err := Query(stub, sensorTypeIndex, []string{}, CreateSensorType, EmptyFilter)
+	if err != nil {
+		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+//0				1		2
+//SensorType	Values	Timestamp
+func (cc *SupplyChainChaincode) addIotReading(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
 	Notifier(stub, NoticeRuningType)
 
 	//filling from arguments
-	certificate := Certificate{}
-	if err := certificate.FillFromArguments(stub, args); err != nil {
-		message := fmt.Sprintf("cannot fill a certificate data from arguments: %s", err.Error())
+	reading := Reading{}
+	if err := reading.FillFromArguments(stub, args); err != nil {
+		message := fmt.Sprintf("cannot fill a reading from arguments: %s", err.Error())
 		Logger.Error(message)
-		return shim.Error(message)
+		return ErrorResponse(FillErrorStatus(err), ErrorField(err), message)
 	}
 
-	//check is certificate valid
-	valid, err := CheckCertificate(stub, certificate.Value.Certificate)
+	//updating state in ledger
+	if bytes, err := json.Marshal(reading); err == nil {
+		Logger.Debug("reading: " + string(bytes))
+	}
+
+	if err := UpdateOrInsertIn(stub, &reading, iotReadingIndex, []string{""}, ""); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	if err := UpdateLastSeen(stub, reading.Value.CustomField, reading.Key.SensorType, reading.Value.Timestamp); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	if err := IndexCertificateUsage(stub, reading.Key.SensorType, &reading); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	//emitting Event
+	events := Events{}
+
+	eventValue := EventValue{}
+	eventValue.EntityType = iotReadingIndex
+	eventValue.Sensor = reading.Key.SensorType
+	eventValue.EntityID = reading.Key.ID
+	eventValue.Other = reading
+	eventValue.Action = eventAddIotReading
+
+	events.Values = append(events.Values, eventValue)
+
+	if err := events.EmitEvent(stub); err != nil {
+		message := fmt.Sprintf("cannot emit event: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success([]byte(reading.Key.ID))
+}
+
+//0				1
+//SensorType	Options (optional)
+func (cc *SupplyChainChaincode) listIotReading(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	if len(args) < 1 {
+		message := fmt.Sprintf("arguments array must contain at least %d items", 1)
+		Logger.Error(message)
+		return ErrorResponse(400, "", message)
+	}
+
+	if _, err := GetSensorType(stub, args[0]); err != nil {
+		Logger.Error(err.Error())
+		return ErrorResponse(404, "sensorType", err.Error())
+	}
+
+	options, err := ParseListOptions(args[1:])
 	if err != nil {
-		message := fmt.Sprintf("cannot check the certificate: %s", err.Error())
+		Logger.Error(err.Error())
+		return ErrorResponse(400, "options", err.Error())
+	}
+	options.Access, err = LoadDataAccess(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot load data access of the creator: %s", err.Error())
 		Logger.Error(message)
-		return shim.Error(message)
+		return ErrorResponse(500, "", message)
 	}
 
-	result, err := json.Marshal(valid)
+	resultBytes, err := Query(stub, iotReadingIndex, []string{args[0]}, CreateReading, options.Filter)
 	if err != nil {
-		return shim.Error(err.Error())
+		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
 	}
 
-	Logger.Debug("Result: " + string(result))
+	Logger.Debug("Result: " + string(resultBytes))
 
 	Notifier(stub, NoticeSuccessType)
-	return shim.Success(result)
+	return shim.Success(resultBytes)
+}
+
+//0
+//Readings
+func (cc *SupplyChainChaincode) addIotBatch(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	Notifier(stub, NoticeRuningType)
+
+	if len(args) < 1 {
+		message := fmt.Sprintf("arguments array must contain at least %d items", 1)
+		Logger.Error(message)
+		return ErrorResponse(400, "", message)
+	}
+
+	//filling from arguments
+	batch, err := ParseBatch(stub, args[0])
+	if err != nil {
+		message := fmt.Sprintf("cannot fill a batch from arguments: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponseWithDetails(FillErrorStatus(err), "readings", message, batch.Results)
+	}
+
+	//updating state in ledger
+	ruleEventValues, err := batch.Store(stub)
+	if err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	//emitting Event
+	events := Events{}
+
+	// one event per sensor type, so that the persistence of the events of the sensor type applies
+	for _, group := range batch.GroupBySensor() {
+		eventValue := EventValue{}
+		eventValue.EntityType = group.Index
+		eventValue.Sensor = group.Sensor
+		eventValue.EntityID = stub.GetTxID()
+		eventValue.Other = group.Readings
+		eventValue.Action = eventAddIotBatch
+
+		events.Values = append(events.Values, eventValue)
+	}
+	events.Values = append(events.Values, ruleEventValues...)
+
+	if err := events.EmitEvent(stub); err != nil {
+		message := fmt.Sprintf("cannot emit event: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	resultBytes, err := json.Marshal(batch.Results)
+	if err != nil {
+		return ErrorResponse(500, "", err.Error())
+	}
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+//0
+//Certificate
+func (cc *SupplyChainChaincode) addIotCertificate(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	Notifier(stub, NoticeRuningType)
+
+	//checking creator
+	if admin, err := IsAdmin(stub); err != nil {
+		message := fmt.Sprintf("cannot check creator's role: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	} else if !admin {
+		message := fmt.Sprintf("certificates can be registered by identities with the %s attribute only", attributeAdmin)
+		Logger.Error(message)
+		return ErrorResponse(403, "", message)
+	}
+
+	//filling from arguments
+	certificate := Certificate{}
+	if err := certificate.FillFromArguments(stub, args); err != nil {
+		message := fmt.Sprintf("cannot fill a certificate data from arguments: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(FillErrorStatus(err), ErrorField(err), message)
+	}
+
+	approvals, _, err := GetCertificateApproval(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot load config: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	proposer, err := GetMSPID(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's MSP ID: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	// the chain is checked within the validity period, expiry is reported by checkIotCertificate
+	caCertificates, err := GetCACertificates(stub, proposer)
+	if err != nil {
+		message := fmt.Sprintf("cannot load config: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+	if err := certificate.VerifyChain(caCertificates, time.Unix(certificate.Value.NotBefore, 0)); err != nil {
+		message := fmt.Sprintf("cannot register the certificate: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(400, "certificate", message)
+	}
+
+	//getting transaction Timestamp
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		message := fmt.Sprintf("unable to get transaction timestamp: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	certificate.Value.ProposedBy = proposer
+	certificate.Value.RequiredApprovals = approvals
+	certificate.Value.Approvals = []CertificateApproval{}
+	certificate.Value.Timestamp = timestamp.Seconds
+	if approvals == 0 {
+		certificate.Value.State = CertificateStateActive
+	} else {
+		certificate.Value.State = CertificateStateProposed
+	}
+
+	//updating state in ledger
+	if bytes, err := json.Marshal(certificate); err == nil {
+		Logger.Debug("certificate: " + string(bytes))
+	}
+
+	if err := UpdateOrInsertIn(stub, &certificate, iotCertificateIndex, []string{""}, ""); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+	if err := IndexCertificateDevice(stub, &certificate); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	//emitting Event
+	events := Events{}
+
+	eventValue := EventValue{}
+	eventValue.EntityType = iotCertificateIndex
+	eventValue.EntityID = certificate.Key.ID
+	eventValue.Other = certificate.Value
+	eventValue.Action = eventAddIotCertificate
+
+	events.Values = append(events.Values, eventValue)
+
+	if err := events.EmitEvent(stub); err != nil {
+		message := fmt.Sprintf("cannot emit event: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success([]byte(certificate.Key.ID))
+}
+
+//0
+//ID
+func (cc *SupplyChainChaincode) approveIotCertificate(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	//checking creator
+	if admin, err := IsAdmin(stub); err != nil {
+		message := fmt.Sprintf("cannot check creator's role: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	} else if !admin {
+		message := fmt.Sprintf("certificates can be approved by identities with the %s attribute only", attributeAdmin)
+		Logger.Error(message)
+		return ErrorResponse(403, "", message)
+	}
+
+	submitter, err := GetSubmitter(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's identity: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	_, approvers, err := GetCertificateApproval(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot load config: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+	approver := false
+	for _, mspid := range approvers {
+		if mspid == submitter.MSPID {
+			approver = true
+		}
+	}
+	if !approver {
+		message := fmt.Sprintf("%s is not one of the certificate approvers %v", submitter.MSPID, approvers)
+		Logger.Error(message)
+		return ErrorResponse(403, "", message)
+	}
+
+	certificate := Certificate{}
+	if err := certificate.FillFromCompositeKeyParts(args); err != nil {
+		message := fmt.Sprintf("cannot fill a certificate key from arguments: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(400, "id", message)
+	}
+
+	if !ExistsIn(stub, &certificate, iotCertificateIndex) {
+		message := fmt.Sprintf("certificate with ID %s not found", certificate.Key.ID)
+		Logger.Error(message)
+		return ErrorResponse(404, "", message)
+	}
+
+	if err := LoadFrom(stub, &certificate, iotCertificateIndex); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	//getting transaction Timestamp
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		message := fmt.Sprintf("unable to get transaction timestamp: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	approval := CertificateApproval{MSPID: submitter.MSPID, EnrollmentID: submitter.EnrollmentID, Timestamp: timestamp.Seconds}
+	if err := certificate.Approve(approval); err != nil {
+		message := fmt.Sprintf("cannot approve the certificate: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(409, "", message)
+	}
+
+	//updating state in ledger
+	if err := UpdateOrInsertIn(stub, &certificate, iotCertificateIndex, []string{""}, ""); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	//emitting Event
+	events := Events{}
+
+	eventValue := EventValue{}
+	eventValue.EntityType = iotCertificateIndex
+	eventValue.EntityID = certificate.Key.ID
+	eventValue.Other = certificate.Value
+	eventValue.Action = eventApproveIotCertificate
+
+	events.Values = append(events.Values, eventValue)
+
+	if err := events.EmitEvent(stub); err != nil {
+		message := fmt.Sprintf("cannot emit event: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(nil)
+}
+
+//0
+//Certificate
+func (cc *SupplyChainChaincode) checkIotCertificate(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	//filling from arguments
+	certificate := Certificate{}
+	if err := certificate.FillFromArguments(stub, args); err != nil {
+		message := fmt.Sprintf("cannot fill a certificate data from arguments: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(FillErrorStatus(err), ErrorField(err), message)
+	}
+
+	//check is certificate valid
+	status, err := CheckCertificateStatus(stub, certificate.Value.Certificate)
+	if err != nil {
+		message := fmt.Sprintf("cannot check the certificate: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	check := CertificateCheck{Status: status}
+	if status == CertificateStatusValid {
+		check.Valid = 1
+	}
+
+	result, err := json.Marshal(check)
+	if err != nil {
+		return ErrorResponse(500, "", err.Error())
+	}
+
+	Logger.Debug("Result: " + string(result))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(result)
+}
+
+//0					1					2
+//Options (optional)	PageSize (optional)	Bookmark (optional)
+func (cc *SupplyChainChaincode) listIotCertificates(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	optionsString := ""
+	if len(args) > 0 {
+		optionsString = args[0]
+	}
+	options, err := ParseCertificateListOptions(optionsString)
+	if err != nil {
+		Logger.Error(err.Error())
+		return ErrorResponse(400, "options", err.Error())
+	}
+
+	pageSize := int64(queryDefaultPageSize)
+	if len(args) > 1 && args[1] != "" {
+		pageSize, err = strconv.ParseInt(args[1], 10, 32)
+		if err != nil {
+			message := fmt.Sprintf("unable to parse the page size: %s", err.Error())
+			Logger.Error(message)
+			return ErrorResponse(400, "pageSize", message)
+		}
+		if pageSize <= 0 || pageSize > queryMaxPageSize {
+			message := fmt.Sprintf("page size must be between 1 and %d", queryMaxPageSize)
+			Logger.Error(message)
+			return ErrorResponse(400, "pageSize", message)
+		}
+	}
+
+	bookmark := ""
+	if len(args) > 2 {
+		bookmark = args[2]
+	}
+
+	checker, err := LoadCertificateChecker(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot load certificate checker: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	page, err := QueryWithPagination(stub, iotCertificateIndex, []string{}, int32(pageSize), bookmark, CreateCertificate, options.Filter(checker))
+	if err != nil {
+		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	result := CertificatePage{[]CertificateDetails{}, page.FetchedRecordsCount, page.Bookmark}
+	for _, record := range page.Records {
+		result.Records = append(result.Records, checker.Details(record.(*Certificate)))
+	}
+
+	resultBytes, err := json.Marshal(result)
+	if err != nil {
+		return ErrorResponse(500, "", err.Error())
+	}
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+//0
+//ID
+func (cc *SupplyChainChaincode) getIotCertificate(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	certificate := Certificate{}
+	if err := certificate.FillFromCompositeKeyParts(args); err != nil {
+		message := fmt.Sprintf("cannot fill a certificate key from arguments: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(400, "id", message)
+	}
+
+	if !ExistsIn(stub, &certificate, iotCertificateIndex) {
+		message := fmt.Sprintf("certificate with ID %s not found", certificate.Key.ID)
+		Logger.Error(message)
+		return ErrorResponse(404, "", message)
+	}
+
+	if err := LoadFrom(stub, &certificate, iotCertificateIndex); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	checker, err := LoadCertificateChecker(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot load certificate checker: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	access, err := LoadDataAccess(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot load access grants: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	details := checker.Details(&certificate)
+	if err := details.LoadUsage(stub, access); err != nil {
+		message := fmt.Sprintf("cannot load readings of the certificate: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	resultBytes, err := json.Marshal(details)
+	if err != nil {
+		return ErrorResponse(500, "", err.Error())
+	}
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+//0		1	2			3
+//From	To	SampleCount	MerkleRoot
+func (cc *SupplyChainChaincode) addIotAnchor(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	Notifier(stub, NoticeRuningType)
+
+	//filling from arguments
+	anchor := Anchor{}
+	if err := anchor.FillFromArguments(stub, args); err != nil {
+		message := fmt.Sprintf("cannot fill an anchor data from arguments: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(FillErrorStatus(err), ErrorField(err), message)
+	}
+
+	//updating state in ledger
+	if bytes, err := json.Marshal(anchor); err == nil {
+		Logger.Debug("anchor: " + string(bytes))
+	}
+
+	if err := UpdateOrInsertIn(stub, &anchor, iotAnchorIndex, []string{""}, ""); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	if err := UpdateLastSeen(stub, anchor.Value.DeviceID, lastSeenAnchor, anchor.Value.To); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	//emitting Event
+	events := Events{}
+
+	eventValue := EventValue{}
+	eventValue.EntityType = iotAnchorIndex
+	eventValue.EntityID = anchor.Key.ID
+	eventValue.Other = anchor.Value
+	eventValue.Action = eventAddIotAnchor
+
+	events.Values = append(events.Values, eventValue)
+
+	if err := events.EmitEvent(stub); err != nil {
+		message := fmt.Sprintf("cannot emit event: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(nil)
+}
+
+//0			1		2
+//AnchorID	Sample	Proof
+func (cc *SupplyChainChaincode) verifyIotSample(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	if len(args) < 3 {
+		message := fmt.Sprintf("arguments array must contain at least %d items", 3)
+		Logger.Error(message)
+		return ErrorResponse(400, "", message)
+	}
+
+	//loading anchor
+	anchor := Anchor{}
+	if err := anchor.FillFromCompositeKeyParts(args[:1]); err != nil {
+		message := fmt.Sprintf("cannot fill an anchor key from arguments: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(400, "anchorID", message)
+	}
+
+	if !ExistsIn(stub, &anchor, iotAnchorIndex) {
+		message := fmt.Sprintf("anchor with ID %s not found", anchor.Key.ID)
+		Logger.Error(message)
+		return ErrorResponse(404, "", message)
+	}
+
+	if err := LoadFrom(stub, &anchor, iotAnchorIndex); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	//checking sample against the anchor
+	if args[1] == "" {
+		message := fmt.Sprintf("sample must be not empty")
+		Logger.Error(message)
+		return ErrorResponse(400, "sample", message)
+	}
+
+	proof, err := ParseMerkleProof(args[2])
+	if err != nil {
+		message := fmt.Sprintf("cannot parse the proof: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(400, "proof", message)
+	}
+
+	var valid byte
+	verified, err := VerifyMerkleProof([]byte(args[1]), proof, anchor.Value.MerkleRoot)
+	if err != nil {
+		message := fmt.Sprintf("cannot verify the sample: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(400, "proof", message)
+	}
+	if verified {
+		valid = 1
+	}
+
+	result, err := json.Marshal(valid)
+	if err != nil {
+		return ErrorResponse(500, "", err.Error())
+	}
+
+	Logger.Debug("Result: " + string(result))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(result)
+}
+
+//0
+//DeviceID
+func (cc *SupplyChainChaincode) registerDevice(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	//checking creator
+	if admin, err := IsAdmin(stub); err != nil {
+		message := fmt.Sprintf("cannot check creator's role: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	} else if !admin {
+		message := fmt.Sprintf("devices can be registered by identities with the %s attribute only", attributeAdmin)
+		Logger.Error(message)
+		return ErrorResponse(403, "", message)
+	}
+
+	//filling from arguments
+	device := Device{}
+	if err := device.FillFromArguments(stub, args); err != nil {
+		message := fmt.Sprintf("cannot fill a device from arguments: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(FillErrorStatus(err), ErrorField(err), message)
+	}
+
+	// the owner approves access to the data of the device, so it is never changed
+	if ExistsIn(stub, &device, deviceIndex) {
+		message := fmt.Sprintf("device %s is already registered", device.Key.DeviceID)
+		Logger.Error(message)
+		return ErrorResponse(409, "", message)
+	}
+
+	submitter, err := GetSubmitter(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's identity: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	// any admin could claim a device otherwise
+	if enrolled, err := HasActiveCertificate(stub, device.Key.DeviceID, submitter.MSPID); err != nil {
+		message := fmt.Sprintf("cannot check certificates of device %s: %s", device.Key.DeviceID, err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	} else if !enrolled {
+		message := fmt.Sprintf("device %s can be registered by the MSP which proposed its active certificate only", device.Key.DeviceID)
+		Logger.Error(message)
+		return ErrorResponse(403, "", message)
+	}
+
+	device.Value.Owner = submitter.MSPID
+	device.Value.RegisteredBy = submitter.EnrollmentID
+
+	//getting transaction Timestamp
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		message := fmt.Sprintf("unable to get transaction timestamp: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+	device.Value.Timestamp = timestamp.Seconds
+
+	//updating state in ledger
+	if err := UpdateOrInsertIn(stub, &device, deviceIndex, []string{""}, ""); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	//emitting Event
+	events := Events{}
+
+	eventValue := EventValue{}
+	eventValue.EntityType = deviceIndex
+	eventValue.EntityID = device.Key.DeviceID
+	eventValue.Other = device.Value
+	eventValue.Action = eventRegisterDevice
+
+	events.Values = append(events.Values, eventValue)
+
+	if err := events.EmitEvent(stub); err != nil {
+		message := fmt.Sprintf("cannot emit event: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(nil)
+}
+
+//0
+//Timestamp
+func (cc *SupplyChainChaincode) heartbeat(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	Notifier(stub, NoticeRuningType)
+
+	//filling from arguments
+	lastSeen := DeviceLastSeen{}
+	if err := lastSeen.FillFromArguments(stub, args); err != nil {
+		message := fmt.Sprintf("cannot fill a heartbeat data from arguments: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(FillErrorStatus(err), ErrorField(err), message)
+	}
+
+	// heartbeats are frequent, so they are not emitted as events
+	if err := UpdateLastSeen(stub, lastSeen.Key.DeviceID, lastSeen.Key.Sensor, lastSeen.Value.ReadingTimestamp); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(nil)
+}
+
+//0
+//MaxSilence (seconds)
+func (cc *SupplyChainChaincode) listStaleDevices(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	if len(args) < 1 || args[0] == "" {
+		message := "max silence must be not empty"
+		Logger.Error(message)
+		return ErrorResponse(400, "maxSilence", message)
+	}
+	maxSilence, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		message := fmt.Sprintf("unable to parse the max silence: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(400, "maxSilence", message)
+	}
+	if maxSilence < 0 {
+		message := "max silence must be larger than zero"
+		Logger.Error(message)
+		return ErrorResponse(400, "maxSilence", message)
+	}
+
+	//getting transaction Timestamp
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		message := fmt.Sprintf("unable to get transaction timestamp: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	staleDevices, err := FindStaleDevices(stub, maxSilence, timestamp.Seconds)
+	if err != nil {
+		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	resultBytes, err := json.Marshal(staleDevices)
+	if err != nil {
+		return ErrorResponse(500, "", err.Error())
+	}
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+//0			1
+//DeviceID	Configuration
+func (cc *SupplyChainChaincode) setDesiredConfiguration(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	//filling from arguments
+	desired := DeviceTwin{}
+	if err := desired.FillFromArguments(stub, args); err != nil {
+		message := fmt.Sprintf("cannot fill a device twin data from arguments: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(FillErrorStatus(err), ErrorField(err), message)
+	}
+
+	twin := DeviceTwin{Key: desired.Key}
+	if ExistsIn(stub, &twin, deviceTwinIndex) {
+		if err := LoadFrom(stub, &twin, deviceTwinIndex); err != nil {
+			message := fmt.Sprintf("persistence error: %s", err.Error())
+			Logger.Error(message)
+			return ErrorResponse(500, "", message)
+		}
+	}
+
+	//checking creator
+	if allowed, err := CanManageDevice(stub, twin.Key.DeviceID); err != nil {
+		message := fmt.Sprintf("cannot check the owner of device %s: %s", twin.Key.DeviceID, err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	} else if !allowed {
+		message := fmt.Sprintf("desired configuration of device %s can be set by the device owner or identities with the %s attribute only", twin.Key.DeviceID, attributeAdmin)
+		Logger.Error(message)
+		return ErrorResponse(403, "", message)
+	}
+
+	creator, err := GetMSPID(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's MSP ID: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	//getting transaction Timestamp
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		message := fmt.Sprintf("unable to get transaction timestamp: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	twin.Value.Desired = desired.Value.Desired
+	twin.Value.DesiredVersion++
+	twin.Value.DesiredBy = creator
+	twin.Value.DesiredTimestamp = timestamp.Seconds
+
+	//updating state in ledger
+	if err := UpdateOrInsertIn(stub, &twin, deviceTwinIndex, []string{""}, ""); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	//emitting Event
+	events := Events{}
+
+	eventValue := EventValue{}
+	eventValue.EntityType = deviceTwinIndex
+	eventValue.EntityID = twin.Key.DeviceID
+	eventValue.Other = twin.Value
+	eventValue.Action = eventSetDesiredConfiguration
+
+	events.Values = append(events.Values, eventValue)
+
+	if err := events.EmitEvent(stub); err != nil {
+		message := fmt.Sprintf("cannot emit event: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	result, err := json.Marshal(twin)
+	if err != nil {
+		return ErrorResponse(500, "", err.Error())
+	}
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(result)
+}
+
+//0			1
+//Version	Configuration
+func (cc *SupplyChainChaincode) reportConfiguration(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	deviceID, err := GetDeviceID(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's device ID from the certificate: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(403, "", message)
+	}
+
+	twin := DeviceTwin{}
+	if err := twin.FillFromCompositeKeyParts([]string{deviceID}); err != nil {
+		message := fmt.Sprintf("cannot fill a device twin key: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(400, "", message)
+	}
+
+	if ExistsIn(stub, &twin, deviceTwinIndex) {
+		if err := LoadFrom(stub, &twin, deviceTwinIndex); err != nil {
+			message := fmt.Sprintf("persistence error: %s", err.Error())
+			Logger.Error(message)
+			return ErrorResponse(500, "", message)
+		}
+	}
+
+	if err := twin.FillReportedFromArguments(stub, args); err != nil {
+		message := fmt.Sprintf("cannot fill a reported configuration from arguments: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(FillErrorStatus(err), ErrorField(err), message)
+	}
+
+	//getting transaction Timestamp
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		message := fmt.Sprintf("unable to get transaction timestamp: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+	twin.Value.ReportedTimestamp = timestamp.Seconds
+
+	//updating state in ledger
+	if err := UpdateOrInsertIn(stub, &twin, deviceTwinIndex, []string{""}, ""); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	//emitting Event
+	events := Events{}
+
+	eventValue := EventValue{}
+	eventValue.EntityType = deviceTwinIndex
+	eventValue.EntityID = twin.Key.DeviceID
+	eventValue.Other = twin.Value
+	eventValue.Action = eventReportConfiguration
+
+	events.Values = append(events.Values, eventValue)
+
+	if err := events.EmitEvent(stub); err != nil {
+		message := fmt.Sprintf("cannot emit event: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(nil)
+}
+
+//0
+//DeviceID
+func (cc *SupplyChainChaincode) getDeviceTwin(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	twin := DeviceTwin{}
+	if err := twin.FillFromCompositeKeyParts(args); err != nil {
+		message := fmt.Sprintf("cannot fill a device twin key from arguments: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(400, "deviceID", message)
+	}
+
+	if !ExistsIn(stub, &twin, deviceTwinIndex) {
+		message := fmt.Sprintf("device twin of %s not found", twin.Key.DeviceID)
+		Logger.Error(message)
+		return ErrorResponse(404, "", message)
+	}
+
+	if err := LoadFrom(stub, &twin, deviceTwinIndex); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	resultBytes, err := json.Marshal(twin)
+	if err != nil {
+		return ErrorResponse(500, "", err.Error())
+	}
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+//0			1		2
+//DeviceID	Command	Parameters (optional)
+func (cc *SupplyChainChaincode) issueCommand(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	//filling from arguments
+	command := DeviceCommand{}
+	if err := command.FillFromArguments(stub, args); err != nil {
+		message := fmt.Sprintf("cannot fill a device command from arguments: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(FillErrorStatus(err), ErrorField(err), message)
+	}
+
+	//checking creator
+	if allowed, err := CanManageDevice(stub, command.Key.DeviceID); err != nil {
+		message := fmt.Sprintf("cannot check the owner of device %s: %s", command.Key.DeviceID, err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	} else if !allowed {
+		message := fmt.Sprintf("commands to device %s can be issued by the device owner or identities with the %s attribute only", command.Key.DeviceID, attributeAdmin)
+		Logger.Error(message)
+		return ErrorResponse(403, "", message)
+	}
+
+	creator, err := GetMSPID(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's MSP ID: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+	command.Value.IssuedBy = creator
+
+	//updating state in ledger
+	if err := UpdateOrInsertIn(stub, &command, deviceCommandIndex, []string{""}, ""); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	//emitting Event
+	events := Events{}
+
+	eventValue := EventValue{}
+	eventValue.EntityType = deviceCommandIndex
+	eventValue.EntityID = command.Key.ID
+	eventValue.Other = command
+	eventValue.Action = eventIssueCommand
+
+	events.Values = append(events.Values, eventValue)
+
+	if err := events.EmitEvent(stub); err != nil {
+		message := fmt.Sprintf("cannot emit event: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	result, err := json.Marshal(command)
+	if err != nil {
+		return ErrorResponse(500, "", err.Error())
+	}
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(result)
+}
+
+//0
+//DeviceID
+func (cc *SupplyChainChaincode) listPendingCommands(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	if len(args) < 1 || args[0] == "" {
+		message := "device ID must be not empty"
+		Logger.Error(message)
+		return ErrorResponse(400, "deviceID", message)
+	}
+
+	commands := []DeviceCommand{}
+	commandsBytes, err := Query(stub, deviceCommandIndex, []string{args[0]}, CreateDeviceCommand, func(data LedgerData) bool {
+		return data.(*DeviceCommand).IsPending()
+	})
+	if err != nil {
+		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+	if err := json.Unmarshal(commandsBytes, &commands); err != nil {
+		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	// devices execute commands in the order they were issued
+	sort.SliceStable(commands, func(i, j int) bool {
+		return commands[i].Value.IssueTimestamp < commands[j].Value.IssueTimestamp
+	})
+
+	resultBytes, err := json.Marshal(commands)
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+//0
+//DeviceID (optional)
+func (cc *SupplyChainChaincode) listCommands(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	partialKey := []string{}
+	if len(args) > 0 && args[0] != "" {
+		partialKey = append(partialKey, args[0])
+	}
+
+	commands := []DeviceCommand{}
+	commandsBytes, err := Query(stub, deviceCommandIndex, partialKey, CreateDeviceCommand, EmptyFilter)
+	if err != nil {
+		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+	if err := json.Unmarshal(commandsBytes, &commands); err != nil {
+		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	resultBytes, err := json.Marshal(commands)
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+//0		1		2
+//ID	State	Result
+func (cc *SupplyChainChaincode) acknowledgeCommand(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	if len(args) < 3 {
+		message := fmt.Sprintf("arguments array must contain at least %d items", 3)
+		Logger.Error(message)
+		return ErrorResponse(400, "", message)
+	}
+
+	deviceID, err := GetDeviceID(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's device ID from the certificate: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(403, "", message)
+	}
+
+	// commands are looked up under the creator's device ID, so devices can acknowledge their own commands only
+	command := DeviceCommand{}
+	if err := command.FillFromCompositeKeyParts([]string{deviceID, args[0]}); err != nil {
+		message := fmt.Sprintf("cannot fill a device command key from arguments: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(400, "id", message)
+	}
+
+	newState, err := strconv.Atoi(args[1])
+	if err != nil {
+		message := fmt.Sprintf("unable to parse the state: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(400, "state", message)
+	}
+
+	if !ExistsIn(stub, &command, deviceCommandIndex) {
+		message := fmt.Sprintf("command with ID %s for device %s not found", command.Key.ID, command.Key.DeviceID)
+		Logger.Error(message)
+		return ErrorResponse(404, "", message)
+	}
+
+	if err := LoadFrom(stub, &command, deviceCommandIndex); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	//checking state
+	if !CheckStateValidity(commandStatesAutomaton, command.Value.State, newState) {
+		message := fmt.Sprintf("command state cannot be changed from %d to %d", command.Value.State, newState)
+		Logger.Error(message)
+		return ErrorResponse(409, "", message)
+	}
+
+	//getting transaction Timestamp
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		message := fmt.Sprintf("unable to get transaction timestamp: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	command.Value.State = newState
+	command.Value.Result = args[2]
+	command.Value.Timestamp = timestamp.Seconds
+
+	//updating state in ledger
+	if err := UpdateOrInsertIn(stub, &command, deviceCommandIndex, []string{""}, ""); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	//emitting Event
+	events := Events{}
+
+	eventValue := EventValue{}
+	eventValue.EntityType = deviceCommandIndex
+	eventValue.EntityID = command.Key.ID
+	eventValue.Other = command
+	eventValue.Action = eventAcknowledgeCommand
+	if newState == CommandStateFailed {
+		eventValue.Priority = EventPriorityHigh
+	}
+
+	events.Values = append(events.Values, eventValue)
+
+	if err := events.EmitEvent(stub); err != nil {
+		message := fmt.Sprintf("cannot emit event: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(nil)
+}
+
+//0			1		2	3
+//DeviceID	From	To	Purpose (optional)
+func (cc *SupplyChainChaincode) requestDataAccess(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	//filling from arguments
+	grant := AccessGrant{}
+	if err := grant.FillFromArguments(stub, args); err != nil {
+		message := fmt.Sprintf("cannot fill an access grant data from arguments: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(FillErrorStatus(err), ErrorField(err), message)
+	}
+
+	owner, err := GetDeviceOwner(stub, grant.Key.DeviceID)
+	if err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+	if owner == "" {
+		message := fmt.Sprintf("device %s is not registered", grant.Key.DeviceID)
+		Logger.Error(message)
+		return ErrorResponse(404, "", message)
+	}
+
+	//checking creator
+	creator, err := GetMSPID(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's MSP ID: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+	if creator == owner {
+		message := fmt.Sprintf("device %s already belongs to %s", grant.Key.DeviceID, creator)
+		Logger.Error(message)
+		return ErrorResponse(409, "", message)
+	}
+
+	grant.Value.Grantee = creator
+	grant.Value.Owner = owner
+	grant.Value.UpdatedBy = creator
+
+	//updating state in ledger
+	if err := UpdateOrInsertIn(stub, &grant, accessGrantIndex, []string{""}, ""); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	//emitting Event
+	events := Events{}
+
+	eventValue := EventValue{}
+	eventValue.EntityType = accessGrantIndex
+	eventValue.EntityID = grant.Key.ID
+	eventValue.Other = grant
+	eventValue.Action = eventRequestDataAccess
+
+	events.Values = append(events.Values, eventValue)
+
+	if err := events.EmitEvent(stub); err != nil {
+		message := fmt.Sprintf("cannot emit event: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	result, err := json.Marshal(grant)
+	if err != nil {
+		return ErrorResponse(500, "", err.Error())
+	}
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(result)
+}
+
+//0			1
+//DeviceID	ID
+func (cc *SupplyChainChaincode) approveDataAccess(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return cc.updateAccessGrantState(stub, args, AccessGrantStateApproved, eventApproveDataAccess)
+}
+
+//0			1
+//DeviceID	ID
+func (cc *SupplyChainChaincode) revokeDataAccess(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return cc.updateAccessGrantState(stub, args, AccessGrantStateRevoked, eventRevokeDataAccess)
+}
+
+// grants are approved by the owner of the device only; requests may be withdrawn by the grantee as well
+func (cc *SupplyChainChaincode) updateAccessGrantState(stub shim.ChaincodeStubInterface, args []string, newState int, action string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	grant := AccessGrant{}
+	if err := grant.FillFromCompositeKeyParts(args); err != nil {
+		message := fmt.Sprintf("cannot fill an access grant key from arguments: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(400, "", message)
+	}
+
+	if !ExistsIn(stub, &grant, accessGrantIndex) {
+		message := fmt.Sprintf("access grant with ID %s for device %s not found", grant.Key.ID, grant.Key.DeviceID)
+		Logger.Error(message)
+		return ErrorResponse(404, "", message)
+	}
+
+	if err := LoadFrom(stub, &grant, accessGrantIndex); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	//checking creator
+	creator, err := GetMSPID(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's MSP ID: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+	if creator != grant.Value.Owner && (newState == AccessGrantStateApproved || creator != grant.Value.Grantee) {
+		message := fmt.Sprintf("access grant state %d can be set by %s only", newState, grant.Value.Owner)
+		Logger.Error(message)
+		return ErrorResponse(403, "", message)
+	}
+
+	//checking state
+	if !CheckStateValidity(accessGrantStatesAutomaton, grant.Value.State, newState) {
+		message := fmt.Sprintf("access grant state cannot be changed from %d to %d", grant.Value.State, newState)
+		Logger.Error(message)
+		return ErrorResponse(409, "", message)
+	}
+
+	//getting transaction Timestamp
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		message := fmt.Sprintf("unable to get transaction timestamp: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	grant.Value.State = newState
+	grant.Value.UpdatedBy = creator
+	grant.Value.Timestamp = timestamp.Seconds
+
+	//updating state in ledger
+	if err := UpdateOrInsertIn(stub, &grant, accessGrantIndex, []string{""}, ""); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	//emitting Event
+	events := Events{}
+
+	eventValue := EventValue{}
+	eventValue.EntityType = accessGrantIndex
+	eventValue.EntityID = grant.Key.ID
+	eventValue.Other = grant
+	eventValue.Action = action
+
+	events.Values = append(events.Values, eventValue)
+
+	if err := events.EmitEvent(stub); err != nil {
+		message := fmt.Sprintf("cannot emit event: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(nil)
+}
+
+//0
+//DeviceID (optional)
+func (cc *SupplyChainChaincode) listAccessGrants(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	partialKey := []string{}
+	if len(args) > 0 && args[0] != "" {
+		partialKey = append(partialKey, args[0])
+	}
+
+	creator, err := GetMSPID(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's MSP ID: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	// grants are seen by the two parties only
+	grants := []AccessGrant{}
+	grantsBytes, err := Query(stub, accessGrantIndex, partialKey, CreateAccessGrant, func(data LedgerData) bool {
+		grant := data.(*AccessGrant)
+		return grant.Value.Owner == creator || grant.Value.Grantee == creator
+	})
+	if err != nil {
+		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+	if err := json.Unmarshal(grantsBytes, &grants); err != nil {
+		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	resultBytes, err := json.Marshal(grants)
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+//0			1		2		3		4		5			6
+//DeviceID	Sensor	Field	Offset	Scale	ValidFrom	Certificate
+func (cc *SupplyChainChaincode) addCalibration(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	//filling from arguments
+	calibration := Calibration{}
+	if err := calibration.FillFromArguments(stub, args); err != nil {
+		message := fmt.Sprintf("cannot fill a calibration from arguments: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(FillErrorStatus(err), ErrorField(err), message)
+	}
+
+	//checking creator
+	if allowed, err := CanManageDevice(stub, calibration.Key.DeviceID); err != nil {
+		message := fmt.Sprintf("cannot check the owner of device %s: %s", calibration.Key.DeviceID, err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	} else if !allowed {
+		message := fmt.Sprintf("calibrations of device %s can be added by the device owner or identities with the %s attribute only", calibration.Key.DeviceID, attributeAdmin)
+		Logger.Error(message)
+		return ErrorResponse(403, "", message)
+	}
+
+	//updating state in ledger
+	if bytes, err := json.Marshal(calibration); err == nil {
+		Logger.Debug("Calibration: " + string(bytes))
+	}
+
+	if err := UpdateOrInsertIn(stub, &calibration, iotCalibrationIndex, []string{""}, ""); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	//emitting Event
+	events := Events{}
+
+	eventValue := EventValue{}
+	eventValue.EntityType = iotCalibrationIndex
+	eventValue.EntityID = calibration.Key.ID
+	eventValue.Other = calibration
+	eventValue.Action = eventAddCalibration
+
+	events.Values = append(events.Values, eventValue)
+
+	if err := events.EmitEvent(stub); err != nil {
+		message := fmt.Sprintf("cannot emit event: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	resultBytes, err := json.Marshal(calibration)
+	if err != nil {
+		return ErrorResponse(500, "", err.Error())
+	}
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+//0			1		2
+//DeviceID	Sensor	Field
+func (cc *SupplyChainChaincode) listCalibrations(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	// partial key must not contain gaps
+	partialKey := []string{}
+	for _, arg := range args {
+		if arg == "" || len(partialKey) == iotCalibrationKeyFieldsNumber-1 {
+			break
+		}
+		partialKey = append(partialKey, arg)
+	}
+
+	calibrations := []Calibration{}
+	calibrationsBytes, err := Query(stub, iotCalibrationIndex, partialKey, CreateCalibration, EmptyFilter)
+	if err != nil {
+		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+	if err := json.Unmarshal(calibrationsBytes, &calibrations); err != nil {
+		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	resultBytes, err := json.Marshal(calibrations)
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+//0		1		2		3		4
+//Name	Type	Points	Radius	DeviceIDs
+func (cc *SupplyChainChaincode) addGeofence(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	Notifier(stub, NoticeRuningType)
+
+	//filling from arguments
+	geofence := Geofence{}
+	if err := geofence.FillFromArguments(stub, args); err != nil {
+		message := fmt.Sprintf("cannot fill a geofence data from arguments: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(FillErrorStatus(err), ErrorField(err), message)
+	}
+
+	//checking creator
+	for _, deviceID := range geofence.Value.DeviceIDs {
+		if allowed, err := CanManageDevice(stub, deviceID); err != nil {
+			message := fmt.Sprintf("cannot check the owner of device %s: %s", deviceID, err.Error())
+			Logger.Error(message)
+			return ErrorResponse(500, "", message)
+		} else if !allowed {
+			message := fmt.Sprintf("geofences of device %s can be added by the device owner or identities with the %s attribute only", deviceID, attributeAdmin)
+			Logger.Error(message)
+			return ErrorResponse(403, "", message)
+		}
+	}
+
+	creator, err := GetMSPID(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's MSP ID: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+	geofence.Value.Creator = creator
+
+	//updating state in ledger
+	if bytes, err := json.Marshal(geofence); err == nil {
+		Logger.Debug("geofence: " + string(bytes))
+	}
+
+	if err := UpdateOrInsertIn(stub, &geofence, iotGeofenceIndex, []string{""}, ""); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	//emitting Event
+	events := Events{}
+
+	eventValue := EventValue{}
+	eventValue.EntityType = iotGeofenceIndex
+	eventValue.EntityID = geofence.Key.ID
+	eventValue.Other = geofence.Value
+	eventValue.Action = eventAddGeofence
+
+	events.Values = append(events.Values, eventValue)
+
+	if err := events.EmitEvent(stub); err != nil {
+		message := fmt.Sprintf("cannot emit event: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	result, err := json.Marshal(geofence)
+	if err != nil {
+		return ErrorResponse(500, "", err.Error())
+	}
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(result)
+}
+
+//0
+//DeviceID (optional)
+func (cc *SupplyChainChaincode) listGeofences(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	filter := EmptyFilter
+	if len(args) > 0 && args[0] != "" {
+		deviceID := args[0]
+		filter = func(data LedgerData) bool {
+			return data.(*Geofence).IsAssignedTo(deviceID)
+		}
+	}
+
+	geofences := []Geofence{}
+	geofencesBytes, err := Query(stub, iotGeofenceIndex, []string{}, CreateGeofence, filter)
+	if err != nil {
+		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+	if err := json.Unmarshal(geofencesBytes, &geofences); err != nil {
+		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	resultBytes, err := json.Marshal(geofences)
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+//0
+//ID
+func (cc *SupplyChainChaincode) deleteGeofence(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	geofence := Geofence{}
+	if err := geofence.FillFromCompositeKeyParts(args); err != nil {
+		message := fmt.Sprintf("cannot fill a geofence key from arguments: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(400, "id", message)
+	}
+
+	if !ExistsIn(stub, &geofence, iotGeofenceIndex) {
+		message := fmt.Sprintf("geofence with ID %s not found", geofence.Key.ID)
+		Logger.Error(message)
+		return ErrorResponse(404, "", message)
+	}
+
+	if err := LoadFrom(stub, &geofence, iotGeofenceIndex); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	//checking creator
+	admin, err := IsNetworkAdmin(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot check creator's role: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+	if !admin {
+		creator, err := GetMSPID(stub)
+		if err != nil {
+			message := fmt.Sprintf("cannot obtain creator's MSP ID: %s", err.Error())
+			Logger.Error(message)
+			return ErrorResponse(500, "", message)
+		}
+		if geofence.Value.Creator == "" || creator != geofence.Value.Creator {
+			message := fmt.Sprintf("geofence %s can be deleted by its creator or identities of the certificate approvers with the %s attribute only", geofence.Key.ID, attributeAdmin)
+			Logger.Error(message)
+			return ErrorResponse(403, "", message)
+		}
+		for _, deviceID := range geofence.Value.DeviceIDs {
+			if allowed, err := CanManageDevice(stub, deviceID); err != nil {
+				message := fmt.Sprintf("cannot check the owner of device %s: %s", deviceID, err.Error())
+				Logger.Error(message)
+				return ErrorResponse(500, "", message)
+			} else if !allowed {
+				message := fmt.Sprintf("geofences of device %s can be deleted by the device owner or identities with the %s attribute only", deviceID, attributeAdmin)
+				Logger.Error(message)
+				return ErrorResponse(403, "", message)
+			}
+		}
+	}
+
+	if err := DeleteFrom(stub, &geofence, iotGeofenceIndex); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	//emitting Event
+	events := Events{}
+
+	eventValue := EventValue{}
+	eventValue.EntityType = iotGeofenceIndex
+	eventValue.EntityID = geofence.Key.ID
+	eventValue.Other = geofence.Value
+	eventValue.Action = eventDeleteGeofence
+
+	events.Values = append(events.Values, eventValue)
+
+	if err := events.EmitEvent(stub); err != nil {
+		message := fmt.Sprintf("cannot emit event: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(nil)
+}
+
+//0					1
+//DeviceID (optional)	GeofenceID (optional)
+func (cc *SupplyChainChaincode) listGeofenceTransitions(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	// partial key must not contain gaps
+	partialKey := []string{}
+	for _, arg := range args {
+		if arg == "" || len(partialKey) == iotGeofenceTransitionKeyFieldsNumber-1 {
+			break
+		}
+		partialKey = append(partialKey, arg)
+	}
+
+	access, err := LoadDataAccess(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot load data access of the creator: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	transitions := []GeofenceTransition{}
+	transitionsBytes, err := Query(stub, iotGeofenceTransitionIndex, partialKey, CreateGeofenceTransition, access.FilterGeofenceTransition)
+	if err != nil {
+		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+	if err := json.Unmarshal(transitionsBytes, &transitions); err != nil {
+		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	resultBytes, err := json.Marshal(transitions)
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+//0						1
+//ShipmentID (optional)	DeviceID (optional)
+func (cc *SupplyChainChaincode) listTamperIncidents(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	// partial key must not contain gaps
+	partialKey := []string{}
+	for _, arg := range args {
+		if arg == "" || len(partialKey) == tamperIncidentKeyFieldsNumber-1 {
+			break
+		}
+		partialKey = append(partialKey, arg)
+	}
+
+	incidents := []TamperIncident{}
+	incidentsBytes, err := Query(stub, tamperIncidentIndex, partialKey, CreateTamperIncident, EmptyFilter)
+	if err != nil {
+		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+	if err := json.Unmarshal(incidentsBytes, &incidents); err != nil {
+		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	resultBytes, err := json.Marshal(incidents)
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+//0		1			2		3		4			5			6
+//ID	Supplier	Buyer	Origin	Destination	DeviceIDs	Conditions
+func (cc *SupplyChainChaincode) addShipment(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	Notifier(stub, NoticeRuningType)
+
+	//filling from arguments
+	shipment := Shipment{}
+	if err := shipment.FillFromArguments(stub, args); err != nil {
+		message := fmt.Sprintf("cannot fill a shipment data from arguments: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(FillErrorStatus(err), ErrorField(err), message)
+	}
+
+	if ExistsIn(stub, &shipment, shipmentIndex) {
+		message := fmt.Sprintf("shipment with ID %s already exists", shipment.Key.ID)
+		Logger.Error(message)
+		return ErrorResponse(409, "", message)
+	}
+
+	//checking creator
+	creator, err := GetMSPID(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's MSP ID: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+	if creator != shipment.Value.Supplier {
+		message := fmt.Sprintf("shipment can be created by the supplier %s only", shipment.Value.Supplier)
+		Logger.Error(message)
+		return ErrorResponse(403, "", message)
+	}
+
+	//updating state in ledger
+	if bytes, err := json.Marshal(shipment); err == nil {
+		Logger.Debug("shipment: " + string(bytes))
+	}
+
+	if err := UpdateOrInsertIn(stub, &shipment, shipmentIndex, []string{""}, ""); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+	if err := IndexShipmentDevices(stub, &shipment); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	//emitting Event
+	events := Events{}
+
+	eventValue := EventValue{}
+	eventValue.EntityType = shipmentIndex
+	eventValue.EntityID = shipment.Key.ID
+	eventValue.Other = shipment.Value
+	eventValue.Action = eventAddShipment
+
+	events.Values = append(events.Values, eventValue)
+
+	if err := events.EmitEvent(stub); err != nil {
+		message := fmt.Sprintf("cannot emit event: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(nil)
+}
+
+//0
+//ID
+func (cc *SupplyChainChaincode) getShipment(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	shipment := Shipment{}
+	if err := shipment.FillFromCompositeKeyParts(args); err != nil {
+		message := fmt.Sprintf("cannot fill a shipment key from arguments: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(400, "id", message)
+	}
+
+	if !ExistsIn(stub, &shipment, shipmentIndex) {
+		message := fmt.Sprintf("shipment with ID %s not found", shipment.Key.ID)
+		Logger.Error(message)
+		return ErrorResponse(404, "", message)
+	}
+
+	if err := LoadFrom(stub, &shipment, shipmentIndex); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	resultBytes, err := json.Marshal(shipment)
+	if err != nil {
+		return ErrorResponse(500, "", err.Error())
+	}
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+func (cc *SupplyChainChaincode) listShipments(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+	shipments := []Shipment{}
+	shipmentsBytes, err := Query(stub, shipmentIndex, []string{}, CreateShipment, EmptyFilter)
+	if err != nil {
+		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+	if err := json.Unmarshal(shipmentsBytes, &shipments); err != nil {
+		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	resultBytes, err := json.Marshal(shipments)
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+//0		1
+//ID	State
+func (cc *SupplyChainChaincode) updateShipmentState(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	if len(args) < 2 {
+		message := fmt.Sprintf("arguments array must contain at least %d items", 2)
+		Logger.Error(message)
+		return ErrorResponse(400, "", message)
+	}
+
+	shipment := Shipment{}
+	if err := shipment.FillFromCompositeKeyParts(args); err != nil {
+		message := fmt.Sprintf("cannot fill a shipment key from arguments: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(400, "id", message)
+	}
+
+	newState, err := strconv.Atoi(args[1])
+	if err != nil {
+		message := fmt.Sprintf("unable to parse the state: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(400, "state", message)
+	}
+
+	if !ExistsIn(stub, &shipment, shipmentIndex) {
+		message := fmt.Sprintf("shipment with ID %s not found", shipment.Key.ID)
+		Logger.Error(message)
+		return ErrorResponse(404, "", message)
+	}
+
+	if err := LoadFrom(stub, &shipment, shipmentIndex); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	//checking state
+	if !CheckStateValidity(shipmentStatesAutomaton, shipment.Value.State, newState) {
+		message := fmt.Sprintf("shipment state cannot be changed from %d to %d", shipment.Value.State, newState)
+		Logger.Error(message)
+		return ErrorResponse(409, "", message)
+	}
+
+	//checking creator
+	creator, err := GetMSPID(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's MSP ID: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	allowed := shipment.Value.Custodian
+	if newState == ShipmentStateAccepted || newState == ShipmentStateDisputed {
+		allowed = shipment.Value.Buyer
+	}
+	if creator != allowed {
+		message := fmt.Sprintf("shipment state %d can be set by %s only", newState, allowed)
+		Logger.Error(message)
+		return ErrorResponse(403, "", message)
+	}
+
+	//getting transaction Timestamp
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		message := fmt.Sprintf("unable to get transaction timestamp: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	shipment.Value.State = newState
+	shipment.Value.Timestamp = timestamp.Seconds
+	if newState == ShipmentStateInTransit {
+		shipment.Value.DepartureTimestamp = timestamp.Seconds
+	} else if newState == ShipmentStateDelivered {
+		shipment.Value.DeliveryTimestamp = timestamp.Seconds
+	}
+
+	//updating state in ledger
+	if err := UpdateOrInsertIn(stub, &shipment, shipmentIndex, []string{""}, ""); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	//emitting Event
+	events := Events{}
+
+	eventValue := EventValue{}
+	eventValue.EntityType = shipmentIndex
+	eventValue.EntityID = shipment.Key.ID
+	eventValue.Other = shipment.Value
+	eventValue.Action = eventUpdateShipmentState
+
+	events.Values = append(events.Values, eventValue)
+
+	if err := events.EmitEvent(stub); err != nil {
+		message := fmt.Sprintf("cannot emit event: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(nil)
+}
+
+// The current custodian proposes the transfer. The shipment key gets an endorsement policy
+// requiring both parties, so the transfer completes only when the counterparty accepts it
+//0		1
+//ID	NewCustodian
+func (cc *SupplyChainChaincode) transferShipmentCustody(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	if len(args) < 2 {
+		message := fmt.Sprintf("arguments array must contain at least %d items", 2)
+		Logger.Error(message)
+		return ErrorResponse(400, "", message)
+	}
+
+	shipment := Shipment{}
+	if err := shipment.FillFromCompositeKeyParts(args); err != nil {
+		message := fmt.Sprintf("cannot fill a shipment key from arguments: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(400, "id", message)
+	}
+
+	newCustodian := args[1]
+	if newCustodian == "" {
+		message := fmt.Sprintf("new custodian must be not empty")
+		Logger.Error(message)
+		return ErrorResponse(400, "custodian", message)
+	}
+
+	if !ExistsIn(stub, &shipment, shipmentIndex) {
+		message := fmt.Sprintf("shipment with ID %s not found", shipment.Key.ID)
+		Logger.Error(message)
+		return ErrorResponse(404, "", message)
+	}
+
+	if err := LoadFrom(stub, &shipment, shipmentIndex); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	//checking creator
+	creator, err := GetMSPID(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's MSP ID: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+	if creator != shipment.Value.Custodian {
+		message := fmt.Sprintf("custody can be transferred by the custodian %s only", shipment.Value.Custodian)
+		Logger.Error(message)
+		return ErrorResponse(403, "", message)
+	}
+
+	if shipment.Value.State == ShipmentStateAccepted || shipment.Value.State == ShipmentStateDisputed {
+		message := fmt.Sprintf("custody of shipment in state %d cannot be transferred", shipment.Value.State)
+		Logger.Error(message)
+		return ErrorResponse(409, "", message)
+	}
+	if newCustodian == shipment.Value.Custodian {
+		message := fmt.Sprintf("%s is already the custodian", newCustodian)
+		Logger.Error(message)
+		return ErrorResponse(409, "", message)
+	}
+
+	shipment.Value.PendingCustodian = newCustodian
+
+	//updating state in ledger
+	if err := UpdateOrInsertIn(stub, &shipment, shipmentIndex, []string{"", shipment.Value.Custodian, newCustodian}, statebased.RoleTypePeer); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	//emitting Event
+	events := Events{}
+
+	eventValue := EventValue{}
+	eventValue.EntityType = shipmentIndex
+	eventValue.EntityID = shipment.Key.ID
+	eventValue.Other = shipment.Value
+	eventValue.Action = eventTransferShipmentCustody
+
+	events.Values = append(events.Values, eventValue)
+
+	if err := events.EmitEvent(stub); err != nil {
+		message := fmt.Sprintf("cannot emit event: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(nil)
+}
+
+//0
+//ID
+func (cc *SupplyChainChaincode) acceptShipmentCustody(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	shipment := Shipment{}
+	if err := shipment.FillFromCompositeKeyParts(args); err != nil {
+		message := fmt.Sprintf("cannot fill a shipment key from arguments: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(400, "id", message)
+	}
+
+	if !ExistsIn(stub, &shipment, shipmentIndex) {
+		message := fmt.Sprintf("shipment with ID %s not found", shipment.Key.ID)
+		Logger.Error(message)
+		return ErrorResponse(404, "", message)
+	}
+
+	if err := LoadFrom(stub, &shipment, shipmentIndex); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	if shipment.Value.PendingCustodian == "" {
+		message := fmt.Sprintf("shipment with ID %s has no pending custody transfer", shipment.Key.ID)
+		Logger.Error(message)
+		return ErrorResponse(409, "", message)
+	}
+
+	//checking creator
+	creator, err := GetMSPID(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's MSP ID: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+	if creator != shipment.Value.PendingCustodian {
+		message := fmt.Sprintf("custody can be accepted by %s only", shipment.Value.PendingCustodian)
+		Logger.Error(message)
+		return ErrorResponse(403, "", message)
+	}
+
+	//getting transaction Timestamp
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		message := fmt.Sprintf("unable to get transaction timestamp: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	transfer := CustodyTransfer{}
+	transfer.From = shipment.Value.Custodian
+	transfer.To = shipment.Value.PendingCustodian
+	transfer.Timestamp = timestamp.Seconds
+
+	shipment.Value.CustodyTransfers = append(shipment.Value.CustodyTransfers, transfer)
+	shipment.Value.Custodian = shipment.Value.PendingCustodian
+	shipment.Value.PendingCustodian = ""
+	shipment.Value.Timestamp = timestamp.Seconds
+
+	//updating state in ledger
+	if err := UpdateOrInsertIn(stub, &shipment, shipmentIndex, []string{"", shipment.Value.Custodian}, statebased.RoleTypePeer); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	//emitting Event
+	events := Events{}
+
+	eventValue := EventValue{}
+	eventValue.EntityType = shipmentIndex
+	eventValue.EntityID = shipment.Key.ID
+	eventValue.Other = shipment.Value
+	eventValue.Action = eventAcceptShipmentCustody
+
+	events.Values = append(events.Values, eventValue)
+
+	if err := events.EmitEvent(stub); err != nil {
+		message := fmt.Sprintf("cannot emit event: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(nil)
+}
+
+//0
+//ID
+func (cc *SupplyChainChaincode) getShipmentCompliance(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	shipment := Shipment{}
+	if err := shipment.FillFromCompositeKeyParts(args); err != nil {
+		message := fmt.Sprintf("cannot fill a shipment key from arguments: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(400, "id", message)
+	}
+
+	if !ExistsIn(stub, &shipment, shipmentIndex) {
+		message := fmt.Sprintf("shipment with ID %s not found", shipment.Key.ID)
+		Logger.Error(message)
+		return ErrorResponse(404, "", message)
+	}
+
+	if err := LoadFrom(stub, &shipment, shipmentIndex); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	if shipment.Value.DepartureTimestamp == 0 {
+		message := fmt.Sprintf("shipment with ID %s is not in transit yet", shipment.Key.ID)
+		Logger.Error(message)
+		return ErrorResponse(409, "", message)
+	}
+
+	//transit window ends on delivery or now
+	to := shipment.Value.DeliveryTimestamp
+	if to == 0 {
+		timestamp, err := stub.GetTxTimestamp()
+		if err != nil {
+			message := fmt.Sprintf("unable to get transaction timestamp: %s", err.Error())
+			Logger.Error(message)
+			return ErrorResponse(500, "", message)
+		}
+		to = timestamp.Seconds
+	}
+
+	access, err := LoadDataAccess(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot load data access of the creator: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	report, err := BuildComplianceReport(stub, &shipment, shipment.Value.DepartureTimestamp, to, access.Filter)
+	if err != nil {
+		message := fmt.Sprintf("unable to build compliance report: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	resultBytes, err := json.Marshal(report)
+	if err != nil {
+		return ErrorResponse(500, "", err.Error())
+	}
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+//0			1			2			3
+//SensorType	Selector	PageSize	Bookmark
+func (cc *SupplyChainChaincode) queryIot(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	if len(args) < 2 {
+		message := fmt.Sprintf("arguments array must contain at least %d items", 2)
+		Logger.Error(message)
+		return ErrorResponse(400, "", message)
+	}
+
+	sensorType, err := GetIotSensorType(stub, args[0])
+	if err != nil {
+		Logger.Error(err.Error())
+		return ErrorResponse(FillErrorStatus(err), "sensorType", err.Error())
+	}
+
+	query, err := BuildIotQuery(sensorType, args[1])
+	if err != nil {
+		message := fmt.Sprintf("invalid selector: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(400, "selector", message)
+	}
+
+	pageSize := int64(queryDefaultPageSize)
+	if len(args) > 2 && args[2] != "" {
+		pageSize, err = strconv.ParseInt(args[2], 10, 32)
+		if err != nil {
+			message := fmt.Sprintf("unable to parse the page size: %s", err.Error())
+			Logger.Error(message)
+			return ErrorResponse(400, "pageSize", message)
+		}
+		if pageSize <= 0 || pageSize > queryMaxPageSize {
+			message := fmt.Sprintf("page size must be between 1 and %d", queryMaxPageSize)
+			Logger.Error(message)
+			return ErrorResponse(400, "pageSize", message)
+		}
+	}
+
+	bookmark := ""
+	if len(args) > 3 {
+		bookmark = args[3]
+	}
+
+	access, err := LoadDataAccess(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot load data access of the creator: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	resultBytes, err := QueryResultWithPagination(stub, query, int32(pageSize), bookmark, sensorType.Create, access.Filter)
+	if err != nil {
+		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+//0				1		2			3
+//SensorTypes	Format	PageSize	Bookmark
+func (cc *SupplyChainChaincode) exportIot(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	if len(args) < 2 {
+		message := fmt.Sprintf("arguments array must contain at least %d items", 2)
+		Logger.Error(message)
+		return ErrorResponse(400, "", message)
+	}
+
+	sensors, err := ParseExportSensors(stub, args[0])
+	if err != nil {
+		Logger.Error(err.Error())
+		return ErrorResponse(FillErrorStatus(err), "sensorTypes", err.Error())
+	}
+
+	if args[1] != exportFormatCSV && args[1] != exportFormatJSONL {
+		message := fmt.Sprintf("unknown format %s; expected %s or %s", args[1], exportFormatCSV, exportFormatJSONL)
+		Logger.Error(message)
+		return ErrorResponse(400, "format", message)
+	}
+
+	pageSize := int64(queryDefaultPageSize)
+	if len(args) > 2 && args[2] != "" {
+		pageSize, err = strconv.ParseInt(args[2], 10, 32)
+		if err != nil {
+			message := fmt.Sprintf("unable to parse the page size: %s", err.Error())
+			Logger.Error(message)
+			return ErrorResponse(400, "pageSize", message)
+		}
+		if pageSize <= 0 || pageSize > queryMaxPageSize {
+			message := fmt.Sprintf("page size must be between 1 and %d", queryMaxPageSize)
+			Logger.Error(message)
+			return ErrorResponse(400, "pageSize", message)
+		}
+	}
+
+	bookmarkString := ""
+	if len(args) > 3 {
+		bookmarkString = args[3]
+	}
+	bookmark, err := ParseExportBookmark(sensors, bookmarkString)
+	if err != nil {
+		Logger.Error(err.Error())
+		return ErrorResponse(400, "bookmark", err.Error())
+	}
+
+	access, err := LoadDataAccess(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot load data access of the creator: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	page, err := ExportIot(stub, sensors, args[1], int32(pageSize), bookmark, access.Filter)
+	if err != nil {
+		message := fmt.Sprintf("unable to export readings: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	resultBytes, err := json.Marshal(page)
+	if err != nil {
+		return ErrorResponse(500, "", err.Error())
+	}
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+//0
+//BatchSize
+func (cc *SupplyChainChaincode) migrateSchema(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	batchSize := schemaMigrationBatchSize
+	if len(args) > 0 && args[0] != "" {
+		size, err := strconv.Atoi(args[0])
+		if err != nil {
+			message := fmt.Sprintf("unable to parse the batch size: %s", err.Error())
+			Logger.Error(message)
+			return ErrorResponse(400, "batchSize", message)
+		}
+		if size <= 0 {
+			message := "batch size must be larger than zero"
+			Logger.Error(message)
+			return ErrorResponse(400, "batchSize", message)
+		}
+		batchSize = size
+	}
+
+	migration, err := MigrateSchema(stub, batchSize)
+	if err != nil {
+		message := fmt.Sprintf("unable to migrate schema: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	resultBytes, err := json.Marshal(migration)
+	if err != nil {
+		return ErrorResponse(500, "", err.Error())
+	}
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+//0						1
+//BatchSize (optional)	LastKey (optional)
+func (cc *SupplyChainChaincode) compactEvents(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	//checking creator
+	if admin, err := IsNetworkAdmin(stub); err != nil {
+		message := fmt.Sprintf("cannot check creator's role: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	} else if !admin {
+		message := fmt.Sprintf("events can be compacted by identities of the certificate approvers with the %s attribute only", attributeAdmin)
+		Logger.Error(message)
+		return ErrorResponse(403, "", message)
+	}
+
+	batchSize := eventCompactionBatchSize
+	if len(args) > 0 && args[0] != "" {
+		size, err := strconv.Atoi(args[0])
+		if err != nil {
+			message := fmt.Sprintf("unable to parse the batch size: %s", err.Error())
+			Logger.Error(message)
+			return ErrorResponse(400, "batchSize", message)
+		}
+		if size <= 0 {
+			message := "batch size must be larger than zero"
+			Logger.Error(message)
+			return ErrorResponse(400, "batchSize", message)
+		}
+		batchSize = size
+	}
+
+	lastKey := ""
+	if len(args) > 1 {
+		lastKey = args[1]
+	}
+
+	config, err := LoadConfig(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot load config: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+	if config.Value.EventRetention == 0 {
+		message := "event retention is not configured, events are kept forever"
+		Logger.Error(message)
+		return ErrorResponse(409, "", message)
+	}
+
+	compaction, err := CompactEvents(stub, config.Value.EventRetention, batchSize, lastKey)
+	if err != nil {
+		message := fmt.Sprintf("unable to compact events: %s", err.Error())
+		Logger.Error(message)
+		return ErrorResponse(500, "", message)
+	}
+
+	resultBytes, err := json.Marshal(compaction)
+	if err != nil {
+		return ErrorResponse(500, "", err.Error())
+	}
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+//0
+//Name (optional)
+func (cc *SupplyChainChaincode) describe(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	catalogue := APICatalogue{initArguments, roleDescriptions, chaincodeFunctions}
+	if len(args) > 0 && args[0] != "" {
+		description, ok := GetFunctionDescription(args[0])
+		if !ok {
+			message := fmt.Sprintf("function %s not found", args[0])
+			Logger.Error(message)
+			return ErrorResponse(404, "name", message)
+		}
+		catalogue.Functions = []FunctionDescription{*description}
+	}
+
+	resultBytes, err := json.Marshal(catalogue)
+	if err != nil {
+		return ErrorResponse(500, "", err.Error())
+	}
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
 }
 
 func main() {
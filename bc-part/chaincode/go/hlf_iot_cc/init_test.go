@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestInitKeepsAllArguments(t *testing.T) {
+	stub := newCommittedStub()
+
+	// a config of a previous version, which the migration of the same transaction would rewrite
+	configKey, err := stub.CreateCompositeKey(configIndex, []string{""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.putCommitted(t, configKey, []byte(`{"collections":[],"chaincodeName":"","schemaversion":0}`))
+
+	bundle := newTestCA(t, "org1").PEM
+	bundles, _ := json.Marshal(map[string]string{"org1MSP": bundle})
+	stub.init(t, identitySourceAttribute, "3.5", "1", "org1MSP, org2MSP", string(bundles), "3600", "light")
+
+	config, err := LoadConfig(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"identity source", config.Value.IdentitySource, identitySourceAttribute},
+		{"shock threshold", config.Value.ShockThreshold.String(), "3.500000"},
+		{"certificate approvals", config.Value.CertificateApprovals, 1},
+		{"certificate approvers", len(config.Value.CertificateApprovers), 2},
+		{"CA certificates", config.Value.CACertificates["org1MSP"], bundle},
+		{"event retention", config.Value.EventRetention, int64(3600)},
+		{"unpersisted event sensors", len(config.Value.UnpersistedEventSensors), 1},
+		{"schema version", config.Value.SchemaVersion, configSchemaVersion},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%s = %v, want %v", test.name, test.got, test.want)
+		}
+	}
+
+	// an upgrade without arguments keeps the config
+	stub.init(t)
+	if config, err = LoadConfig(stub); err != nil || config.Value.IdentitySource != identitySourceAttribute || config.Value.EventRetention != 3600 {
+		t.Fatalf("config is not kept on upgrade: %+v, %v", config.Value, err)
+	}
+}
+
+func TestUpgradeKeepsLegacyCertificatesTrusted(t *testing.T) {
+	stub := newCommittedStub()
+	ca := newTestCA(t, "org1")
+	other := newTestCA(t, "org2")
+
+	// certificates registered before approvals and the proposing MSP were recorded
+	certificates := map[string]string{
+		"1b4e28ba-2fa1-41d2-883f-0016d3cca427": ca.Issue(t, "device1"),
+		"6fa459ea-ee8a-4ca4-894e-db77e160355e": newTestCA(t, "org3").Issue(t, "device2"),
+	}
+	for id, certificate := range certificates {
+		key, err := stub.CreateCompositeKey(iotCertificateIndex, []string{id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		value, _ := json.Marshal(map[string]interface{}{"certificate": certificate, "timestamp": 100})
+		stub.putCommitted(t, key, value)
+	}
+
+	bundles, _ := json.Marshal(map[string]string{"org1MSP": ca.PEM, "org2MSP": other.PEM})
+	stub.init(t, "", "", "", "", string(bundles))
+
+	stub.MockTransactionStart("check")
+	defer stub.MockTransactionEnd("check")
+	checker, err := LoadCertificateChecker(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		id   string
+		want string
+	}{
+		{"1b4e28ba-2fa1-41d2-883f-0016d3cca427", CertificateStatusValid},
+		{"6fa459ea-ee8a-4ca4-894e-db77e160355e", CertificateStatusUntrusted},
+	}
+	for _, test := range tests {
+		certificate := Certificate{Key: iotCertificateKey{ID: test.id}}
+		if err := LoadFrom(stub, &certificate, iotCertificateIndex); err != nil {
+			t.Fatal(err)
+		}
+		if certificate.Value.SchemaVersion != iotCertificateSchemaVersion {
+			t.Errorf("certificate %s is not migrated: version %d", test.id, certificate.Value.SchemaVersion)
+		}
+		if status := checker.Status(&certificate); status != test.want {
+			t.Errorf("certificate %s is %s, want %s", test.id, status, test.want)
+		}
+	}
+}
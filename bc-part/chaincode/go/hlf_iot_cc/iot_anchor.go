@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/satori/go.uuid"
+	"strconv"
+)
+
+const (
+	iotAnchorIndex = "IotAnchor"
+)
+
+const (
+	iotAnchorKeyFieldsNumber      = 1
+	iotAnchorBasicArgumentsNumber = 4
+	iotAnchorSchemaVersion        = 1
+)
+
+type iotAnchorKey struct {
+	ID string `json:"id"`
+}
+
+type anchorValue struct {
+	DeviceID      string `json:"deviceid"`
+	From          int64  `json:"from"`
+	To            int64  `json:"to"`
+	SampleCount   uint   `json:"samplecount"`
+	MerkleRoot    string `json:"merkleroot"`
+	Valid         byte   `json:"valid"`
+	Timestamp     int64  `json:"timestamp"`
+	SchemaVersion int    `json:"schemaversion"`
+}
+
+type Anchor struct {
+	Key   iotAnchorKey `json:"key"`
+	Value anchorValue  `json:"value"`
+}
+
+func CreateAnchor() LedgerData {
+	return new(Anchor)
+}
+
+//argument order
+//0		1	2			3
+//From	To	SampleCount	MerkleRoot
+func (entity *Anchor) FillFromArguments(stub shim.ChaincodeStubInterface, args []string) error {
+	if len(args) < iotAnchorBasicArgumentsNumber {
+		return errors.New(fmt.Sprintf("arguments array must contain at least %d items", iotAnchorBasicArgumentsNumber))
+	}
+
+	u, err := uuid.NewV4()
+	if err != nil {
+		return InternalError(errors.New(fmt.Sprintf("unable to generate uuid: %s", err.Error())))
+	}
+	entity.Key.ID = u.String()
+
+	fromString := args[0]
+	if fromString == "" {
+		message := fmt.Sprintf("from must be not empty")
+		return ArgumentError("from", errors.New(message))
+	}
+	// checking from
+	from, err := strconv.ParseInt(fromString, 10, 64)
+	if err != nil {
+		return ArgumentError("from", errors.New(fmt.Sprintf("unable to parse the from: %s", err.Error())))
+	}
+	if from < 0 {
+		return ArgumentError("from", errors.New("from must be larger than zero"))
+	}
+	entity.Value.From = from
+
+	toString := args[1]
+	if toString == "" {
+		message := fmt.Sprintf("to must be not empty")
+		return ArgumentError("to", errors.New(message))
+	}
+	// checking to
+	to, err := strconv.ParseInt(toString, 10, 64)
+	if err != nil {
+		return ArgumentError("to", errors.New(fmt.Sprintf("unable to parse the to: %s", err.Error())))
+	}
+	if to < from {
+		return ArgumentError("to", errors.New("to must be larger than or equal to from"))
+	}
+	entity.Value.To = to
+
+	sampleCountString := args[2]
+	if sampleCountString == "" {
+		message := fmt.Sprintf("sample count must be not empty")
+		return ArgumentError("sampleCount", errors.New(message))
+	}
+	// checking sample count
+	sampleCount, err := strconv.ParseUint(sampleCountString, 10, 32)
+	if err != nil {
+		return ArgumentError("sampleCount", errors.New(fmt.Sprintf("unable to parse the sample count: %s", err.Error())))
+	}
+	if sampleCount == 0 {
+		return ArgumentError("sampleCount", errors.New("sample count must be larger than zero"))
+	}
+	entity.Value.SampleCount = uint(sampleCount)
+
+	merkleRootString := args[3]
+	if merkleRootString == "" {
+		message := fmt.Sprintf("merkle root must be not empty")
+		return ArgumentError("merkleRoot", errors.New(message))
+	}
+	// checking merkle root
+	merkleRoot, err := hex.DecodeString(merkleRootString)
+	if err != nil {
+		return ArgumentError("merkleRoot", errors.New(fmt.Sprintf("unable to parse the merkle root: %s", err.Error())))
+	}
+	if len(merkleRoot) != merkleHashSize {
+		return ArgumentError("merkleRoot", errors.New(fmt.Sprintf("merkle root must be %d bytes long", merkleHashSize)))
+	}
+	entity.Value.MerkleRoot = hex.EncodeToString(merkleRoot)
+
+	//getting transaction Timestamp
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return InternalError(errors.New(fmt.Sprintf("unable to get transaction timestamp: %s", err.Error())))
+	}
+	entity.Value.Timestamp = timestamp.Seconds
+
+	//get device ID from certificate
+	deviceID, err := GetDeviceID(stub)
+	if err != nil {
+		return IdentityError(errors.New(fmt.Sprintf("cannot obtain creator's device ID from the certificate: %s", err.Error())))
+	}
+	entity.Value.DeviceID = deviceID
+
+	//check is certificate valid
+	valid, err := CheckCertificate(stub, "")
+	if err != nil {
+		return InternalError(errors.New(fmt.Sprintf("cannot check the certificate: %s", err.Error())))
+	}
+	entity.Value.Valid = valid
+
+	return nil
+}
+
+func (entity *Anchor) FillFromCompositeKeyParts(compositeKeyParts []string) error {
+	if len(compositeKeyParts) < iotAnchorKeyFieldsNumber {
+		return errors.New(fmt.Sprintf("composite key parts array must contain at least %d items", iotAnchorKeyFieldsNumber))
+	}
+
+	if id, err := uuid.FromString(compositeKeyParts[0]); err != nil {
+		return errors.New(fmt.Sprintf("unable to parse an ID from \"%s\"", compositeKeyParts[0]))
+	} else if id.Version() != uuid.V4 {
+		return errors.New("wrong ID format; expected UUID version 4")
+	}
+
+	entity.Key.ID = compositeKeyParts[0]
+
+	return nil
+}
+
+func (entity *Anchor) FillFromLedgerValue(ledgerValue []byte) error {
+	ledgerValue, err := UpcastLedgerValue(iotAnchorIndex, ledgerValue)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(ledgerValue, &entity.Value); err != nil {
+		return err
+	} else {
+		return nil
+	}
+}
+
+func (entity *Anchor) ToCompositeKey(stub shim.ChaincodeStubInterface) (string, error) {
+	compositeKeyParts := []string{
+		entity.Key.ID,
+	}
+
+	return stub.CreateCompositeKey(iotAnchorIndex, compositeKeyParts)
+}
+
+func (entity *Anchor) ToLedgerValue() ([]byte, error) {
+	entity.Value.SchemaVersion = iotAnchorSchemaVersion
+	return json.Marshal(entity.Value)
+}
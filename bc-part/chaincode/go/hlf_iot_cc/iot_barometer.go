@@ -16,19 +16,28 @@ const (
 const (
 	iotBarometerKeyFieldsNumber      = 1
 	iotBarometerBasicArgumentsNumber = 4
+	iotBarometerSchemaVersion        = 4
 )
 
+var barometerMeasurementFormats = map[string]MeasurementFormat{
+	"pressure":    {measurementScale, UnitHectopascal},
+	"altitude":    {measurementScale, UnitMeter},
+	"temperature": {measurementScale, UnitCelsius},
+}
+
 type iotBarometerKey struct {
 	ID string `json:"id"`
 }
 
 type barometerValue struct {
-	Pressure    float32 `json:"pressure"`
-	Altitude    float32 `json:"altitude"`
-	Temperature float32 `json:"temperature"`
-	CustomField string  `json:"customfield"`
-	Valid       byte    `json:"valid"`
-	Timestamp   int64   `json:"timestamp"`
+	Pressure    Measurement `json:"pressure"`
+	Altitude    Measurement `json:"altitude"`
+	Temperature Measurement `json:"temperature"`
+	CustomField string      `json:"customfield"`
+	Submitter
+	Valid         byte  `json:"valid"`
+	Timestamp     int64 `json:"timestamp"`
+	SchemaVersion int   `json:"schemaversion"`
 }
 
 type Barometer struct {
@@ -50,71 +59,78 @@ func (entity *Barometer) FillFromArguments(stub shim.ChaincodeStubInterface, arg
 
 	u, err := uuid.NewV4()
 	if err != nil {
-		return errors.New(fmt.Sprintf("unable to generate uuid: %s", err.Error()))
+		return InternalError(errors.New(fmt.Sprintf("unable to generate uuid: %s", err.Error())))
 	}
 	entity.Key.ID = u.String()
 
 	pressureString := args[0]
 	if pressureString == "" {
 		message := fmt.Sprintf("pressure must be not empty")
-		return errors.New(message)
+		return ArgumentError("pressure", errors.New(message))
 	}
 	// checking pressure
-	pressure, err := strconv.ParseFloat(pressureString, 32)
+	pressure, err := ParseMeasurement(pressureString, barometerMeasurementFormats["pressure"])
 	if err != nil {
-		return errors.New(fmt.Sprintf("unable to parse the pressure: %s", err.Error()))
+		return ArgumentError("pressure", errors.New(fmt.Sprintf("unable to parse the pressure: %s", err.Error())))
 	}
-	entity.Value.Pressure = float32(pressure)
+	entity.Value.Pressure = pressure
 
 	altitudeString := args[1]
 	if altitudeString == "" {
 		message := fmt.Sprintf("altitude must be not empty")
-		return errors.New(message)
+		return ArgumentError("altitude", errors.New(message))
 	}
 	// checking altitude
-	altitude, err := strconv.ParseFloat(altitudeString, 32)
+	altitude, err := ParseMeasurement(altitudeString, barometerMeasurementFormats["altitude"])
 	if err != nil {
-		return errors.New(fmt.Sprintf("unable to parse the altitude: %s", err.Error()))
+		return ArgumentError("altitude", errors.New(fmt.Sprintf("unable to parse the altitude: %s", err.Error())))
 	}
-	entity.Value.Altitude = float32(altitude)
+	entity.Value.Altitude = altitude
 
 	temperatureString := args[2]
 	if temperatureString == "" {
 		message := fmt.Sprintf("temperature must be not empty")
-		return errors.New(message)
+		return ArgumentError("temperature", errors.New(message))
 	}
 	// checking temperature
-	temperature, err := strconv.ParseFloat(temperatureString, 32)
+	temperature, err := ParseMeasurement(temperatureString, barometerMeasurementFormats["temperature"])
 	if err != nil {
-		return errors.New(fmt.Sprintf("unable to parse the temperature: %s", err.Error()))
+		return ArgumentError("temperature", errors.New(fmt.Sprintf("unable to parse the temperature: %s", err.Error())))
 	}
-	entity.Value.Temperature = float32(temperature)
+	entity.Value.Temperature = temperature
 
 	timestampString := args[3]
 	if timestampString == "" {
 		message := fmt.Sprintf("timestamp must be not empty")
-		return errors.New(message)
+		return ArgumentError("timestamp", errors.New(message))
 	}
 	timestamp, err := strconv.ParseInt(timestampString, 10, 64)
 	if err != nil {
-		return errors.New(fmt.Sprintf("unable to parse the timestamp: %s", err.Error()))
+		return ArgumentError("timestamp", errors.New(fmt.Sprintf("unable to parse the timestamp: %s", err.Error())))
 	}
 	if timestamp < 0 {
-		return errors.New("timestamp must be larger than zero")
+		return ArgumentError("timestamp", errors.New("timestamp must be larger than zero"))
 	}
 	entity.Value.Timestamp = int64(timestamp)
 
-	//get custom field from certificate
-	customField, err := GetCustomFieldFromCertificate(stub)
+	//get device identity from certificate
+	customField, err := GetDeviceID(stub)
 	if err != nil {
-		return errors.New(fmt.Sprintf("cannot obtain creator's custom field from the certificate: %s", err.Error()))
+		return IdentityError(errors.New(fmt.Sprintf("cannot obtain creator's device identity: %s", err.Error())))
 	}
 	entity.Value.CustomField = customField
 
+	//get submitter from certificate
+	submitter, err := GetSubmitter(stub)
+	if err != nil {
+		return InternalError(errors.New(fmt.Sprintf("cannot obtain creator's identity: %s", err.Error())))
+	}
+	entity.Value.Submitter = submitter
+
 	//check is certificate valid
 	valid, err := CheckCertificate(stub, "")
 	if err != nil {
-		return errors.New(fmt.Sprintf("cannot check the certificate: %s", err.Error()))
+		return InternalError(errors.New(fmt.Sprintf("cannot check the certificate: %s", err.Error())))
 	}
 	entity.Value.Valid = valid
 
@@ -138,6 +154,11 @@ func (entity *Barometer) FillFromCompositeKeyParts(compositeKeyParts []string) e
 }
 
 func (entity *Barometer) FillFromLedgerValue(ledgerValue []byte) error {
+	ledgerValue, err := UpcastLedgerValue(iotBarometerIndex, ledgerValue)
+	if err != nil {
+		return err
+	}
+
 	if err := json.Unmarshal(ledgerValue, &entity.Value); err != nil {
 		return err
 	} else {
@@ -154,5 +175,6 @@ func (entity *Barometer) ToCompositeKey(stub shim.ChaincodeStubInterface) (strin
 }
 
 func (entity *Barometer) ToLedgerValue() ([]byte, error) {
+	entity.Value.SchemaVersion = iotBarometerSchemaVersion
 	return json.Marshal(entity.Value)
 }
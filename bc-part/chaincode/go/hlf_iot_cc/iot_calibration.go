@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/satori/go.uuid"
+	"math/big"
+	"strconv"
+)
+
+const (
+	iotCalibrationIndex = "IotCalibration"
+)
+
+const (
+	iotCalibrationKeyFieldsNumber      = 4
+	iotCalibrationBasicArgumentsNumber = 7
+	iotCalibrationSchemaVersion        = 1
+)
+
+// scale of a calibration is a unitless multiplier
+var calibrationScaleFormat = MeasurementFormat{measurementScale, ""}
+
+type iotCalibrationKey struct {
+	DeviceID string `json:"deviceid"`
+	Sensor   string `json:"sensor"`
+	Field    string `json:"field"`
+	ID       string `json:"id"`
+}
+
+type calibrationValue struct {
+	Offset        Measurement `json:"offset"`
+	Scale         Measurement `json:"scale"`
+	ValidFrom     int64       `json:"validfrom"`
+	Certificate   string      `json:"certificate"`
+	Timestamp     int64       `json:"timestamp"`
+	SchemaVersion int         `json:"schemaversion"`
+}
+
+type Calibration struct {
+	Key   iotCalibrationKey `json:"key"`
+	Value calibrationValue  `json:"value"`
+}
+
+func CreateCalibration() LedgerData {
+	return new(Calibration)
+}
+
+//argument order
+//0			1		2		3		4		5			6
+//DeviceID	Sensor	Field	Offset	Scale	ValidFrom	Certificate
+func (entity *Calibration) FillFromArguments(stub shim.ChaincodeStubInterface, args []string) error {
+	if len(args) < iotCalibrationBasicArgumentsNumber {
+		return errors.New(fmt.Sprintf("arguments array must contain at least %d items", iotCalibrationBasicArgumentsNumber))
+	}
+
+	u, err := uuid.NewV4()
+	if err != nil {
+		return InternalError(errors.New(fmt.Sprintf("unable to generate uuid: %s", err.Error())))
+	}
+
+	if err := entity.FillFromCompositeKeyParts(append(args[:3:3], u.String())); err != nil {
+		return err
+	}
+
+	// checking the field; readings of registered sensor types are not calibrated
+	sensorType, ok := iotSensorTypes[entity.Key.Sensor]
+	if !ok {
+		return ArgumentError("sensor", errors.New(fmt.Sprintf("unknown built-in sensor type %s", entity.Key.Sensor)))
+	}
+	format, ok := sensorType.Formats[entity.Key.Field]
+	if !ok {
+		return ArgumentError("field", errors.New(fmt.Sprintf("%s has no measurement %s", entity.Key.Sensor, entity.Key.Field)))
+	}
+
+	// offset is in units of the field
+	offset, err := ParseMeasurement(args[3], format)
+	if err != nil {
+		return ArgumentError("offset", errors.New(fmt.Sprintf("unable to parse the offset: %s", err.Error())))
+	}
+	entity.Value.Offset = offset
+
+	scale, err := ParseMeasurement(args[4], calibrationScaleFormat)
+	if err != nil {
+		return ArgumentError("scale", errors.New(fmt.Sprintf("unable to parse the scale: %s", err.Error())))
+	}
+	if scale.Value <= 0 {
+		return ArgumentError("scale", errors.New("scale must be larger than zero"))
+	}
+	entity.Value.Scale = scale
+
+	validFrom, err := strconv.ParseInt(args[5], 10, 64)
+	if err != nil {
+		return ArgumentError("validFrom", errors.New(fmt.Sprintf("unable to parse the valid-from timestamp: %s", err.Error())))
+	}
+	if validFrom < 0 {
+		return ArgumentError("validFrom", errors.New("valid-from timestamp must be larger than zero"))
+	}
+	entity.Value.ValidFrom = validFrom
+
+	certificate := args[6]
+	if certificate == "" {
+		message := fmt.Sprintf("certificate of calibration must be not empty")
+		return ArgumentError("certificate", errors.New(message))
+	}
+	entity.Value.Certificate = certificate
+
+	//getting transaction Timestamp
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return InternalError(errors.New(fmt.Sprintf("unable to get transaction timestamp: %s", err.Error())))
+	}
+	entity.Value.Timestamp = timestamp.Seconds
+
+	return nil
+}
+
+func (entity *Calibration) FillFromCompositeKeyParts(compositeKeyParts []string) error {
+	if len(compositeKeyParts) < iotCalibrationKeyFieldsNumber {
+		return errors.New(fmt.Sprintf("composite key parts array must contain at least %d items", iotCalibrationKeyFieldsNumber))
+	}
+
+	if compositeKeyParts[0] == "" {
+		return errors.New("device ID must be not empty")
+	}
+	if compositeKeyParts[1] == "" {
+		return errors.New("sensor must be not empty")
+	}
+	if compositeKeyParts[2] == "" {
+		return errors.New("field must be not empty")
+	}
+
+	if id, err := uuid.FromString(compositeKeyParts[3]); err != nil {
+		return errors.New(fmt.Sprintf("unable to parse an ID from \"%s\"", compositeKeyParts[3]))
+	} else if id.Version() != uuid.V4 {
+		return errors.New("wrong ID format; expected UUID version 4")
+	}
+
+	entity.Key.DeviceID = compositeKeyParts[0]
+	entity.Key.Sensor = compositeKeyParts[1]
+	entity.Key.Field = compositeKeyParts[2]
+	entity.Key.ID = compositeKeyParts[3]
+
+	return nil
+}
+
+func (entity *Calibration) FillFromLedgerValue(ledgerValue []byte) error {
+	ledgerValue, err := UpcastLedgerValue(iotCalibrationIndex, ledgerValue)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(ledgerValue, &entity.Value); err != nil {
+		return err
+	} else {
+		return nil
+	}
+}
+
+func (entity *Calibration) ToCompositeKey(stub shim.ChaincodeStubInterface) (string, error) {
+	compositeKeyParts := []string{
+		entity.Key.DeviceID,
+		entity.Key.Sensor,
+		entity.Key.Field,
+		entity.Key.ID,
+	}
+
+	return stub.CreateCompositeKey(iotCalibrationIndex, compositeKeyParts)
+}
+
+func (entity *Calibration) ToLedgerValue() ([]byte, error) {
+	entity.Value.SchemaVersion = iotCalibrationSchemaVersion
+	return json.Marshal(entity.Value)
+}
+
+// Apply returns raw * scale + offset rounded to the format of the raw measurement
+func (entity *Calibration) Apply(raw Measurement) (Measurement, error) {
+	value := new(big.Rat).Mul(raw.Rat(), entity.Value.Scale.Rat())
+	value.Add(value, entity.Value.Offset.Rat())
+
+	return measurementFromRat(value, MeasurementFormat{raw.Scale, raw.Unit}, true)
+}
+
+type correctedReading struct {
+	Key       json.RawMessage        `json:"key"`
+	Value     json.RawMessage        `json:"value"`
+	Corrected map[string]Measurement `json:"corrected"`
+}
+
+// CorrectReadings adds calibrated values next to the raw ones, using the latest calibration
+// of the device and field which is valid at the time of the reading.
+// Fields without calibration are left out of the corrected values.
+func CorrectReadings(stub shim.ChaincodeStubInterface, sensor string, readingsBytes []byte) ([]byte, error) {
+	sensorType, ok := iotSensorTypes[sensor]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("unknown built-in sensor type %s", sensor))
+	}
+
+	calibrations := []Calibration{}
+	calibrationsBytes, err := Query(stub, iotCalibrationIndex, []string{}, CreateCalibration, func(data LedgerData) bool {
+		return data.(*Calibration).Key.Sensor == sensor
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(calibrationsBytes, &calibrations); err != nil {
+		return nil, err
+	}
+
+	readings := []correctedReading{}
+	if err := json.Unmarshal(readingsBytes, &readings); err != nil {
+		return nil, err
+	}
+
+	for i := range readings {
+		value := map[string]json.RawMessage{}
+		if err := json.Unmarshal(readings[i].Value, &value); err != nil {
+			return nil, err
+		}
+
+		reading := struct {
+			CustomField string `json:"customfield"`
+			Timestamp   int64  `json:"timestamp"`
+		}{}
+		if err := json.Unmarshal(readings[i].Value, &reading); err != nil {
+			return nil, err
+		}
+
+		readings[i].Corrected = map[string]Measurement{}
+		for field := range sensorType.Formats {
+			var calibration *Calibration
+			for j := range calibrations {
+				candidate := &calibrations[j]
+				if candidate.Key.DeviceID != reading.CustomField || candidate.Key.Field != field ||
+					candidate.Value.ValidFrom > reading.Timestamp {
+					continue
+				}
+				if calibration == nil || candidate.Value.ValidFrom > calibration.Value.ValidFrom ||
+					(candidate.Value.ValidFrom == calibration.Value.ValidFrom && candidate.Value.Timestamp > calibration.Value.Timestamp) {
+					calibration = candidate
+				}
+			}
+			if calibration == nil {
+				continue
+			}
+
+			raw := Measurement{}
+			if err := json.Unmarshal(value[field], &raw); err != nil {
+				return nil, errors.New(fmt.Sprintf("cannot read %s: %s", field, err.Error()))
+			}
+
+			corrected, err := calibration.Apply(raw)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("cannot correct %s: %s", field, err.Error()))
+			}
+			readings[i].Corrected[field] = corrected
+		}
+	}
+
+	return json.Marshal(readings)
+}
@@ -1,30 +1,85 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	"github.com/satori/go.uuid"
+	"sort"
 	"strings"
+	"time"
 )
 
 const (
 	iotCertificateIndex = "IotCertificate"
+	// certificates by the device ID they identify
+	certificateDeviceIndex = "CertificateByDevice"
 )
 
 const (
 	iotCertificateKeyFieldsNumber      = 1
 	iotCertificateBasicArgumentsNumber = 1
+	iotCertificateSchemaVersion        = 3
+)
+
+// Certificate states
+const (
+	CertificateStateUnknown = iota
+	// registered by an admin and waiting for approvals of member organizations
+	CertificateStateProposed
+	CertificateStateActive
+)
+
+// Results of a certificate check
+const (
+	CertificateStatusValid        = "valid"
+	CertificateStatusUnregistered = "unregistered"
+	CertificateStatusProposed     = "proposed"
+	CertificateStatusExpired      = "expired"
+	CertificateStatusNotYetValid  = "not yet valid"
+	CertificateStatusUntrusted    = "untrusted"
 )
 
 type iotCertificateKey struct {
 	ID string `json:"id"`
 }
 
+type CertificateApproval struct {
+	MSPID        string `json:"mspid"`
+	EnrollmentID string `json:"enrollmentid"`
+	Timestamp    int64  `json:"timestamp"`
+}
+
 type certificateValue struct {
 	Certificate string `json:"certificate"`
-	Timestamp   int64  `json:"timestamp"`
+	// details parsed from the certificate on registration
+	Subject              string `json:"subject"`
+	SerialNumber         string `json:"serialnumber"`
+	Issuer               string `json:"issuer"`
+	NotBefore            int64  `json:"notbefore"`
+	NotAfter             int64  `json:"notafter"`
+	PublicKeyFingerprint string `json:"publickeyfingerprint"`
+	State                int    `json:"state"`
+	ProposedBy           string `json:"proposedby"`
+	// number of approvals the certificate needed when it was registered
+	RequiredApprovals int                   `json:"requiredapprovals"`
+	Approvals         []CertificateApproval `json:"approvals"`
+	Timestamp         int64                 `json:"timestamp"`
+	SchemaVersion     int                   `json:"schemaversion"`
+}
+
+var certificateStatuses = []string{CertificateStatusValid, CertificateStatusUnregistered, CertificateStatusProposed,
+	CertificateStatusExpired, CertificateStatusNotYetValid, CertificateStatusUntrusted}
+
+type CertificateCheck struct {
+	Valid  byte   `json:"valid"`
+	Status string `json:"status"`
 }
 
 type Certificate struct {
@@ -46,18 +101,27 @@ func (entity *Certificate) FillFromArguments(stub shim.ChaincodeStubInterface, a
 
 	u, err := uuid.NewV4()
 	if err != nil {
-		return errors.New(fmt.Sprintf("unable to generate uuid: %s", err.Error()))
+		return InternalError(errors.New(fmt.Sprintf("unable to generate uuid: %s", err.Error())))
 	}
 	entity.Key.ID = u.String()
 
 	certificateString := args[0]
 	if certificateString == "" {
 		message := fmt.Sprintf("certificate must be not empty")
-		return errors.New(message)
+		return ArgumentError("certificate", errors.New(message))
+	}
+	if !strings.Contains(certificateString, "-----") {
+		return ArgumentError("certificate", errors.New("certificate must be PEM-encoded"))
 	}
 	certificateString = certificateString[strings.Index(certificateString, "-----") : strings.LastIndex(certificateString, "-----")+5]
 	entity.Value.Certificate = certificateString
 
+	certificate, err := ParseCertificate(certificateString)
+	if err != nil {
+		return ArgumentError("certificate", err)
+	}
+	entity.fillDetails(certificate)
+
 	return nil
 }
 
@@ -78,6 +142,11 @@ func (entity *Certificate) FillFromCompositeKeyParts(compositeKeyParts []string)
 }
 
 func (entity *Certificate) FillFromLedgerValue(ledgerValue []byte) error {
+	ledgerValue, err := UpcastLedgerValue(iotCertificateIndex, ledgerValue)
+	if err != nil {
+		return err
+	}
+
 	if err := json.Unmarshal(ledgerValue, &entity.Value); err != nil {
 		return err
 	} else {
@@ -94,5 +163,368 @@ func (entity *Certificate) ToCompositeKey(stub shim.ChaincodeStubInterface) (str
 }
 
 func (entity *Certificate) ToLedgerValue() ([]byte, error) {
+	entity.Value.SchemaVersion = iotCertificateSchemaVersion
 	return json.Marshal(entity.Value)
 }
+
+// Approve records the approval of the MSP and activates the certificate once it has enough approvals
+func (entity *Certificate) Approve(approval CertificateApproval) error {
+	if entity.Value.State != CertificateStateProposed {
+		return errors.New(fmt.Sprintf("certificate in state %d cannot be approved", entity.Value.State))
+	}
+	for _, existing := range entity.Value.Approvals {
+		if existing.MSPID == approval.MSPID {
+			return errors.New(fmt.Sprintf("certificate is already approved by %s", approval.MSPID))
+		}
+	}
+
+	entity.Value.Approvals = append(entity.Value.Approvals, approval)
+	if len(entity.Value.Approvals) >= entity.Value.RequiredApprovals {
+		entity.Value.State = CertificateStateActive
+	}
+
+	return nil
+}
+
+// Status checks the registration state, the validity period and the chain to the CA certificates at the time
+func (entity *Certificate) Status(caCertificates string, at time.Time) string {
+	if entity.Value.State != CertificateStateActive {
+		return CertificateStatusProposed
+	}
+
+	certificate, err := ParseCertificate(entity.Value.Certificate)
+	if err != nil {
+		return CertificateStatusUntrusted
+	}
+	if at.Before(certificate.NotBefore) {
+		return CertificateStatusNotYetValid
+	}
+	if at.After(certificate.NotAfter) {
+		return CertificateStatusExpired
+	}
+
+	if err := entity.VerifyChain(caCertificates, at); err != nil {
+		return CertificateStatusUntrusted
+	}
+
+	return CertificateStatusValid
+}
+
+// Fingerprint returns the SHA-256 fingerprint of the certificate, as stored in the submitter of readings
+func (entity *Certificate) Fingerprint() string {
+	certificate, err := ParseCertificate(entity.Value.Certificate)
+	if err != nil {
+		return ""
+	}
+
+	fingerprint := sha256.Sum256(certificate.Raw)
+	return hex.EncodeToString(fingerprint[:])
+}
+
+// VerifyChain checks that the certificate is issued by the CA certificates at the time;
+// certificates of MSPs without CA certificates are not trusted
+func (entity *Certificate) VerifyChain(caCertificates string, at time.Time) error {
+	if caCertificates == "" {
+		return errors.New("no CA certificates are configured for the MSP, so the certificate cannot be verified")
+	}
+
+	certificate, err := ParseCertificate(entity.Value.Certificate)
+	if err != nil {
+		return err
+	}
+	pool, err := ParseCertificatePool(caCertificates)
+	if err != nil {
+		return err
+	}
+
+	if _, err := certificate.Verify(x509.VerifyOptions{
+		Roots:         pool.Roots,
+		Intermediates: pool.Intermediates,
+		CurrentTime:   at,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return errors.New(fmt.Sprintf("certificate is not issued by the CA certificates: %s", err.Error()))
+	}
+
+	return nil
+}
+
+func (entity *Certificate) fillDetails(certificate *x509.Certificate) {
+	fingerprint := sha256.Sum256(certificate.RawSubjectPublicKeyInfo)
+
+	entity.Value.Subject = certificate.Subject.String()
+	entity.Value.SerialNumber = certificate.SerialNumber.String()
+	entity.Value.Issuer = certificate.Issuer.String()
+	entity.Value.NotBefore = certificate.NotBefore.Unix()
+	entity.Value.NotAfter = certificate.NotAfter.Unix()
+	entity.Value.PublicKeyFingerprint = hex.EncodeToString(fingerprint[:])
+}
+
+func ParseCertificate(certificateString string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(certificateString))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("no PEM-encoded certificate found")
+	}
+
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to parse the certificate: %s", err.Error()))
+	}
+
+	return certificate, nil
+}
+
+type CertificatePool struct {
+	Roots         *x509.CertPool
+	Intermediates *x509.CertPool
+}
+
+// ParseCertificatePool splits a PEM bundle into self-signed roots and intermediates
+func ParseCertificatePool(bundle string) (CertificatePool, error) {
+	pool := CertificatePool{Roots: x509.NewCertPool(), Intermediates: x509.NewCertPool()}
+
+	roots := 0
+	rest := []byte(bundle)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return pool, errors.New(fmt.Sprintf("unable to parse a CA certificate: %s", err.Error()))
+		}
+		if bytes.Equal(certificate.RawIssuer, certificate.RawSubject) {
+			pool.Roots.AddCert(certificate)
+			roots++
+		} else {
+			pool.Intermediates.AddCert(certificate)
+		}
+	}
+
+	if roots == 0 {
+		return pool, errors.New("at least one root CA certificate must be set")
+	}
+
+	return pool, nil
+}
+
+// upcastCertificateDetails parses certificates stored before their details were kept; the ones
+// which cannot be parsed keep empty details and are reported as untrusted
+func upcastCertificateDetails(value map[string]interface{}) error {
+	certificateString, _ := value["certificate"].(string)
+	certificate, err := ParseCertificate(certificateString)
+	if err != nil {
+		return nil
+	}
+
+	entity := Certificate{}
+	entity.fillDetails(certificate)
+	value["subject"] = entity.Value.Subject
+	value["serialnumber"] = entity.Value.SerialNumber
+	value["issuer"] = entity.Value.Issuer
+	value["notbefore"] = entity.Value.NotBefore
+	value["notafter"] = entity.Value.NotAfter
+	value["publickeyfingerprint"] = entity.Value.PublicKeyFingerprint
+
+	return nil
+}
+
+// upcastCertificateState keeps certificates registered before approvals were introduced valid;
+// the MSP which proposed them is not known, so CertificateChecker checks them against all CA certificates
+func upcastCertificateState(value map[string]interface{}) error {
+	value["state"] = CertificateStateActive
+	value["approvals"] = []interface{}{}
+
+	return nil
+}
+
+// CertificateChecker checks certificates against the configured CA certificates at the transaction time
+type CertificateChecker struct {
+	CACertificates map[string]string
+	At             time.Time
+}
+
+func LoadCertificateChecker(stub shim.ChaincodeStubInterface) (CertificateChecker, error) {
+	checker := CertificateChecker{}
+
+	config, err := LoadConfig(stub)
+	if err != nil {
+		return checker, err
+	}
+	checker.CACertificates = config.Value.CACertificates
+
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return checker, errors.New(fmt.Sprintf("unable to get transaction timestamp: %s", err.Error()))
+	}
+	checker.At = time.Unix(timestamp.Seconds, int64(timestamp.Nanos))
+
+	return checker, nil
+}
+
+// Status checks the certificate against the CA certificates of the MSP which proposed it. Certificates
+// registered before the proposing MSP was recorded are trusted if the CA certificates of any MSP issued them
+func (checker CertificateChecker) Status(entity *Certificate) string {
+	if entity.Value.ProposedBy != "" {
+		return entity.Status(checker.CACertificates[entity.Value.ProposedBy], checker.At)
+	}
+
+	// sorted, so that all endorsers report the same status
+	mspids := []string{}
+	for mspid := range checker.CACertificates {
+		mspids = append(mspids, mspid)
+	}
+	sort.Strings(mspids)
+
+	status := entity.Status("", checker.At)
+	for _, mspid := range mspids {
+		if status = entity.Status(checker.CACertificates[mspid], checker.At); status == CertificateStatusValid {
+			return status
+		}
+	}
+
+	return status
+}
+
+// IndexCertificateDevice records the certificate under the device ID it identifies. The ID is taken with
+// the identity source set when the certificate is indexed
+func IndexCertificateDevice(stub shim.ChaincodeStubInterface, entry LedgerData) error {
+	certificate := entry.(*Certificate)
+	parsed, err := ParseCertificate(certificate.Value.Certificate)
+	if err != nil {
+		return err
+	}
+
+	deviceID, err := CertificateDeviceID(stub, parsed)
+	if err != nil || deviceID == "" {
+		return err
+	}
+
+	return putIndexEntry(stub, certificateDeviceIndex, []string{deviceID, certificate.Key.ID}, "")
+}
+
+// HasActiveCertificate reports whether an active certificate of the device proposed by the MSP
+// is valid at the transaction time, which proves that the MSP enrolled the device
+func HasActiveCertificate(stub shim.ChaincodeStubInterface, deviceID string, mspid string) (bool, error) {
+	entries, err := getIndexEntries(stub, certificateDeviceIndex, []string{deviceID})
+	if err != nil {
+		return false, err
+	}
+
+	checker, err := LoadCertificateChecker(stub)
+	if err != nil {
+		return false, err
+	}
+
+	for _, entry := range entries {
+		certificate := Certificate{}
+		if err := certificate.FillFromCompositeKeyParts(entry.KeyParts[1:]); err != nil {
+			return false, err
+		}
+		if err := LoadFrom(stub, &certificate, iotCertificateIndex); err != nil {
+			return false, err
+		}
+
+		if certificate.Value.ProposedBy == mspid && checker.Status(&certificate) == CertificateStatusValid {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// CertificateListOptions are passed to listIotCertificates as a JSON object; expiry bounds are Unix seconds
+type CertificateListOptions struct {
+	IssuerOrg     string `json:"issuerorg"`
+	Status        string `json:"status"`
+	ExpiresAfter  int64  `json:"expiresafter"`
+	ExpiresBefore int64  `json:"expiresbefore"`
+}
+
+func ParseCertificateListOptions(optionsString string) (CertificateListOptions, error) {
+	options := CertificateListOptions{}
+	if optionsString == "" {
+		return options, nil
+	}
+
+	if err := json.Unmarshal([]byte(optionsString), &options); err != nil {
+		return options, errors.New(fmt.Sprintf("cannot unmarshaling list options: %s", err.Error()))
+	}
+
+	if options.Status != "" {
+		known := false
+		for _, status := range certificateStatuses {
+			if options.Status == status {
+				known = true
+			}
+		}
+		if !known {
+			return options, errors.New(fmt.Sprintf("unknown status %s; expected one of %v", options.Status, certificateStatuses))
+		}
+	}
+
+	return options, nil
+}
+
+func (options CertificateListOptions) Filter(checker CertificateChecker) FilterFunction {
+	return func(data LedgerData) bool {
+		entity := data.(*Certificate)
+
+		if options.ExpiresAfter != 0 && entity.Value.NotAfter < options.ExpiresAfter {
+			return false
+		}
+		if options.ExpiresBefore != 0 && entity.Value.NotAfter > options.ExpiresBefore {
+			return false
+		}
+		if options.Status != "" && checker.Status(entity) != options.Status {
+			return false
+		}
+
+		if options.IssuerOrg != "" {
+			certificate, err := ParseCertificate(entity.Value.Certificate)
+			if err != nil {
+				return false
+			}
+			for _, organization := range certificate.Issuer.Organization {
+				if organization == options.IssuerOrg {
+					return true
+				}
+			}
+			return false
+		}
+
+		return true
+	}
+}
+
+// CertificateDetails is a certificate with its status at the transaction time
+type CertificateDetails struct {
+	Key         iotCertificateKey `json:"key"`
+	Value       certificateValue  `json:"value"`
+	Status      string            `json:"status"`
+	Fingerprint string            `json:"fingerprint"`
+	// devices which submitted readings with the certificate and the number of the readings by sensor type,
+	// counting the readings the creator has access to only;
+	// set by getIotCertificate only
+	Devices  []string       `json:"devices,omitempty"`
+	Readings map[string]int `json:"readings,omitempty"`
+}
+
+// CertificatePage is a page of listIotCertificates
+type CertificatePage struct {
+	Records             []CertificateDetails `json:"records"`
+	FetchedRecordsCount int32                `json:"fetchedrecordscount"`
+	Bookmark            string               `json:"bookmark"`
+}
+
+func (checker CertificateChecker) Details(entity *Certificate) CertificateDetails {
+	return CertificateDetails{
+		Key:         entity.Key,
+		Value:       entity.Value,
+		Status:      checker.Status(entity),
+		Fingerprint: entity.Fingerprint(),
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestHasActiveCertificate(t *testing.T) {
+	stub := shim.NewMockStub(chaincodeName, new(SupplyChainChaincode))
+	ca := newTestCA(t, "org1")
+
+	stub.MockTransactionStart("setup")
+	defer stub.MockTransactionEnd("setup")
+
+	config := Config{}
+	bundles, _ := json.Marshal(map[string]string{"org1MSP": ca.PEM})
+	if err := config.SetIdentitySource(identitySourceAttribute); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.SetCACertificates(string(bundles)); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateOrInsertIn(stub, &config, configIndex, []string{""}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// device1 has an active certificate proposed by org1MSP, device2 a proposed one only
+	for deviceID, state := range map[string]int{"device1": CertificateStateActive, "device2": CertificateStateProposed} {
+		certificate := Certificate{}
+		pem := ca.IssueWithAttributes(t, deviceID, map[string]string{attributeDeviceID: deviceID})
+		if err := certificate.FillFromArguments(stub, []string{pem}); err != nil {
+			t.Fatal(err)
+		}
+		certificate.Value.ProposedBy = "org1MSP"
+		certificate.Value.State = state
+		if err := UpdateOrInsertIn(stub, &certificate, iotCertificateIndex, []string{""}, ""); err != nil {
+			t.Fatal(err)
+		}
+		if err := IndexCertificateDevice(stub, &certificate); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		deviceID string
+		mspid    string
+		want     bool
+	}{
+		{"proposing MSP", "device1", "org1MSP", true},
+		{"another MSP", "device1", "org2MSP", false},
+		{"certificate not approved yet", "device2", "org1MSP", false},
+		{"device without certificates", "device3", "org1MSP", false},
+	}
+
+	for _, test := range tests {
+		if got, err := HasActiveCertificate(stub, test.deviceID, test.mspid); err != nil || got != test.want {
+			t.Errorf("%s: HasActiveCertificate() = %v, %v; want %v", test.name, got, err, test.want)
+		}
+	}
+}
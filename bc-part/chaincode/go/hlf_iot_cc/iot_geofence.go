@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/satori/go.uuid"
+	"math"
+	"strconv"
+)
+
+const (
+	iotGeofenceIndex = "IotGeofence"
+)
+
+const (
+	iotGeofenceKeyFieldsNumber      = 1
+	iotGeofenceBasicArgumentsNumber = 5
+	iotGeofenceSchemaVersion        = 2
+)
+
+// Geofence types
+const (
+	GeofenceTypeCircle  = "circle"
+	GeofenceTypePolygon = "polygon"
+)
+
+const earthRadiusMeters = 6371000.0
+
+type iotGeofenceKey struct {
+	ID string `json:"id"`
+}
+
+type GeoPoint struct {
+	Longitude float64 `json:"longitude"`
+	Latitude  float64 `json:"latitude"`
+}
+
+type geofenceValue struct {
+	Name      string     `json:"name"`
+	Type      string     `json:"type"`
+	Points    []GeoPoint `json:"points"`
+	Radius    float64    `json:"radius"`
+	DeviceIDs []string   `json:"deviceids"`
+	// MSP of the creator, the only one able to delete the geofence besides admins; empty for geofences of version 1
+	Creator       string `json:"creator"`
+	Timestamp     int64  `json:"timestamp"`
+	SchemaVersion int    `json:"schemaversion"`
+}
+
+type Geofence struct {
+	Key   iotGeofenceKey `json:"key"`
+	Value geofenceValue  `json:"value"`
+}
+
+func CreateGeofence() LedgerData {
+	return new(Geofence)
+}
+
+//argument order
+//0		1		2		3		4
+//Name	Type	Points	Radius	DeviceIDs
+func (entity *Geofence) FillFromArguments(stub shim.ChaincodeStubInterface, args []string) error {
+	if len(args) < iotGeofenceBasicArgumentsNumber {
+		return errors.New(fmt.Sprintf("arguments array must contain at least %d items", iotGeofenceBasicArgumentsNumber))
+	}
+
+	u, err := uuid.NewV4()
+	if err != nil {
+		return InternalError(errors.New(fmt.Sprintf("unable to generate uuid: %s", err.Error())))
+	}
+	entity.Key.ID = u.String()
+
+	name := args[0]
+	if name == "" {
+		message := fmt.Sprintf("name must be not empty")
+		return ArgumentError("name", errors.New(message))
+	}
+	entity.Value.Name = name
+
+	geofenceType := args[1]
+	if geofenceType != GeofenceTypeCircle && geofenceType != GeofenceTypePolygon {
+		return ArgumentError("type", errors.New(fmt.Sprintf("type must be one of {%s, %s}", GeofenceTypeCircle, GeofenceTypePolygon)))
+	}
+	entity.Value.Type = geofenceType
+
+	// checking points
+	if len(args[2]) == 0 {
+		return ArgumentError("points", errors.New(fmt.Sprintf("points must be not empty")))
+	}
+	points := []GeoPoint{}
+	if err := json.Unmarshal([]byte(args[2]), &points); err != nil {
+		return ArgumentError("points", errors.New(fmt.Sprintf("cannot unmarshaling points: %s", err.Error())))
+	}
+	for _, point := range points {
+		if point.Longitude < -180 || point.Longitude > 180 || point.Latitude < -90 || point.Latitude > 90 {
+			return ArgumentError("points", errors.New(fmt.Sprintf("point {%f, %f} is out of range", point.Longitude, point.Latitude)))
+		}
+	}
+	entity.Value.Points = points
+
+	// checking radius
+	if geofenceType == GeofenceTypeCircle {
+		if len(points) != 1 {
+			return ArgumentError("points", errors.New("circle geofence must contain exactly one center point"))
+		}
+
+		radius, err := strconv.ParseFloat(args[3], 64)
+		if err != nil {
+			return ArgumentError("radius", errors.New(fmt.Sprintf("unable to parse the radius: %s", err.Error())))
+		}
+		if radius <= 0 {
+			return ArgumentError("radius", errors.New("radius must be larger than zero"))
+		}
+		entity.Value.Radius = radius
+	} else if len(points) < 3 {
+		return ArgumentError("points", errors.New("polygon geofence must contain at least three points"))
+	}
+
+	// checking device IDs
+	if len(args[4]) == 0 {
+		return ArgumentError("deviceIDs", errors.New(fmt.Sprintf("device IDs must be not empty")))
+	}
+	deviceIDs := []string{}
+	if err := json.Unmarshal([]byte(args[4]), &deviceIDs); err != nil {
+		return ArgumentError("deviceIDs", errors.New(fmt.Sprintf("cannot unmarshaling device IDs: %s", err.Error())))
+	}
+	if len(deviceIDs) == 0 {
+		return ArgumentError("deviceIDs", errors.New("geofence must be assigned to at least one device"))
+	}
+	entity.Value.DeviceIDs = deviceIDs
+
+	//getting transaction Timestamp
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return InternalError(errors.New(fmt.Sprintf("unable to get transaction timestamp: %s", err.Error())))
+	}
+	entity.Value.Timestamp = timestamp.Seconds
+
+	return nil
+}
+
+func (entity *Geofence) FillFromCompositeKeyParts(compositeKeyParts []string) error {
+	if len(compositeKeyParts) < iotGeofenceKeyFieldsNumber {
+		return errors.New(fmt.Sprintf("composite key parts array must contain at least %d items", iotGeofenceKeyFieldsNumber))
+	}
+
+	if id, err := uuid.FromString(compositeKeyParts[0]); err != nil {
+		return errors.New(fmt.Sprintf("unable to parse an ID from \"%s\"", compositeKeyParts[0]))
+	} else if id.Version() != uuid.V4 {
+		return errors.New("wrong ID format; expected UUID version 4")
+	}
+
+	entity.Key.ID = compositeKeyParts[0]
+
+	return nil
+}
+
+func (entity *Geofence) FillFromLedgerValue(ledgerValue []byte) error {
+	ledgerValue, err := UpcastLedgerValue(iotGeofenceIndex, ledgerValue)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(ledgerValue, &entity.Value); err != nil {
+		return err
+	} else {
+		return nil
+	}
+}
+
+func (entity *Geofence) ToCompositeKey(stub shim.ChaincodeStubInterface) (string, error) {
+	compositeKeyParts := []string{
+		entity.Key.ID,
+	}
+
+	return stub.CreateCompositeKey(iotGeofenceIndex, compositeKeyParts)
+}
+
+func (entity *Geofence) ToLedgerValue() ([]byte, error) {
+	entity.Value.SchemaVersion = iotGeofenceSchemaVersion
+	return json.Marshal(entity.Value)
+}
+
+func (entity *Geofence) IsAssignedTo(deviceID string) bool {
+	for _, id := range entity.Value.DeviceIDs {
+		if id == deviceID {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (entity *Geofence) Contains(longitude, latitude float64) bool {
+	switch entity.Value.Type {
+	case GeofenceTypeCircle:
+		center := entity.Value.Points[0]
+		return distanceMeters(center.Longitude, center.Latitude, longitude, latitude) <= entity.Value.Radius
+	case GeofenceTypePolygon:
+		// ray casting
+		inside := false
+		points := entity.Value.Points
+		for i, j := 0, len(points)-1; i < len(points); j, i = i, i+1 {
+			if (points[i].Latitude > latitude) != (points[j].Latitude > latitude) &&
+				longitude < (points[j].Longitude-points[i].Longitude)*(latitude-points[i].Latitude)/
+					(points[j].Latitude-points[i].Latitude)+points[i].Longitude {
+				inside = !inside
+			}
+		}
+		return inside
+	}
+
+	return false
+}
+
+// Haversine distance between two points
+func distanceMeters(longitude1, latitude1, longitude2, latitude2 float64) float64 {
+	toRadians := func(degrees float64) float64 {
+		return degrees * math.Pi / 180
+	}
+
+	deltaLatitude := toRadians(latitude2 - latitude1)
+	deltaLongitude := toRadians(longitude2 - longitude1)
+
+	a := math.Sin(deltaLatitude/2)*math.Sin(deltaLatitude/2) +
+		math.Cos(toRadians(latitude1))*math.Cos(toRadians(latitude2))*math.Sin(deltaLongitude/2)*math.Sin(deltaLongitude/2)
+
+	return 2 * earthRadiusMeters * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
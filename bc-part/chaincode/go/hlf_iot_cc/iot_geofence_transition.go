@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/satori/go.uuid"
+)
+
+const (
+	iotGeofenceTransitionIndex = "IotGeofenceTransition"
+)
+
+const (
+	iotGeofenceTransitionKeyFieldsNumber      = 3
+	iotGeofenceTransitionBasicArgumentsNumber = 0
+	iotGeofenceTransitionSchemaVersion        = 2
+)
+
+var geofenceTransitionMeasurementFormats = map[string]MeasurementFormat{
+	"longitude": {measurementCoordinateScale, UnitDegree},
+	"latitude":  {measurementCoordinateScale, UnitDegree},
+}
+
+type iotGeofenceTransitionKey struct {
+	DeviceID   string `json:"deviceid"`
+	GeofenceID string `json:"geofenceid"`
+	ID         string `json:"id"`
+}
+
+type geofenceTransitionValue struct {
+	Action        string      `json:"action"`
+	GpsID         string      `json:"gpsid"`
+	Longitude     Measurement `json:"longitude"`
+	Latitude      Measurement `json:"latitude"`
+	Timestamp     int64       `json:"timestamp"`
+	SchemaVersion int         `json:"schemaversion"`
+}
+
+type GeofenceTransition struct {
+	Key   iotGeofenceTransitionKey `json:"key"`
+	Value geofenceTransitionValue  `json:"value"`
+}
+
+func CreateGeofenceTransition() LedgerData {
+	return new(GeofenceTransition)
+}
+
+// transitions are recorded by addIotGps only
+func (entity *GeofenceTransition) FillFromArguments(stub shim.ChaincodeStubInterface, args []string) error {
+	if len(args) < iotGeofenceTransitionBasicArgumentsNumber {
+		return errors.New(fmt.Sprintf("arguments array must contain at least %d items", iotGeofenceTransitionBasicArgumentsNumber))
+	}
+	return nil
+}
+
+func (entity *GeofenceTransition) FillFromCompositeKeyParts(compositeKeyParts []string) error {
+	if len(compositeKeyParts) < iotGeofenceTransitionKeyFieldsNumber {
+		return errors.New(fmt.Sprintf("composite key parts array must contain at least %d items", iotGeofenceTransitionKeyFieldsNumber))
+	}
+
+	if id, err := uuid.FromString(compositeKeyParts[2]); err != nil {
+		return errors.New(fmt.Sprintf("unable to parse an ID from \"%s\"", compositeKeyParts[2]))
+	} else if id.Version() != uuid.V4 {
+		return errors.New("wrong ID format; expected UUID version 4")
+	}
+
+	entity.Key.DeviceID = compositeKeyParts[0]
+	entity.Key.GeofenceID = compositeKeyParts[1]
+	entity.Key.ID = compositeKeyParts[2]
+
+	return nil
+}
+
+func (entity *GeofenceTransition) FillFromLedgerValue(ledgerValue []byte) error {
+	ledgerValue, err := UpcastLedgerValue(iotGeofenceTransitionIndex, ledgerValue)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(ledgerValue, &entity.Value); err != nil {
+		return err
+	} else {
+		return nil
+	}
+}
+
+func (entity *GeofenceTransition) ToCompositeKey(stub shim.ChaincodeStubInterface) (string, error) {
+	compositeKeyParts := []string{
+		entity.Key.DeviceID,
+		entity.Key.GeofenceID,
+		entity.Key.ID,
+	}
+
+	return stub.CreateCompositeKey(iotGeofenceTransitionIndex, compositeKeyParts)
+}
+
+func (entity *GeofenceTransition) ToLedgerValue() ([]byte, error) {
+	entity.Value.SchemaVersion = iotGeofenceTransitionSchemaVersion
+	return json.Marshal(entity.Value)
+}
+
+// CheckGeofences compares the reading against geofences assigned to the device,
+// records every boundary crossing and returns the event values to emit
+func CheckGeofences(stub shim.ChaincodeStubInterface, deviceID string, gps *Gps) ([]EventValue, error) {
+	return NewRuleChecker(stub).CheckGeofences(deviceID, gps)
+}
+
+func (checker *RuleChecker) CheckGeofences(deviceID string, gps *Gps) ([]EventValue, error) {
+	eventValues := []EventValue{}
+
+	geofences, err := checker.assignedGeofences(deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	longitude := gps.Value.Longitude.Float64()
+	latitude := gps.Value.Latitude.Float64()
+
+	for _, geofence := range geofences {
+		state, err := checker.geofenceState(deviceID, geofence.Key.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		// skipping readings older than the recorded state
+		if gps.Value.Timestamp < state.Timestamp {
+			continue
+		}
+
+		inside := geofence.Contains(longitude, latitude)
+		if inside == state.Inside {
+			continue
+		}
+		state.Inside = inside
+		state.Timestamp = gps.Value.Timestamp
+
+		u, err := uuid.NewV4()
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("unable to generate uuid: %s", err.Error()))
+		}
+
+		transition := GeofenceTransition{}
+		transition.Key.DeviceID = deviceID
+		transition.Key.GeofenceID = geofence.Key.ID
+		transition.Key.ID = u.String()
+		transition.Value.GpsID = gps.Key.ID
+		transition.Value.Longitude = gps.Value.Longitude
+		transition.Value.Latitude = gps.Value.Latitude
+		transition.Value.Timestamp = gps.Value.Timestamp
+		if inside {
+			transition.Value.Action = eventGeofenceEnter
+		} else {
+			transition.Value.Action = eventGeofenceExit
+		}
+
+		if err := UpdateOrInsertIn(checker.stub, &transition, iotGeofenceTransitionIndex, []string{""}, ""); err != nil {
+			return nil, err
+		}
+
+		eventValue := EventValue{}
+		eventValue.EntityType = iotGeofenceTransitionIndex
+		eventValue.EntityID = transition.Key.ID
+		eventValue.Other = transition
+		eventValue.Action = transition.Value.Action
+
+		eventValues = append(eventValues, eventValue)
+	}
+
+	return eventValues, nil
+}
@@ -16,19 +16,28 @@ const (
 const (
 	iotGpsKeyFieldsNumber      = 1
 	iotGpsBasicArgumentsNumber = 4
+	iotGpsSchemaVersion        = 4
 )
 
+var gpsMeasurementFormats = map[string]MeasurementFormat{
+	"longitude": {measurementCoordinateScale, UnitDegree},
+	"latitude":  {measurementCoordinateScale, UnitDegree},
+	"altitude":  {measurementScale, UnitMeter},
+}
+
 type iotGpsKey struct {
 	ID string `json:"id"`
 }
 
 type gpsValue struct {
-	Longitude   float32 `json:"longitude"`
-	Latitude    float32 `json:"latitude"`
-	Altitude    float32 `json:"altitude"`
-	CustomField string  `json:"customfield"`
-	Valid       byte    `json:"valid"`
-	Timestamp   int64   `json:"timestamp"`
+	Longitude   Measurement `json:"longitude"`
+	Latitude    Measurement `json:"latitude"`
+	Altitude    Measurement `json:"altitude"`
+	CustomField string      `json:"customfield"`
+	Submitter
+	Valid         byte  `json:"valid"`
+	Timestamp     int64 `json:"timestamp"`
+	SchemaVersion int   `json:"schemaversion"`
 }
 
 type Gps struct {
@@ -50,71 +59,78 @@ func (entity *Gps) FillFromArguments(stub shim.ChaincodeStubInterface, args []st
 
 	u, err := uuid.NewV4()
 	if err != nil {
-		return errors.New(fmt.Sprintf("unable to generate uuid: %s", err.Error()))
+		return InternalError(errors.New(fmt.Sprintf("unable to generate uuid: %s", err.Error())))
 	}
 	entity.Key.ID = u.String()
 
 	longitudeString := args[0]
 	if longitudeString == "" {
 		message := fmt.Sprintf("longitude must be not empty")
-		return errors.New(message)
+		return ArgumentError("longitude", errors.New(message))
 	}
 	// checking longitude
-	longitude, err := strconv.ParseFloat(longitudeString, 32)
+	longitude, err := ParseMeasurement(longitudeString, gpsMeasurementFormats["longitude"])
 	if err != nil {
-		return errors.New(fmt.Sprintf("unable to parse the longitude: %s", err.Error()))
+		return ArgumentError("longitude", errors.New(fmt.Sprintf("unable to parse the longitude: %s", err.Error())))
 	}
-	entity.Value.Longitude = float32(longitude)
+	entity.Value.Longitude = longitude
 
 	latitudeString := args[1]
 	if latitudeString == "" {
 		message := fmt.Sprintf("latitude must be not empty")
-		return errors.New(message)
+		return ArgumentError("latitude", errors.New(message))
 	}
 	// checking latitude
-	latitude, err := strconv.ParseFloat(latitudeString, 32)
+	latitude, err := ParseMeasurement(latitudeString, gpsMeasurementFormats["latitude"])
 	if err != nil {
-		return errors.New(fmt.Sprintf("unable to parse the latitude: %s", err.Error()))
+		return ArgumentError("latitude", errors.New(fmt.Sprintf("unable to parse the latitude: %s", err.Error())))
 	}
-	entity.Value.Latitude = float32(latitude)
+	entity.Value.Latitude = latitude
 
 	altitudeString := args[2]
 	if altitudeString == "" {
 		message := fmt.Sprintf("altitude must be not empty")
-		return errors.New(message)
+		return ArgumentError("altitude", errors.New(message))
 	}
 	// checking altitude
-	altitude, err := strconv.ParseFloat(altitudeString, 32)
+	altitude, err := ParseMeasurement(altitudeString, gpsMeasurementFormats["altitude"])
 	if err != nil {
-		return errors.New(fmt.Sprintf("unable to parse the altitude: %s", err.Error()))
+		return ArgumentError("altitude", errors.New(fmt.Sprintf("unable to parse the altitude: %s", err.Error())))
 	}
-	entity.Value.Altitude = float32(altitude)
+	entity.Value.Altitude = altitude
 
 	timestampString := args[3]
 	if timestampString == "" {
 		message := fmt.Sprintf("timestamp must be not empty")
-		return errors.New(message)
+		return ArgumentError("timestamp", errors.New(message))
 	}
 	timestamp, err := strconv.ParseInt(timestampString, 10, 64)
 	if err != nil {
-		return errors.New(fmt.Sprintf("unable to parse the timestamp: %s", err.Error()))
+		return ArgumentError("timestamp", errors.New(fmt.Sprintf("unable to parse the timestamp: %s", err.Error())))
 	}
 	if timestamp < 0 {
-		return errors.New("timestamp must be larger than zero")
+		return ArgumentError("timestamp", errors.New("timestamp must be larger than zero"))
 	}
 	entity.Value.Timestamp = int64(timestamp)
 
-	//get custom field from certificate
-	customField, err := GetCustomFieldFromCertificate(stub)
+	//get device identity from certificate
+	customField, err := GetDeviceID(stub)
 	if err != nil {
-		return errors.New(fmt.Sprintf("cannot obtain creator's custom field from the certificate: %s", err.Error()))
+		return IdentityError(errors.New(fmt.Sprintf("cannot obtain creator's device identity: %s", err.Error())))
 	}
 	entity.Value.CustomField = customField
 
+	//get submitter from certificate
+	submitter, err := GetSubmitter(stub)
+	if err != nil {
+		return InternalError(errors.New(fmt.Sprintf("cannot obtain creator's identity: %s", err.Error())))
+	}
+	entity.Value.Submitter = submitter
+
 	//check is certificate valid
 	valid, err := CheckCertificate(stub, "")
 	if err != nil {
-		return errors.New(fmt.Sprintf("cannot check the certificate: %s", err.Error()))
+		return InternalError(errors.New(fmt.Sprintf("cannot check the certificate: %s", err.Error())))
 	}
 	entity.Value.Valid = valid
 
@@ -138,6 +154,11 @@ func (entity *Gps) FillFromCompositeKeyParts(compositeKeyParts []string) error {
 }
 
 func (entity *Gps) FillFromLedgerValue(ledgerValue []byte) error {
+	ledgerValue, err := UpcastLedgerValue(iotGpsIndex, ledgerValue)
+	if err != nil {
+		return err
+	}
+
 	if err := json.Unmarshal(ledgerValue, &entity.Value); err != nil {
 		return err
 	} else {
@@ -154,5 +175,6 @@ func (entity *Gps) ToCompositeKey(stub shim.ChaincodeStubInterface) (string, err
 }
 
 func (entity *Gps) ToLedgerValue() ([]byte, error) {
+	entity.Value.SchemaVersion = iotGpsSchemaVersion
 	return json.Marshal(entity.Value)
 }
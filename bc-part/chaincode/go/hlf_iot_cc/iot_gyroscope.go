@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	"github.com/satori/go.uuid"
+	"math"
 	"strconv"
 )
 
@@ -16,28 +17,61 @@ const (
 const (
 	iotGyroscopeKeyFieldsNumber      = 1
 	iotGyroscopeBasicArgumentsNumber = 13
+	iotGyroscopeSchemaVersion        = 5
 )
 
+// acceleration above which a reading is a shock, unless it is set on Init
+var shockThresholdFormat = MeasurementFormat{measurementScale, UnitStandardGravity}
+var defaultShockThreshold = Measurement{2500000, measurementScale, UnitStandardGravity}
+
+var gyroscopeMeasurementFormats = map[string]MeasurementFormat{
+	"xout":                   {measurementScale, UnitLeastSignificantBit},
+	"xoutscaled":             {measurementScale, UnitDegreePerSecond},
+	"yout":                   {measurementScale, UnitLeastSignificantBit},
+	"youtscaled":             {measurementScale, UnitDegreePerSecond},
+	"zout":                   {measurementScale, UnitLeastSignificantBit},
+	"zoutscaled":             {measurementScale, UnitDegreePerSecond},
+	"accelerationxout":       {measurementScale, UnitLeastSignificantBit},
+	"accelerationxoutscaled": {measurementScale, UnitStandardGravity},
+	"accelerationyout":       {measurementScale, UnitLeastSignificantBit},
+	"accelerationyoutscaled": {measurementScale, UnitStandardGravity},
+	"accelerationZout":       {measurementScale, UnitLeastSignificantBit},
+	"accelerationZoutscaled": {measurementScale, UnitStandardGravity},
+}
+
+// computed at ingest from the scaled acceleration
+var gyroscopeDerivedMeasurementFormats = map[string]MeasurementFormat{
+	"pitch":                 {measurementScale, UnitDegree},
+	"roll":                  {measurementScale, UnitDegree},
+	"accelerationmagnitude": {measurementScale, UnitStandardGravity},
+}
+
 type iotGyroscopeKey struct {
 	ID string `json:"id"`
 }
 
 type gyroscopeValue struct {
-	Xout                   float32 `json:"xout"`
-	XoutScaled             float32 `json:"xoutscaled"`
-	Yout                   float32 `json:"yout"`
-	YoutScaled             float32 `json:"youtscaled"`
-	Zout                   float32 `json:"zout"`
-	ZoutScaled             float32 `json:"zoutscaled"`
-	AccelerationXout       float32 `json:"accelerationxout"`
-	AccelerationXoutScaled float32 `json:"accelerationxoutscaled"`
-	AccelerationYout       float32 `json:"accelerationyout"`
-	AccelerationYoutScaled float32 `json:"accelerationyoutscaled"`
-	AccelerationZout       float32 `json:"accelerationZout"`
-	AccelerationZoutScaled float32 `json:"accelerationZoutscaled"`
-	CustomField            string  `json:"customfield"`
-	Valid                  byte    `json:"valid"`
-	Timestamp              int64   `json:"timestamp"`
+	Xout                   Measurement `json:"xout"`
+	XoutScaled             Measurement `json:"xoutscaled"`
+	Yout                   Measurement `json:"yout"`
+	YoutScaled             Measurement `json:"youtscaled"`
+	Zout                   Measurement `json:"zout"`
+	ZoutScaled             Measurement `json:"zoutscaled"`
+	AccelerationXout       Measurement `json:"accelerationxout"`
+	AccelerationXoutScaled Measurement `json:"accelerationxoutscaled"`
+	AccelerationYout       Measurement `json:"accelerationyout"`
+	AccelerationYoutScaled Measurement `json:"accelerationyoutscaled"`
+	AccelerationZout       Measurement `json:"accelerationZout"`
+	AccelerationZoutScaled Measurement `json:"accelerationZoutscaled"`
+	Pitch                  Measurement `json:"pitch"`
+	Roll                   Measurement `json:"roll"`
+	AccelerationMagnitude  Measurement `json:"accelerationmagnitude"`
+	Shock                  bool        `json:"shock"`
+	CustomField            string      `json:"customfield"`
+	Submitter
+	Valid         byte  `json:"valid"`
+	Timestamp     int64 `json:"timestamp"`
+	SchemaVersion int   `json:"schemaversion"`
 }
 
 type Gyroscope struct {
@@ -59,179 +93,195 @@ func (entity *Gyroscope) FillFromArguments(stub shim.ChaincodeStubInterface, arg
 
 	u, err := uuid.NewV4()
 	if err != nil {
-		return errors.New(fmt.Sprintf("unable to generate uuid: %s", err.Error()))
+		return InternalError(errors.New(fmt.Sprintf("unable to generate uuid: %s", err.Error())))
 	}
 	entity.Key.ID = u.String()
 
 	xOutString := args[0]
 	if xOutString == "" {
 		message := fmt.Sprintf("xOut must be not empty")
-		return errors.New(message)
+		return ArgumentError("xout", errors.New(message))
 	}
 	// checking xout
-	xOut, err := strconv.ParseFloat(xOutString, 32)
+	xOut, err := ParseMeasurement(xOutString, gyroscopeMeasurementFormats["xout"])
 	if err != nil {
-		return errors.New(fmt.Sprintf("unable to parse the xOut: %s", err.Error()))
+		return ArgumentError("xout", errors.New(fmt.Sprintf("unable to parse the xOut: %s", err.Error())))
 	}
-	entity.Value.Xout = float32(xOut)
+	entity.Value.Xout = xOut
 
 	xOutScaledString := args[1]
 	if xOutScaledString == "" {
 		message := fmt.Sprintf("xOutScaled must be not empty")
-		return errors.New(message)
+		return ArgumentError("xoutScaled", errors.New(message))
 	}
 	// checking XoutScaled
-	xOutScaled, err := strconv.ParseFloat(xOutScaledString, 32)
+	xOutScaled, err := ParseMeasurement(xOutScaledString, gyroscopeMeasurementFormats["xoutscaled"])
 	if err != nil {
-		return errors.New(fmt.Sprintf("unable to parse the xOutScaled: %s", err.Error()))
+		return ArgumentError("xoutScaled", errors.New(fmt.Sprintf("unable to parse the xOutScaled: %s", err.Error())))
 	}
-	entity.Value.XoutScaled = float32(xOutScaled)
+	entity.Value.XoutScaled = xOutScaled
 
 	yOutString := args[2]
 	if yOutString == "" {
 		message := fmt.Sprintf("yOut must be not empty")
-		return errors.New(message)
+		return ArgumentError("yout", errors.New(message))
 	}
 	// checking yOut
-	yOut, err := strconv.ParseFloat(yOutString, 32)
+	yOut, err := ParseMeasurement(yOutString, gyroscopeMeasurementFormats["yout"])
 	if err != nil {
-		return errors.New(fmt.Sprintf("unable to parse the yOut: %s", err.Error()))
+		return ArgumentError("yout", errors.New(fmt.Sprintf("unable to parse the yOut: %s", err.Error())))
 	}
-	entity.Value.Yout = float32(yOut)
+	entity.Value.Yout = yOut
 
 	yOutScaledString := args[3]
 	if yOutScaledString == "" {
 		message := fmt.Sprintf("yOutScaled must be not empty")
-		return errors.New(message)
+		return ArgumentError("youtScaled", errors.New(message))
 	}
 	// checking yOutScaled
-	yOutScaled, err := strconv.ParseFloat(yOutScaledString, 32)
+	yOutScaled, err := ParseMeasurement(yOutScaledString, gyroscopeMeasurementFormats["youtscaled"])
 	if err != nil {
-		return errors.New(fmt.Sprintf("unable to parse the yOutScaled: %s", err.Error()))
+		return ArgumentError("youtScaled", errors.New(fmt.Sprintf("unable to parse the yOutScaled: %s", err.Error())))
 	}
-	entity.Value.YoutScaled = float32(yOutScaled)
+	entity.Value.YoutScaled = yOutScaled
 
 	zOutString := args[4]
 	if zOutString == "" {
 		message := fmt.Sprintf("zOut must be not empty")
-		return errors.New(message)
+		return ArgumentError("zout", errors.New(message))
 	}
 	// checking zOut
-	zOut, err := strconv.ParseFloat(zOutString, 32)
+	zOut, err := ParseMeasurement(zOutString, gyroscopeMeasurementFormats["zout"])
 	if err != nil {
-		return errors.New(fmt.Sprintf("unable to parse the zOut: %s", err.Error()))
+		return ArgumentError("zout", errors.New(fmt.Sprintf("unable to parse the zOut: %s", err.Error())))
 	}
-	entity.Value.Zout = float32(zOut)
+	entity.Value.Zout = zOut
 
 	zOutScaledString := args[5]
 	if zOutScaledString == "" {
 		message := fmt.Sprintf("zOutScaled must be not empty")
-		return errors.New(message)
+		return ArgumentError("zoutScaled", errors.New(message))
 	}
 	// checking zOutScaled
-	zOutScaled, err := strconv.ParseFloat(zOutScaledString, 32)
+	zOutScaled, err := ParseMeasurement(zOutScaledString, gyroscopeMeasurementFormats["zoutscaled"])
 	if err != nil {
-		return errors.New(fmt.Sprintf("unable to parse the zOutScaled: %s", err.Error()))
+		return ArgumentError("zoutScaled", errors.New(fmt.Sprintf("unable to parse the zOutScaled: %s", err.Error())))
 	}
-	entity.Value.ZoutScaled = float32(zOutScaled)
+	entity.Value.ZoutScaled = zOutScaled
 
 	accelerationXoutString := args[6]
 	if accelerationXoutString == "" {
 		message := fmt.Sprintf("accelerationXout must be not empty")
-		return errors.New(message)
+		return ArgumentError("accelerationXout", errors.New(message))
 	}
 	// checking accelerationXout
-	accelerationXout, err := strconv.ParseFloat(accelerationXoutString, 32)
+	accelerationXout, err := ParseMeasurement(accelerationXoutString, gyroscopeMeasurementFormats["accelerationxout"])
 	if err != nil {
-		return errors.New(fmt.Sprintf("unable to parse the accelerationXout: %s", err.Error()))
+		return ArgumentError("accelerationXout", errors.New(fmt.Sprintf("unable to parse the accelerationXout: %s", err.Error())))
 	}
-	entity.Value.AccelerationXout = float32(accelerationXout)
+	entity.Value.AccelerationXout = accelerationXout
 
 	accelerationXoutScaledString := args[7]
 	if accelerationXoutScaledString == "" {
 		message := fmt.Sprintf("accelerationXoutScaled must be not empty")
-		return errors.New(message)
+		return ArgumentError("accelerationXoutScaled", errors.New(message))
 	}
 	// checking accelerationXoutScaled
-	accelerationXoutScaled, err := strconv.ParseFloat(accelerationXoutScaledString, 32)
+	accelerationXoutScaled, err := ParseMeasurement(accelerationXoutScaledString, gyroscopeMeasurementFormats["accelerationxoutscaled"])
 	if err != nil {
-		return errors.New(fmt.Sprintf("unable to parse the accelerationXoutScaled: %s", err.Error()))
+		return ArgumentError("accelerationXoutScaled", errors.New(fmt.Sprintf("unable to parse the accelerationXoutScaled: %s", err.Error())))
 	}
-	entity.Value.AccelerationXoutScaled = float32(accelerationXoutScaled)
+	entity.Value.AccelerationXoutScaled = accelerationXoutScaled
 
 	accelerationYoutString := args[8]
 	if accelerationYoutString == "" {
 		message := fmt.Sprintf("accelerationYout must be not empty")
-		return errors.New(message)
+		return ArgumentError("accelerationYout", errors.New(message))
 	}
 	// checking accelerationXout
-	accelerationYout, err := strconv.ParseFloat(accelerationYoutString, 32)
+	accelerationYout, err := ParseMeasurement(accelerationYoutString, gyroscopeMeasurementFormats["accelerationyout"])
 	if err != nil {
-		return errors.New(fmt.Sprintf("unable to parse the accelerationYout: %s", err.Error()))
+		return ArgumentError("accelerationYout", errors.New(fmt.Sprintf("unable to parse the accelerationYout: %s", err.Error())))
 	}
-	entity.Value.AccelerationYout = float32(accelerationYout)
+	entity.Value.AccelerationYout = accelerationYout
 
 	accelerationYoutScaledString := args[9]
 	if accelerationYoutScaledString == "" {
 		message := fmt.Sprintf("accelerationYoutScaled must be not empty")
-		return errors.New(message)
+		return ArgumentError("accelerationYoutScaled", errors.New(message))
 	}
 	// checking accelerationYoutScaled
-	accelerationYoutScaled, err := strconv.ParseFloat(accelerationYoutScaledString, 32)
+	accelerationYoutScaled, err := ParseMeasurement(accelerationYoutScaledString, gyroscopeMeasurementFormats["accelerationyoutscaled"])
 	if err != nil {
-		return errors.New(fmt.Sprintf("unable to parse the accelerationYoutScaled: %s", err.Error()))
+		return ArgumentError("accelerationYoutScaled", errors.New(fmt.Sprintf("unable to parse the accelerationYoutScaled: %s", err.Error())))
 	}
-	entity.Value.AccelerationYoutScaled = float32(accelerationYoutScaled)
+	entity.Value.AccelerationYoutScaled = accelerationYoutScaled
 
 	accelerationZoutString := args[10]
 	if accelerationZoutString == "" {
 		message := fmt.Sprintf("accelerationZout must be not empty")
-		return errors.New(message)
+		return ArgumentError("accelerationZout", errors.New(message))
 	}
 	// checking accelerationZout
-	accelerationZout, err := strconv.ParseFloat(accelerationZoutString, 32)
+	accelerationZout, err := ParseMeasurement(accelerationZoutString, gyroscopeMeasurementFormats["accelerationZout"])
 	if err != nil {
-		return errors.New(fmt.Sprintf("unable to parse the accelerationZout: %s", err.Error()))
+		return ArgumentError("accelerationZout", errors.New(fmt.Sprintf("unable to parse the accelerationZout: %s", err.Error())))
 	}
-	entity.Value.AccelerationZout = float32(accelerationZout)
+	entity.Value.AccelerationZout = accelerationZout
 
 	accelerationZoutScaledString := args[11]
 	if accelerationZoutScaledString == "" {
 		message := fmt.Sprintf("accelerationZoutScaled must be not empty")
-		return errors.New(message)
+		return ArgumentError("accelerationZoutScaled", errors.New(message))
 	}
 	// checking accelerationZoutScaled
-	accelerationZoutScaled, err := strconv.ParseFloat(accelerationZoutScaledString, 32)
+	accelerationZoutScaled, err := ParseMeasurement(accelerationZoutScaledString, gyroscopeMeasurementFormats["accelerationZoutscaled"])
 	if err != nil {
-		return errors.New(fmt.Sprintf("unable to parse the accelerationZoutScaled: %s", err.Error()))
+		return ArgumentError("accelerationZoutScaled", errors.New(fmt.Sprintf("unable to parse the accelerationZoutScaled: %s", err.Error())))
 	}
-	entity.Value.AccelerationZoutScaled = float32(accelerationZoutScaled)
+	entity.Value.AccelerationZoutScaled = accelerationZoutScaled
 
 	timestampString := args[12]
 	if timestampString == "" {
 		message := fmt.Sprintf("timestamp must be not empty")
-		return errors.New(message)
+		return ArgumentError("timestamp", errors.New(message))
 	}
 	timestamp, err := strconv.ParseInt(timestampString, 10, 64)
 	if err != nil {
-		return errors.New(fmt.Sprintf("unable to parse the timestamp: %s", err.Error()))
+		return ArgumentError("timestamp", errors.New(fmt.Sprintf("unable to parse the timestamp: %s", err.Error())))
 	}
 	if timestamp < 0 {
-		return errors.New("timestamp must be larger than zero")
+		return ArgumentError("timestamp", errors.New("timestamp must be larger than zero"))
 	}
 	entity.Value.Timestamp = int64(timestamp)
 
-	//get custom field from certificate
-	customField, err := GetCustomFieldFromCertificate(stub)
+	//computing orientation and shock
+	threshold, err := GetShockThreshold(stub)
 	if err != nil {
-		return errors.New(fmt.Sprintf("cannot obtain creator's custom field from the certificate: %s", err.Error()))
+		return InternalError(errors.New(fmt.Sprintf("cannot obtain the shock threshold: %s", err.Error())))
+	}
+	if err := entity.Value.Derive(threshold); err != nil {
+		return ArgumentError("timestamp", err)
+	}
+
+	//get device identity from certificate
+	customField, err := GetDeviceID(stub)
+	if err != nil {
+		return IdentityError(errors.New(fmt.Sprintf("cannot obtain creator's device identity: %s", err.Error())))
 	}
 	entity.Value.CustomField = customField
 
+	//get submitter from certificate
+	submitter, err := GetSubmitter(stub)
+	if err != nil {
+		return InternalError(errors.New(fmt.Sprintf("cannot obtain creator's identity: %s", err.Error())))
+	}
+	entity.Value.Submitter = submitter
+
 	//check is certificate valid
 	valid, err := CheckCertificate(stub, "")
 	if err != nil {
-		return errors.New(fmt.Sprintf("cannot check the certificate: %s", err.Error()))
+		return InternalError(errors.New(fmt.Sprintf("cannot check the certificate: %s", err.Error())))
 	}
 	entity.Value.Valid = valid
 
@@ -255,6 +305,11 @@ func (entity *Gyroscope) FillFromCompositeKeyParts(compositeKeyParts []string) e
 }
 
 func (entity *Gyroscope) FillFromLedgerValue(ledgerValue []byte) error {
+	ledgerValue, err := UpcastLedgerValue(iotGyroscopeIndex, ledgerValue)
+	if err != nil {
+		return err
+	}
+
 	if err := json.Unmarshal(ledgerValue, &entity.Value); err != nil {
 		return err
 	} else {
@@ -271,5 +326,60 @@ func (entity *Gyroscope) ToCompositeKey(stub shim.ChaincodeStubInterface) (strin
 }
 
 func (entity *Gyroscope) ToLedgerValue() ([]byte, error) {
+	entity.Value.SchemaVersion = iotGyroscopeSchemaVersion
 	return json.Marshal(entity.Value)
 }
+
+// Derive computes pitch and roll from the gravity vector in degrees, the magnitude of the acceleration in g
+// and flags the reading as a shock when the magnitude exceeds the threshold
+func (value *gyroscopeValue) Derive(threshold Measurement) error {
+	x := value.AccelerationXoutScaled.Float64()
+	y := value.AccelerationYoutScaled.Float64()
+	z := value.AccelerationZoutScaled.Float64()
+
+	pitch, err := measurementFromFloat64(math.Atan2(-x, math.Sqrt(y*y+z*z))*180/math.Pi, gyroscopeDerivedMeasurementFormats["pitch"])
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to compute the pitch: %s", err.Error()))
+	}
+	value.Pitch = pitch
+
+	roll, err := measurementFromFloat64(math.Atan2(y, z)*180/math.Pi, gyroscopeDerivedMeasurementFormats["roll"])
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to compute the roll: %s", err.Error()))
+	}
+	value.Roll = roll
+
+	magnitude, err := measurementFromFloat64(math.Sqrt(x*x+y*y+z*z), gyroscopeDerivedMeasurementFormats["accelerationmagnitude"])
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to compute the acceleration magnitude: %s", err.Error()))
+	}
+	value.AccelerationMagnitude = magnitude
+
+	value.Shock = magnitude.Rat().Cmp(threshold.Rat()) > 0
+
+	return nil
+}
+
+// upcastGyroscopeDerivedMetrics computes the metrics of readings stored before they were derived at ingest.
+// The configured threshold cannot be read here, so these readings are flagged with the default one
+func upcastGyroscopeDerivedMetrics(value map[string]interface{}) error {
+	valueBytes, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	gyroscope := gyroscopeValue{}
+	if err := json.Unmarshal(valueBytes, &gyroscope); err != nil {
+		return err
+	}
+	if err := gyroscope.Derive(defaultShockThreshold); err != nil {
+		return err
+	}
+
+	value["pitch"] = gyroscope.Pitch
+	value["roll"] = gyroscope.Roll
+	value["accelerationmagnitude"] = gyroscope.AccelerationMagnitude
+	value["shock"] = gyroscope.Shock
+
+	return nil
+}
@@ -16,18 +16,26 @@ const (
 const (
 	iotHumidityKeyFieldsNumber      = 1
 	iotHumidityBasicArgumentsNumber = 3
+	iotHumiditySchemaVersion        = 4
 )
 
+var humidityMeasurementFormats = map[string]MeasurementFormat{
+	"humidity":    {measurementScale, UnitRelativeHumidity},
+	"temperature": {measurementScale, UnitCelsius},
+}
+
 type iotHumidityKey struct {
 	ID string `json:"id"`
 }
 
 type humidityValue struct {
-	Humidity    float32 `json:"humidity"`
-	Temperature float32 `json:"temperature"`
-	CustomField string  `json:"customfield"`
-	Valid       byte    `json:"valid"`
-	Timestamp   int64   `json:"timestamp"`
+	Humidity    Measurement `json:"humidity"`
+	Temperature Measurement `json:"temperature"`
+	CustomField string      `json:"customfield"`
+	Submitter
+	Valid         byte  `json:"valid"`
+	Timestamp     int64 `json:"timestamp"`
+	SchemaVersion int   `json:"schemaversion"`
 }
 
 type Humidity struct {
@@ -49,59 +57,66 @@ func (entity *Humidity) FillFromArguments(stub shim.ChaincodeStubInterface, args
 
 	u, err := uuid.NewV4()
 	if err != nil {
-		return errors.New(fmt.Sprintf("unable to generate uuid: %s", err.Error()))
+		return InternalError(errors.New(fmt.Sprintf("unable to generate uuid: %s", err.Error())))
 	}
 	entity.Key.ID = u.String()
 
 	humidityString := args[0]
 	if humidityString == "" {
 		message := fmt.Sprintf("humidity must be not empty")
-		return errors.New(message)
+		return ArgumentError("humidity", errors.New(message))
 	}
 	// checking humidity
-	humidity, err := strconv.ParseFloat(humidityString, 32)
+	humidity, err := ParseMeasurement(humidityString, humidityMeasurementFormats["humidity"])
 	if err != nil {
-		return errors.New(fmt.Sprintf("unable to parse the humidity: %s", err.Error()))
+		return ArgumentError("humidity", errors.New(fmt.Sprintf("unable to parse the humidity: %s", err.Error())))
 	}
-	entity.Value.Humidity = float32(humidity)
+	entity.Value.Humidity = humidity
 
 	temperatureString := args[1]
 	if temperatureString == "" {
 		message := fmt.Sprintf("temperature must be not empty")
-		return errors.New(message)
+		return ArgumentError("temperature", errors.New(message))
 	}
 	// checking temperature
-	temperature, err := strconv.ParseFloat(temperatureString, 32)
+	temperature, err := ParseMeasurement(temperatureString, humidityMeasurementFormats["temperature"])
 	if err != nil {
-		return errors.New(fmt.Sprintf("unable to parse the temperature: %s", err.Error()))
+		return ArgumentError("temperature", errors.New(fmt.Sprintf("unable to parse the temperature: %s", err.Error())))
 	}
-	entity.Value.Temperature = float32(temperature)
+	entity.Value.Temperature = temperature
 
 	timestampString := args[2]
 	if timestampString == "" {
 		message := fmt.Sprintf("timestamp must be not empty")
-		return errors.New(message)
+		return ArgumentError("timestamp", errors.New(message))
 	}
 	timestamp, err := strconv.ParseInt(timestampString, 10, 64)
 	if err != nil {
-		return errors.New(fmt.Sprintf("unable to parse the timestamp: %s", err.Error()))
+		return ArgumentError("timestamp", errors.New(fmt.Sprintf("unable to parse the timestamp: %s", err.Error())))
 	}
 	if timestamp < 0 {
-		return errors.New("timestamp must be larger than zero")
+		return ArgumentError("timestamp", errors.New("timestamp must be larger than zero"))
 	}
 	entity.Value.Timestamp = int64(timestamp)
 
-	//get custom field from certificate
-	customField, err := GetCustomFieldFromCertificate(stub)
+	//get device identity from certificate
+	customField, err := GetDeviceID(stub)
 	if err != nil {
-		return errors.New(fmt.Sprintf("cannot obtain creator's custom field from the certificate: %s", err.Error()))
+		return IdentityError(errors.New(fmt.Sprintf("cannot obtain creator's device identity: %s", err.Error())))
 	}
 	entity.Value.CustomField = customField
 
+	//get submitter from certificate
+	submitter, err := GetSubmitter(stub)
+	if err != nil {
+		return InternalError(errors.New(fmt.Sprintf("cannot obtain creator's identity: %s", err.Error())))
+	}
+	entity.Value.Submitter = submitter
+
 	//check is certificate valid
 	valid, err := CheckCertificate(stub, "")
 	if err != nil {
-		return errors.New(fmt.Sprintf("cannot check the certificate: %s", err.Error()))
+		return InternalError(errors.New(fmt.Sprintf("cannot check the certificate: %s", err.Error())))
 	}
 	entity.Value.Valid = valid
 
@@ -125,6 +140,11 @@ func (entity *Humidity) FillFromCompositeKeyParts(compositeKeyParts []string) er
 }
 
 func (entity *Humidity) FillFromLedgerValue(ledgerValue []byte) error {
+	ledgerValue, err := UpcastLedgerValue(iotHumidityIndex, ledgerValue)
+	if err != nil {
+		return err
+	}
+
 	if err := json.Unmarshal(ledgerValue, &entity.Value); err != nil {
 		return err
 	} else {
@@ -141,5 +161,6 @@ func (entity *Humidity) ToCompositeKey(stub shim.ChaincodeStubInterface) (string
 }
 
 func (entity *Humidity) ToLedgerValue() ([]byte, error) {
+	entity.Value.SchemaVersion = iotHumiditySchemaVersion
 	return json.Marshal(entity.Value)
 }
@@ -16,6 +16,7 @@ const (
 const (
 	iotLightKeyFieldsNumber      = 1
 	iotLightBasicArgumentsNumber = 2
+	iotLightSchemaVersion        = 3
 )
 
 type iotLightKey struct {
@@ -25,8 +26,10 @@ type iotLightKey struct {
 type lightValue struct {
 	Light       uint   `json:"light"`
 	CustomField string `json:"customfield"`
-	Valid       byte   `json:"valid"`
-	Timestamp   int64  `json:"timestamp"`
+	Submitter
+	Valid         byte  `json:"valid"`
+	Timestamp     int64 `json:"timestamp"`
+	SchemaVersion int   `json:"schemaversion"`
 }
 
 type Light struct {
@@ -48,47 +51,54 @@ func (entity *Light) FillFromArguments(stub shim.ChaincodeStubInterface, args []
 
 	u, err := uuid.NewV4()
 	if err != nil {
-		return errors.New(fmt.Sprintf("unable to generate uuid: %s", err.Error()))
+		return InternalError(errors.New(fmt.Sprintf("unable to generate uuid: %s", err.Error())))
 	}
 	entity.Key.ID = u.String()
 
 	lightString := args[0]
 	if lightString == "" {
 		message := fmt.Sprintf("light must be not empty")
-		return errors.New(message)
+		return ArgumentError("light", errors.New(message))
 	}
 	// checking light
 	light, err := strconv.ParseUint(lightString, 10, 32)
 	if err != nil {
-		return errors.New(fmt.Sprintf("unable to parse the light: %s", err.Error()))
+		return ArgumentError("light", errors.New(fmt.Sprintf("unable to parse the light: %s", err.Error())))
 	}
 	entity.Value.Light = uint(light)
 
 	timestampString := args[1]
 	if timestampString == "" {
 		message := fmt.Sprintf("timestamp must be not empty")
-		return errors.New(message)
+		return ArgumentError("timestamp", errors.New(message))
 	}
 	timestamp, err := strconv.ParseInt(timestampString, 10, 64)
 	if err != nil {
-		return errors.New(fmt.Sprintf("unable to parse the timestamp: %s", err.Error()))
+		return ArgumentError("timestamp", errors.New(fmt.Sprintf("unable to parse the timestamp: %s", err.Error())))
 	}
 	if timestamp < 0 {
-		return errors.New("timestamp must be larger than zero")
+		return ArgumentError("timestamp", errors.New("timestamp must be larger than zero"))
 	}
 	entity.Value.Timestamp = int64(timestamp)
 
-	//get custom field from certificate
-	customField, err := GetCustomFieldFromCertificate(stub)
+	//get device identity from certificate
+	customField, err := GetDeviceID(stub)
 	if err != nil {
-		return errors.New(fmt.Sprintf("cannot obtain creator's custom field from the certificate: %s", err.Error()))
+		return IdentityError(errors.New(fmt.Sprintf("cannot obtain creator's device identity: %s", err.Error())))
 	}
 	entity.Value.CustomField = customField
 
+	//get submitter from certificate
+	submitter, err := GetSubmitter(stub)
+	if err != nil {
+		return InternalError(errors.New(fmt.Sprintf("cannot obtain creator's identity: %s", err.Error())))
+	}
+	entity.Value.Submitter = submitter
+
 	//check is certificate valid
 	valid, err := CheckCertificate(stub, "")
 	if err != nil {
-		return errors.New(fmt.Sprintf("cannot check the certificate: %s", err.Error()))
+		return InternalError(errors.New(fmt.Sprintf("cannot check the certificate: %s", err.Error())))
 	}
 	entity.Value.Valid = valid
 
@@ -112,6 +122,11 @@ func (entity *Light) FillFromCompositeKeyParts(compositeKeyParts []string) error
 }
 
 func (entity *Light) FillFromLedgerValue(ledgerValue []byte) error {
+	ledgerValue, err := UpcastLedgerValue(iotLightIndex, ledgerValue)
+	if err != nil {
+		return err
+	}
+
 	if err := json.Unmarshal(ledgerValue, &entity.Value); err != nil {
 		return err
 	} else {
@@ -128,5 +143,6 @@ func (entity *Light) ToCompositeKey(stub shim.ChaincodeStubInterface) (string, e
 }
 
 func (entity *Light) ToLedgerValue() ([]byte, error) {
+	entity.Value.SchemaVersion = iotLightSchemaVersion
 	return json.Marshal(entity.Value)
 }
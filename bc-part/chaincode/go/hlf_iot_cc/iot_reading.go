@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/satori/go.uuid"
+	"strconv"
+)
+
+const (
+	iotReadingIndex = "IotReading"
+)
+
+const (
+	iotReadingKeyFieldsNumber      = 2
+	iotReadingBasicArgumentsNumber = 3
+	iotReadingSchemaVersion        = 1
+)
+
+type iotReadingKey struct {
+	SensorType string `json:"sensortype"`
+	ID         string `json:"id"`
+}
+
+// values are split by the type of their fields in the sensor type
+type readingValue struct {
+	Measurements map[string]Measurement `json:"measurements"`
+	Flags        map[string]bool        `json:"flags"`
+	Labels       map[string]string      `json:"labels"`
+	CustomField  string                 `json:"customfield"`
+	Submitter
+	Valid         byte  `json:"valid"`
+	Timestamp     int64 `json:"timestamp"`
+	SchemaVersion int   `json:"schemaversion"`
+}
+
+// Reading is a reading of a sensor type registered at runtime
+type Reading struct {
+	Key   iotReadingKey `json:"key"`
+	Value readingValue  `json:"value"`
+}
+
+func CreateReading() LedgerData {
+	return new(Reading)
+}
+
+//argument order
+//0				1		2
+//SensorType	Values	Timestamp
+func (entity *Reading) FillFromArguments(stub shim.ChaincodeStubInterface, args []string) error {
+	if len(args) < iotReadingBasicArgumentsNumber {
+		return errors.New(fmt.Sprintf("arguments array must contain at least %d items", iotReadingBasicArgumentsNumber))
+	}
+
+	u, err := uuid.NewV4()
+	if err != nil {
+		return InternalError(errors.New(fmt.Sprintf("unable to generate uuid: %s", err.Error())))
+	}
+
+	if err := entity.FillFromCompositeKeyParts([]string{args[0], u.String()}); err != nil {
+		return ArgumentError("sensorType", err)
+	}
+
+	// checking values against the sensor type
+	sensorType, err := GetSensorType(stub, args[0])
+	if err != nil {
+		return ArgumentError("sensorType", err)
+	}
+	entity.Value.Measurements, entity.Value.Flags, entity.Value.Labels, err = sensorType.ParseValues(args[1])
+	if err != nil {
+		return ArgumentError("values", err)
+	}
+
+	timestampString := args[2]
+	if timestampString == "" {
+		message := fmt.Sprintf("timestamp must be not empty")
+		return ArgumentError("timestamp", errors.New(message))
+	}
+	timestamp, err := strconv.ParseInt(timestampString, 10, 64)
+	if err != nil {
+		return ArgumentError("timestamp", errors.New(fmt.Sprintf("unable to parse the timestamp: %s", err.Error())))
+	}
+	if timestamp < 0 {
+		return ArgumentError("timestamp", errors.New("timestamp must be larger than zero"))
+	}
+	entity.Value.Timestamp = int64(timestamp)
+
+	//get device identity from certificate
+	customField, err := GetDeviceID(stub)
+	if err != nil {
+		return IdentityError(errors.New(fmt.Sprintf("cannot obtain creator's device identity: %s", err.Error())))
+	}
+	entity.Value.CustomField = customField
+
+	//get submitter from certificate
+	submitter, err := GetSubmitter(stub)
+	if err != nil {
+		return InternalError(errors.New(fmt.Sprintf("cannot obtain creator's identity: %s", err.Error())))
+	}
+	entity.Value.Submitter = submitter
+
+	//check is certificate valid
+	valid, err := CheckCertificate(stub, "")
+	if err != nil {
+		return InternalError(errors.New(fmt.Sprintf("cannot check the certificate: %s", err.Error())))
+	}
+	entity.Value.Valid = valid
+
+	return nil
+}
+
+func (entity *Reading) FillFromCompositeKeyParts(compositeKeyParts []string) error {
+	if len(compositeKeyParts) < iotReadingKeyFieldsNumber {
+		return errors.New(fmt.Sprintf("composite key parts array must contain at least %d items", iotReadingKeyFieldsNumber))
+	}
+
+	if compositeKeyParts[0] == "" {
+		return errors.New("sensor type must be not empty")
+	}
+
+	if id, err := uuid.FromString(compositeKeyParts[1]); err != nil {
+		return errors.New(fmt.Sprintf("unable to parse an ID from \"%s\"", compositeKeyParts[1]))
+	} else if id.Version() != uuid.V4 {
+		return errors.New("wrong ID format; expected UUID version 4")
+	}
+
+	entity.Key.SensorType = compositeKeyParts[0]
+	entity.Key.ID = compositeKeyParts[1]
+
+	return nil
+}
+
+func (entity *Reading) FillFromLedgerValue(ledgerValue []byte) error {
+	ledgerValue, err := UpcastLedgerValue(iotReadingIndex, ledgerValue)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(ledgerValue, &entity.Value); err != nil {
+		return err
+	} else {
+		return nil
+	}
+}
+
+func (entity *Reading) ToCompositeKey(stub shim.ChaincodeStubInterface) (string, error) {
+	compositeKeyParts := []string{
+		entity.Key.SensorType,
+		entity.Key.ID,
+	}
+
+	return stub.CreateCompositeKey(iotReadingIndex, compositeKeyParts)
+}
+
+func (entity *Reading) ToLedgerValue() ([]byte, error) {
+	entity.Value.SchemaVersion = iotReadingSchemaVersion
+	return json.Marshal(entity.Value)
+}
@@ -16,6 +16,7 @@ const (
 const (
 	iotVibrationKeyFieldsNumber      = 1
 	iotVibrationBasicArgumentsNumber = 2
+	iotVibrationSchemaVersion        = 3
 )
 
 type iotVibrationKey struct {
@@ -25,8 +26,10 @@ type iotVibrationKey struct {
 type vibrationValue struct {
 	Vibration   uint   `json:"vibration"`
 	CustomField string `json:"customfield"`
-	Valid       byte   `json:"valid"`
-	Timestamp   int64  `json:"timestamp"`
+	Submitter
+	Valid         byte  `json:"valid"`
+	Timestamp     int64 `json:"timestamp"`
+	SchemaVersion int   `json:"schemaversion"`
 }
 
 type Vibration struct {
@@ -48,47 +51,54 @@ func (entity *Vibration) FillFromArguments(stub shim.ChaincodeStubInterface, arg
 
 	u, err := uuid.NewV4()
 	if err != nil {
-		return errors.New(fmt.Sprintf("unable to generate uuid: %s", err.Error()))
+		return InternalError(errors.New(fmt.Sprintf("unable to generate uuid: %s", err.Error())))
 	}
 	entity.Key.ID = u.String()
 
 	vibrationString := args[0]
 	if vibrationString == "" {
 		message := fmt.Sprintf("vibration must be not empty")
-		return errors.New(message)
+		return ArgumentError("vibration", errors.New(message))
 	}
 	// checking vibration
 	vibration, err := strconv.ParseUint(vibrationString, 10, 32)
 	if err != nil {
-		return errors.New(fmt.Sprintf("unable to parse the vibration: %s", err.Error()))
+		return ArgumentError("vibration", errors.New(fmt.Sprintf("unable to parse the vibration: %s", err.Error())))
 	}
 	entity.Value.Vibration = uint(vibration)
 
 	timestampString := args[1]
 	if timestampString == "" {
 		message := fmt.Sprintf("timestamp must be not empty")
-		return errors.New(message)
+		return ArgumentError("timestamp", errors.New(message))
 	}
 	timestamp, err := strconv.ParseInt(timestampString, 10, 64)
 	if err != nil {
-		return errors.New(fmt.Sprintf("unable to parse the timestamp: %s", err.Error()))
+		return ArgumentError("timestamp", errors.New(fmt.Sprintf("unable to parse the timestamp: %s", err.Error())))
 	}
 	if timestamp < 0 {
-		return errors.New("timestamp must be larger than zero")
+		return ArgumentError("timestamp", errors.New("timestamp must be larger than zero"))
 	}
 	entity.Value.Timestamp = int64(timestamp)
 
-	//get custom field from certificate
-	customField, err := GetCustomFieldFromCertificate(stub)
+	//get device identity from certificate
+	customField, err := GetDeviceID(stub)
 	if err != nil {
-		return errors.New(fmt.Sprintf("cannot obtain creator's custom field from the certificate: %s", err.Error()))
+		return IdentityError(errors.New(fmt.Sprintf("cannot obtain creator's device identity: %s", err.Error())))
 	}
 	entity.Value.CustomField = customField
 
+	//get submitter from certificate
+	submitter, err := GetSubmitter(stub)
+	if err != nil {
+		return InternalError(errors.New(fmt.Sprintf("cannot obtain creator's identity: %s", err.Error())))
+	}
+	entity.Value.Submitter = submitter
+
 	//check is certificate valid
 	valid, err := CheckCertificate(stub, "")
 	if err != nil {
-		return errors.New(fmt.Sprintf("cannot check the certificate: %s", err.Error()))
+		return InternalError(errors.New(fmt.Sprintf("cannot check the certificate: %s", err.Error())))
 	}
 	entity.Value.Valid = valid
 
@@ -112,6 +122,11 @@ func (entity *Vibration) FillFromCompositeKeyParts(compositeKeyParts []string) e
 }
 
 func (entity *Vibration) FillFromLedgerValue(ledgerValue []byte) error {
+	ledgerValue, err := UpcastLedgerValue(iotVibrationIndex, ledgerValue)
+	if err != nil {
+		return err
+	}
+
 	if err := json.Unmarshal(ledgerValue, &entity.Value); err != nil {
 		return err
 	} else {
@@ -128,5 +143,6 @@ func (entity *Vibration) ToCompositeKey(stub shim.ChaincodeStubInterface) (strin
 }
 
 func (entity *Vibration) ToLedgerValue() ([]byte, error) {
+	entity.Value.SchemaVersion = iotVibrationSchemaVersion
 	return json.Marshal(entity.Value)
 }
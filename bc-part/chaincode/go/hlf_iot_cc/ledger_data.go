@@ -2,12 +2,14 @@ package main
 
 import (
 	"crypto/sha1"
+	"crypto/sha256"
 	"crypto/x509"
 	"encoding/hex"
 	"encoding/json"
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"github.com/hyperledger/fabric/common/attrmgr"
 	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	"github.com/hyperledger/fabric/core/chaincode/shim/ext/statebased"
@@ -110,6 +112,35 @@ func LoadFrom(stub shim.ChaincodeStubInterface, data LedgerData, index string) e
 	return data.FillFromLedgerValue(bytes)
 }
 
+func DeleteFrom(stub shim.ChaincodeStubInterface, data LedgerData, index string) error {
+	compositeKey, err := data.ToCompositeKey(stub)
+	if err != nil {
+		return err
+	}
+
+	collections, err := GetCollectionName(stub, index, []string{""})
+	if err != nil {
+		message := fmt.Sprintf("cannot get collection name from config: %s", err.Error())
+		return errors.New(message)
+	}
+
+	if len(collections) != 0 && collections[0] != "" {
+		for _, collectionName := range collections {
+			Logger.Debug(fmt.Sprintf("DelPrivateData. collectionName: %s", collectionName))
+			if err = stub.DelPrivateData(collectionName, compositeKey); err != nil {
+				return err
+			}
+		}
+	} else {
+		Logger.Debug("DelState")
+		if err = stub.DelState(compositeKey); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func UpdateOrInsertIn(stub shim.ChaincodeStubInterface, data LedgerData, index string, participiants []string, endorserRoleType statebased.RoleType) error {
 	compositeKey, err := data.ToCompositeKey(stub)
 	if err != nil {
@@ -160,6 +191,127 @@ func EmptyFilter(data LedgerData) bool {
 	return true
 }
 
+// ListOptions are passed to listIot* functions as a JSON object in the first argument
+type ListOptions struct {
+	Corrected    bool   `json:"corrected"`
+	MSPID        string `json:"mspid"`
+	EnrollmentID string `json:"enrollmentid"`
+	Fingerprint  string `json:"fingerprint"`
+	Owner        string `json:"owner"`
+	// set by the list functions from the creator's MSP, never by the caller
+	Access *DataAccess `json:"-"`
+}
+
+func ParseListOptions(args []string) (ListOptions, error) {
+	options := ListOptions{}
+	if len(args) == 0 || args[0] == "" {
+		return options, nil
+	}
+
+	if err := json.Unmarshal([]byte(args[0]), &options); err != nil {
+		return options, errors.New(fmt.Sprintf("cannot unmarshaling list options: %s", err.Error()))
+	}
+
+	return options, nil
+}
+
+// Filter keeps readings submitted by the identity set in the options
+func (options ListOptions) Filter(data LedgerData) bool {
+	submitter := readingSubmitter(data)
+
+	return (options.Access == nil || options.Access.Filter(data)) &&
+		(options.MSPID == "" || options.MSPID == submitter.MSPID) &&
+		(options.EnrollmentID == "" || options.EnrollmentID == submitter.EnrollmentID) &&
+		(options.Fingerprint == "" || options.Fingerprint == submitter.Fingerprint) &&
+		(options.Owner == "" || options.Owner == submitter.Owner)
+}
+
+func readingSubmitter(data LedgerData) Submitter {
+	switch entry := data.(type) {
+	case *Humidity:
+		return entry.Value.Submitter
+	case *Barometer:
+		return entry.Value.Submitter
+	case *Vibration:
+		return entry.Value.Submitter
+	case *Light:
+		return entry.Value.Submitter
+	case *Gyroscope:
+		return entry.Value.Submitter
+	case *Gps:
+		return entry.Value.Submitter
+	case *Reading:
+		return entry.Value.Submitter
+	}
+
+	return Submitter{}
+}
+
+func readingID(data LedgerData) string {
+	switch entry := data.(type) {
+	case *Humidity:
+		return entry.Key.ID
+	case *Barometer:
+		return entry.Key.ID
+	case *Vibration:
+		return entry.Key.ID
+	case *Light:
+		return entry.Key.ID
+	case *Gyroscope:
+		return entry.Key.ID
+	case *Gps:
+		return entry.Key.ID
+	case *Reading:
+		return entry.Key.ID
+	}
+
+	return ""
+}
+
+// readingDevice returns the device ID and the device timestamp of a reading
+func readingDevice(data LedgerData) (string, int64) {
+	switch entry := data.(type) {
+	case *Humidity:
+		return entry.Value.CustomField, entry.Value.Timestamp
+	case *Barometer:
+		return entry.Value.CustomField, entry.Value.Timestamp
+	case *Vibration:
+		return entry.Value.CustomField, entry.Value.Timestamp
+	case *Light:
+		return entry.Value.CustomField, entry.Value.Timestamp
+	case *Gyroscope:
+		return entry.Value.CustomField, entry.Value.Timestamp
+	case *Gps:
+		return entry.Value.CustomField, entry.Value.Timestamp
+	case *Reading:
+		return entry.Value.CustomField, entry.Value.Timestamp
+	}
+
+	return "", 0
+}
+
+// readingTrusted reports whether a reading was sent with a certificate valid at the time
+func readingTrusted(data LedgerData) bool {
+	switch entry := data.(type) {
+	case *Humidity:
+		return entry.Value.Valid == 1
+	case *Barometer:
+		return entry.Value.Valid == 1
+	case *Vibration:
+		return entry.Value.Valid == 1
+	case *Light:
+		return entry.Value.Valid == 1
+	case *Gyroscope:
+		return entry.Value.Valid == 1
+	case *Gps:
+		return entry.Value.Valid == 1
+	case *Reading:
+		return entry.Value.Valid == 1
+	}
+
+	return false
+}
+
 func Query(stub shim.ChaincodeStubInterface, index string, partialKey []string,
 	createEntry FactoryMethod, filterEntry FilterFunction) ([]byte, error) {
 
@@ -192,6 +344,138 @@ func Query(stub shim.ChaincodeStubInterface, index string, partialKey []string,
 	return result, nil
 }
 
+// IndexEntry is a key of a secondary index; the indexed data is in the key parts
+type IndexEntry struct {
+	Key      string
+	KeyParts []string
+	Value    []byte
+}
+
+// putIndexEntry writes a secondary index key; an empty value is stored as a zero byte,
+// since writing an empty value deletes the key
+func putIndexEntry(stub shim.ChaincodeStubInterface, index string, keyParts []string, value string) error {
+	compositeKey, err := stub.CreateCompositeKey(index, keyParts)
+	if err != nil {
+		return err
+	}
+
+	bytes := []byte(value)
+	if len(bytes) == 0 {
+		bytes = []byte{0x00}
+	}
+
+	return stub.PutState(compositeKey, bytes)
+}
+
+func deleteIndexEntry(stub shim.ChaincodeStubInterface, index string, keyParts []string) error {
+	compositeKey, err := stub.CreateCompositeKey(index, keyParts)
+	if err != nil {
+		return err
+	}
+
+	return stub.DelState(compositeKey)
+}
+
+func getIndexEntries(stub shim.ChaincodeStubInterface, index string, partialKey []string) ([]IndexEntry, error) {
+	it, err := stub.GetStateByPartialCompositeKey(index, partialKey)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to get state by partial composite key %s: %s", index, err.Error()))
+	}
+	defer it.Close()
+
+	entries := []IndexEntry{}
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("unable to get an element next to a query iterator: %s", err.Error()))
+		}
+
+		_, keyParts, err := stub.SplitCompositeKey(response.Key)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, IndexEntry{response.Key, keyParts, response.Value})
+	}
+
+	return entries, nil
+}
+
+type PaginatedResult struct {
+	Records             []LedgerData `json:"records"`
+	FetchedRecordsCount int32        `json:"fetchedrecordscount"`
+	Bookmark            string       `json:"bookmark"`
+}
+
+func QueryResultWithPagination(stub shim.ChaincodeStubInterface, query string, pageSize int32, bookmark string,
+	createEntry FactoryMethod, filterEntry FilterFunction) ([]byte, error) {
+
+	ledgerDataLogger.Info(fmt.Sprintf("QueryResultWithPagination(%s) is running", query))
+	ledgerDataLogger.Debug("QueryResultWithPagination " + query)
+
+	it, metadata, err := stub.GetQueryResultWithPagination(query, pageSize, bookmark)
+	if err != nil {
+		message := fmt.Sprintf("unable to get query result %s: %s", query, err.Error())
+		ledgerDataLogger.Error(message)
+		return nil, errors.New(message)
+	}
+	defer it.Close()
+
+	entries, err := queryImpl(it, createEntry, stub, filterEntry)
+	if err != nil {
+		ledgerDataLogger.Error(err.Error())
+		return nil, err
+	}
+
+	paginatedResult := PaginatedResult{}
+	paginatedResult.Records = entries
+	if metadata != nil {
+		paginatedResult.FetchedRecordsCount = metadata.FetchedRecordsCount
+		paginatedResult.Bookmark = metadata.Bookmark
+	}
+
+	result, err := json.Marshal(paginatedResult)
+	if err != nil {
+		return nil, err
+	}
+	ledgerDataLogger.Debug("Result: " + string(result))
+
+	ledgerDataLogger.Info(fmt.Sprintf("QueryResultWithPagination(%s) exited without errors", query))
+	ledgerDataLogger.Debug("Success: QueryResultWithPagination " + query)
+	return result, nil
+}
+
+// QueryWithPagination returns a page of the entries with the partial key which pass the filter;
+// the fetched count includes the filtered out entries
+func QueryWithPagination(stub shim.ChaincodeStubInterface, index string, partialKey []string, pageSize int32, bookmark string,
+	createEntry FactoryMethod, filterEntry FilterFunction) (PaginatedResult, error) {
+
+	ledgerDataLogger.Info(fmt.Sprintf("QueryWithPagination(%s) is running", index))
+
+	paginatedResult := PaginatedResult{}
+	it, metadata, err := stub.GetStateByPartialCompositeKeyWithPagination(index, partialKey, pageSize, bookmark)
+	if err != nil {
+		message := fmt.Sprintf("unable to get state by partial composite key %s: %s", index, err.Error())
+		ledgerDataLogger.Error(message)
+		return paginatedResult, errors.New(message)
+	}
+	defer it.Close()
+
+	entries, err := queryImpl(it, createEntry, stub, filterEntry)
+	if err != nil {
+		ledgerDataLogger.Error(err.Error())
+		return paginatedResult, err
+	}
+
+	paginatedResult.Records = entries
+	if metadata != nil {
+		paginatedResult.FetchedRecordsCount = metadata.FetchedRecordsCount
+		paginatedResult.Bookmark = metadata.Bookmark
+	}
+
+	ledgerDataLogger.Info(fmt.Sprintf("QueryWithPagination(%s) exited without errors", index))
+	return paginatedResult, nil
+}
+
 func queryImpl(it shim.StateQueryIteratorInterface, createEntry FactoryMethod, stub shim.ChaincodeStubInterface,
 	filterEntry FilterFunction) ([]LedgerData, error) {
 
@@ -296,11 +580,166 @@ func GetCustomFieldFromCertificate(stub shim.ChaincodeStubInterface) (string, er
 	return getCustomFieldFromCertificate(certificate)
 }
 
+// Submitter identifies the creator of a reading, so that readings of devices
+// enrolled by different organizations of the channel can be told apart
+type Submitter struct {
+	MSPID        string `json:"mspid"`
+	EnrollmentID string `json:"enrollmentid"`
+	Fingerprint  string `json:"fingerprint"`
+	Owner        string `json:"owner"`
+}
+
+// GetSubmitter returns the MSP ID, the subject CN, the SHA-256 fingerprint and the owner attribute
+// of the creator's certificate; the owner is empty for certificates issued without attributes
+func GetSubmitter(stub shim.ChaincodeStubInterface) (Submitter, error) {
+	submitter := Submitter{}
+
+	mspid, err := GetMSPID(stub)
+	if err != nil {
+		return submitter, err
+	}
+	submitter.MSPID = mspid
+
+	cert, err := cid.GetX509Certificate(stub)
+	if err != nil {
+		return submitter, errors.New(fmt.Sprintf("Failure getting certificate from client ID object: %s", err.Error()))
+	}
+	if cert == nil {
+		return submitter, errors.New("creator has no certificate")
+	}
+	submitter.EnrollmentID = cert.Subject.CommonName
+
+	fingerprint := sha256.Sum256(cert.Raw)
+	submitter.Fingerprint = hex.EncodeToString(fingerprint[:])
+
+	owner, _, err := cid.GetAttributeValue(stub, attributeOwner)
+	if err != nil {
+		return submitter, errors.New(fmt.Sprintf("cannot get %s attribute: %s", attributeOwner, err.Error()))
+	}
+	submitter.Owner = owner
+
+	return submitter, nil
+}
+
+// GetDeviceID returns the identity of the device which submitted the transaction,
+// read from the source chosen in the config
+func GetDeviceID(stub shim.ChaincodeStubInterface) (string, error) {
+	source, err := GetIdentitySource(stub)
+	if err != nil {
+		return "", err
+	}
+
+	if source == identitySourceAttribute {
+		deviceID, found, err := cid.GetAttributeValue(stub, attributeDeviceID)
+		if err != nil {
+			return "", errors.New(fmt.Sprintf("cannot get %s attribute: %s", attributeDeviceID, err.Error()))
+		}
+		if !found || deviceID == "" {
+			return "", errors.New(fmt.Sprintf("certificate has no %s attribute", attributeDeviceID))
+		}
+		return deviceID, nil
+	}
+
+	return GetCustomFieldFromCertificate(stub)
+}
+
+// LookupDeviceID returns the identity of the device which submitted the transaction and whether
+// the creator carries one at all, so that identities of people can be told apart from failures
+func LookupDeviceID(stub shim.ChaincodeStubInterface) (string, bool, error) {
+	source, err := GetIdentitySource(stub)
+	if err != nil {
+		return "", false, err
+	}
+
+	if source == identitySourceAttribute {
+		deviceID, found, err := cid.GetAttributeValue(stub, attributeDeviceID)
+		if err != nil {
+			return "", false, errors.New(fmt.Sprintf("cannot get %s attribute: %s", attributeDeviceID, err.Error()))
+		}
+		return deviceID, found && deviceID != "", nil
+	}
+
+	deviceID, err := GetCustomFieldFromCertificate(stub)
+	if err != nil {
+		return "", false, err
+	}
+	return deviceID, deviceID != "", nil
+}
+
+// CertificateDeviceID returns the device ID of a device certificate, taken from the same source as GetDeviceID
+func CertificateDeviceID(stub shim.ChaincodeStubInterface, certificate *x509.Certificate) (string, error) {
+	source, err := GetIdentitySource(stub)
+	if err != nil {
+		return "", err
+	}
+
+	if source == identitySourceAttribute {
+		attributes, err := attrmgr.New().GetAttributesFromCert(certificate)
+		if err != nil {
+			return "", errors.New(fmt.Sprintf("cannot get attributes of the certificate: %s", err.Error()))
+		}
+		deviceID, _, err := attributes.Value(attributeDeviceID)
+		return deviceID, err
+	}
+
+	return strings.Join(certificate.EmailAddresses, ", "), nil
+}
+
+// IsAdmin reports whether the creator's certificate carries the admin attribute. Any member organization's CA
+// can issue the attribute, so it is trusted for functions acting on behalf of the creator's MSP only
+func IsAdmin(stub shim.ChaincodeStubInterface) (bool, error) {
+	admin, found, err := cid.GetAttributeValue(stub, attributeAdmin)
+	if err != nil {
+		return false, errors.New(fmt.Sprintf("cannot get %s attribute: %s", attributeAdmin, err.Error()))
+	}
+
+	return found && admin == "true", nil
+}
+
+// IsNetworkAdmin reports whether the creator is an admin of one of the certificate approvers,
+// which are set on instantiation or upgrade; functions affecting other organizations require it
+func IsNetworkAdmin(stub shim.ChaincodeStubInterface) (bool, error) {
+	if admin, err := IsAdmin(stub); err != nil || !admin {
+		return false, err
+	}
+
+	mspid, err := GetMSPID(stub)
+	if err != nil {
+		return false, err
+	}
+	_, approvers, err := GetCertificateApproval(stub)
+	if err != nil {
+		return false, err
+	}
+	for _, approver := range approvers {
+		if approver == mspid {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// CheckCertificate reports whether the certificate, or the creator's one if it is empty, is valid
 func CheckCertificate(stub shim.ChaincodeStubInterface, certificateString string) (byte, error) {
+	status, err := CheckCertificateStatus(stub, certificateString)
+	if err != nil {
+		return 0, err
+	}
+	if status != CertificateStatusValid {
+		return 0, nil
+	}
+
+	return 1, nil
+}
+
+// CheckCertificateStatus returns the status of the certificate, or the creator's one if it is empty,
+// at the transaction time; the best status is returned when the certificate is registered several times
+func CheckCertificateStatus(stub shim.ChaincodeStubInterface, certificateString string) (string, error) {
 	if certificateString == "" {
 		certificateStringFromStub, err := stub.GetCreator()
 		if err != nil {
-			return 0, err
+			return "", err
 		}
 
 		certificateStringFromStub = certificateStringFromStub[strings.Index(string(certificateStringFromStub), "-----") : strings.LastIndex(string(certificateStringFromStub), "-----")+5]
@@ -310,20 +749,31 @@ func CheckCertificate(stub shim.ChaincodeStubInterface, certificateString string
 	certificates := []Certificate{}
 	certificateBytes, err := Query(stub, iotCertificateIndex, []string{}, CreateCertificate, EmptyFilter)
 	if err != nil {
-		return 0, err
+		return "", err
 	}
 
 	if err := json.Unmarshal(certificateBytes, &certificates); err != nil {
-		return 0, err
+		return "", err
+	}
+
+	checker, err := LoadCertificateChecker(stub)
+	if err != nil {
+		return "", err
 	}
 
+	status := CertificateStatusUnregistered
 	for i := 0; i < len(certificates); i++ {
-		if certificates[i].Value.Certificate == certificateString {
-			return 1, nil
+		if certificates[i].Value.Certificate != certificateString {
+			continue
+		}
+
+		status = checker.Status(&certificates[i])
+		if status == CertificateStatusValid {
+			break
 		}
 	}
 
-	return 0, nil
+	return status, nil
 }
 
 func GetMSPID(stub shim.ChaincodeStubInterface) (string, error) {
@@ -479,6 +929,11 @@ func (events *Events) EmitEvent(stub shim.ChaincodeStubInterface) error {
 
 	Logger.Debug("### emitEvent started ###")
 
+	config, err := LoadConfig(stub)
+	if err != nil {
+		return err
+	}
+
 	for i, value := range events.Values {
 		eventAction := value.Action
 		var err error
@@ -514,6 +969,9 @@ func (events *Events) EmitEvent(stub shim.ChaincodeStubInterface) error {
 
 		event.Value.Creator = creator
 		event.Value.Timestamp = timestamp.Seconds
+		if event.Value.Priority == "" {
+			event.Value.Priority = EventPriorityNormal
+		}
 
 		bytes, err := json.Marshal(event)
 		if err != nil {
@@ -523,11 +981,22 @@ func (events *Events) EmitEvent(stub shim.ChaincodeStubInterface) error {
 		eventName := eventIndex + "." + eventAction + "." + newID
 		events.Keys = append(events.Keys, EventKey{ID: eventName})
 
+		// the chaincode event is emitted either way
+		if !config.IsEventPersisted(event.Value) {
+			Logger.Debug(fmt.Sprintf("Event is not persisted: %s", string(bytes)))
+			continue
+		}
+
 		if err := UpdateOrInsertIn(stub, &event, eventIndex, []string{""}, ""); err != nil {
 			message := fmt.Sprintf("persistence error: %s", err.Error())
 			Logger.Error(message)
 			return errors.New(message)
 		}
+		if err := IndexEventTime(stub, &event); err != nil {
+			message := fmt.Sprintf("persistence error: %s", err.Error())
+			Logger.Error(message)
+			return errors.New(message)
+		}
 
 		Logger.Info(fmt.Sprintf("Event set: %s without errors", string(bytes)))
 		Logger.Debug(fmt.Sprintf("Success: Event set: %s", string(bytes)))
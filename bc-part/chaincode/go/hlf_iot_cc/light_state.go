@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+const (
+	lightStateIndex = "LightState"
+)
+
+const (
+	lightStateKeyFieldsNumber      = 1
+	lightStateBasicArgumentsNumber = 0
+	lightStateSchemaVersion        = 1
+)
+
+type lightStateKey struct {
+	DeviceID string `json:"deviceid"`
+}
+
+// The state is written on transitions only, so light readings which do not switch it do not conflict
+type lightStateValue struct {
+	On bool `json:"on"`
+	// reading of the latest transition
+	LightID       string `json:"lightid"`
+	Timestamp     int64  `json:"timestamp"`
+	SchemaVersion int    `json:"schemaversion"`
+}
+
+// LightState is the state of the light sensor of a device used by the tamper rules
+type LightState struct {
+	Key   lightStateKey   `json:"key"`
+	Value lightStateValue `json:"value"`
+}
+
+func CreateLightState() LedgerData {
+	return new(LightState)
+}
+
+// states are recorded by the tamper rules only
+func (entity *LightState) FillFromArguments(stub shim.ChaincodeStubInterface, args []string) error {
+	if len(args) < lightStateBasicArgumentsNumber {
+		return errors.New(fmt.Sprintf("arguments array must contain at least %d items", lightStateBasicArgumentsNumber))
+	}
+	return nil
+}
+
+func (entity *LightState) FillFromCompositeKeyParts(compositeKeyParts []string) error {
+	if len(compositeKeyParts) < lightStateKeyFieldsNumber {
+		return errors.New(fmt.Sprintf("composite key parts array must contain at least %d items", lightStateKeyFieldsNumber))
+	}
+
+	if compositeKeyParts[0] == "" {
+		return errors.New("device ID must be not empty")
+	}
+
+	entity.Key.DeviceID = compositeKeyParts[0]
+
+	return nil
+}
+
+func (entity *LightState) FillFromLedgerValue(ledgerValue []byte) error {
+	ledgerValue, err := UpcastLedgerValue(lightStateIndex, ledgerValue)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(ledgerValue, &entity.Value); err != nil {
+		return err
+	} else {
+		return nil
+	}
+}
+
+func (entity *LightState) ToCompositeKey(stub shim.ChaincodeStubInterface) (string, error) {
+	compositeKeyParts := []string{
+		entity.Key.DeviceID,
+	}
+
+	return stub.CreateCompositeKey(lightStateIndex, compositeKeyParts)
+}
+
+func (entity *LightState) ToLedgerValue() ([]byte, error) {
+	entity.Value.SchemaVersion = lightStateSchemaVersion
+	return json.Marshal(entity.Value)
+}
+
+// GetLightState loads the light state of the device; the light of devices without a state is off
+func GetLightState(stub shim.ChaincodeStubInterface, deviceID string) (*LightState, error) {
+	state := &LightState{}
+	if err := state.FillFromCompositeKeyParts([]string{deviceID}); err != nil {
+		return nil, err
+	}
+
+	if ExistsIn(stub, state, lightStateIndex) {
+		if err := LoadFrom(stub, state, lightStateIndex); err != nil {
+			return nil, err
+		}
+	}
+
+	return state, nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+)
+
+// Units of measurements
+const (
+	UnitDegree           = "deg"
+	UnitMeter            = "m"
+	UnitHectopascal      = "hPa"
+	UnitCelsius          = "°C"
+	UnitRelativeHumidity = "%RH"
+	UnitDegreePerSecond  = "deg/s"
+	UnitStandardGravity  = "g"
+	// raw sensor register value
+	UnitLeastSignificantBit = "LSB"
+)
+
+// Number of decimal places kept for measurements
+const (
+	measurementCoordinateScale = 7
+	measurementScale           = 6
+)
+
+// decimal notation with an optional exponent; fractions, other bases and digit separators are not accepted
+var decimalPattern = regexp.MustCompile("^[+-]?([0-9]+\\.?[0-9]*|\\.[0-9]+)([eE][+-]?[0-9]+)?$")
+
+type MeasurementFormat struct {
+	Scale int
+	Unit  string
+}
+
+// Measurement is a decimal stored as a scaled integer, the real value is Value * 10^-Scale.
+// It is never converted to a binary float on write, so the value is kept exactly as the device sent it.
+type Measurement struct {
+	Value int64  `json:"value"`
+	Scale int    `json:"scale"`
+	Unit  string `json:"unit"`
+}
+
+// ParseMeasurement parses a decimal string; the value is rejected rather than rounded
+// if it has more significant decimal places than the format keeps
+func ParseMeasurement(valueString string, format MeasurementFormat) (Measurement, error) {
+	return parseMeasurement(valueString, format, false)
+}
+
+func parseMeasurement(valueString string, format MeasurementFormat, round bool) (Measurement, error) {
+	if !decimalPattern.MatchString(valueString) {
+		return Measurement{}, errors.New(fmt.Sprintf("\"%s\" is not a decimal number", valueString))
+	}
+	value, ok := new(big.Rat).SetString(valueString)
+	if !ok {
+		return Measurement{}, errors.New(fmt.Sprintf("\"%s\" is not a decimal number", valueString))
+	}
+
+	measurement, err := measurementFromRat(value, format, round)
+	if err != nil {
+		return measurement, errors.New(fmt.Sprintf("cannot store \"%s\": %s", valueString, err.Error()))
+	}
+
+	return measurement, nil
+}
+
+func measurementFromRat(value *big.Rat, format MeasurementFormat, round bool) (Measurement, error) {
+	measurement := Measurement{}
+
+	multiplier := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(format.Scale)), nil)
+	value = new(big.Rat).Mul(value, new(big.Rat).SetInt(multiplier))
+
+	scaled := new(big.Int)
+	if value.IsInt() {
+		scaled.Set(value.Num())
+	} else if !round {
+		return measurement, errors.New(fmt.Sprintf("value has more than %d decimal places", format.Scale))
+	} else {
+		// rounding half away from zero
+		remainder := new(big.Int)
+		scaled.QuoRem(value.Num(), value.Denom(), remainder)
+		remainder.Abs(remainder).Mul(remainder, big.NewInt(2))
+		if remainder.Cmp(value.Denom()) >= 0 {
+			scaled.Add(scaled, big.NewInt(int64(value.Num().Sign())))
+		}
+	}
+
+	if !scaled.IsInt64() {
+		return measurement, errors.New("value is out of range")
+	}
+
+	measurement.Value = scaled.Int64()
+	measurement.Scale = format.Scale
+	measurement.Unit = format.Unit
+
+	return measurement, nil
+}
+
+// measurementFromFloat64 stores a computed value rounded to the format
+func measurementFromFloat64(value float64, format MeasurementFormat) (Measurement, error) {
+	rat := new(big.Rat)
+	if math.IsNaN(value) || math.IsInf(value, 0) || rat.SetFloat64(value) == nil {
+		return Measurement{}, errors.New(fmt.Sprintf("%v is not a finite number", value))
+	}
+
+	return measurementFromRat(rat, format, true)
+}
+
+// Rat returns the exact value of the measurement
+func (measurement Measurement) Rat() *big.Rat {
+	return new(big.Rat).SetFrac(big.NewInt(measurement.Value),
+		new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(measurement.Scale)), nil))
+}
+
+func (measurement Measurement) Float64() float64 {
+	return float64(measurement.Value) / math.Pow10(measurement.Scale)
+}
+
+func (measurement Measurement) String() string {
+	return measurement.Rat().FloatString(measurement.Scale)
+}
+
+// upcastToMeasurements converts float fields of values stored before measurements
+// were introduced; these values were already narrowed to float32, so they are rounded to the format
+func upcastToMeasurements(formats map[string]MeasurementFormat) Upcaster {
+	return func(value map[string]interface{}) error {
+		for field, format := range formats {
+			number, ok := value[field].(json.Number)
+			if !ok {
+				continue
+			}
+
+			measurement, err := parseMeasurement(number.String(), format, true)
+			if err != nil {
+				return errors.New(fmt.Sprintf("cannot convert %s: %s", field, err.Error()))
+			}
+			value[field] = measurement
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseMeasurement(t *testing.T) {
+	coordinate := MeasurementFormat{Scale: measurementCoordinateScale, Unit: UnitDegree}
+	pressure := MeasurementFormat{Scale: 2, Unit: UnitHectopascal}
+	count := MeasurementFormat{Scale: 0, Unit: ""}
+
+	tests := []struct {
+		name   string
+		value  string
+		format MeasurementFormat
+		want   Measurement
+		valid  bool
+	}{
+		{"coordinate", "53.9045123", coordinate, Measurement{539045123, 7, UnitDegree}, true},
+		{"negative", "-0.5", coordinate, Measurement{-5000000, 7, UnitDegree}, true},
+		{"plus sign", "+1013.25", pressure, Measurement{101325, 2, UnitHectopascal}, true},
+		{"trailing zeros", "1.12345670000", coordinate, Measurement{11234567, 7, UnitDegree}, true},
+		{"leading point", ".5", pressure, Measurement{50, 2, UnitHectopascal}, true},
+		{"exponent", "1.5e2", count, Measurement{150, 0, ""}, true},
+		{"negative zero", "-0", count, Measurement{0, 0, ""}, true},
+		{"largest value", "9223372036854775807", count, Measurement{9223372036854775807, 0, ""}, true},
+		{"empty", "", pressure, Measurement{}, false},
+		{"blank", " ", pressure, Measurement{}, false},
+		{"point only", ".", pressure, Measurement{}, false},
+		{"too many decimal places", "1.123456789", coordinate, Measurement{}, false},
+		{"out of range", "9223372036854775808", count, Measurement{}, false},
+		{"huge exponent", "1e400", count, Measurement{}, false},
+		{"not a number", "NaN", pressure, Measurement{}, false},
+		{"infinity", "Inf", pressure, Measurement{}, false},
+		{"fraction", "1/2", pressure, Measurement{}, false},
+		{"hexadecimal", "0x10", count, Measurement{}, false},
+		{"digit separators", "1_000", count, Measurement{}, false},
+		{"unit suffix", "1013.25hPa", pressure, Measurement{}, false},
+		{"unit after space", "20.5 °C", pressure, Measurement{}, false},
+		{"percent", "55%", pressure, Measurement{}, false},
+		{"surrounding spaces", " 1.5 ", pressure, Measurement{}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseMeasurement(test.value, test.format)
+			if !test.valid {
+				if err == nil {
+					t.Fatalf("ParseMeasurement(%q) = %v, want an error", test.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseMeasurement(%q) failed: %s", test.value, err.Error())
+			}
+			if got != test.want {
+				t.Fatalf("ParseMeasurement(%q) = %v, want %v", test.value, got, test.want)
+			}
+		})
+	}
+}
+
+func TestMeasurementString(t *testing.T) {
+	tests := []struct {
+		measurement Measurement
+		want        string
+	}{
+		{Measurement{539045123, 7, UnitDegree}, "53.9045123"},
+		{Measurement{-5000000, 7, UnitDegree}, "-0.5000000"},
+		{Measurement{101325, 2, UnitHectopascal}, "1013.25"},
+		{Measurement{-5, 2, UnitCelsius}, "-0.05"},
+		{Measurement{0, 0, ""}, "0"},
+	}
+
+	for _, test := range tests {
+		if got := test.measurement.String(); got != test.want {
+			t.Errorf("%v.String() = %s, want %s", test.measurement, got, test.want)
+		}
+	}
+}
+
+func TestParseMeasurementRounding(t *testing.T) {
+	format := MeasurementFormat{Scale: measurementCoordinateScale, Unit: UnitDegree}
+
+	tests := []struct {
+		value string
+		want  int64
+	}{
+		{"0.12345675", 1234568},
+		{"-0.12345675", -1234568},
+		{"0.12345674", 1234567},
+		{"-1.23456785e-1", -1234568},
+	}
+
+	for _, test := range tests {
+		got, err := parseMeasurement(test.value, format, true)
+		if err != nil || got.Value != test.want {
+			t.Errorf("parseMeasurement(%q) = %v, %v, want %d", test.value, got.Value, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Merkle tree layout shared with the raspberry-iot anchor helper:
+// leaf = sha256(0x00 || sample), node = sha256(0x01 || left || right),
+// a node without a sibling is promoted to the next level unchanged.
+const (
+	merkleHashSize   = sha256.Size
+	merkleLeafPrefix = 0x00
+	merkleNodePrefix = 0x01
+	merkleMaxDepth   = 64
+)
+
+type MerkleProofItem struct {
+	Hash string `json:"hash"`
+	Left bool   `json:"left"`
+}
+
+func MerkleLeafHash(sample []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{merkleLeafPrefix})
+	h.Write(sample)
+	return h.Sum(nil)
+}
+
+func MerkleNodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{merkleNodePrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+func ParseMerkleProof(proofString string) ([]MerkleProofItem, error) {
+	proof := []MerkleProofItem{}
+	if proofString == "" {
+		return proof, nil
+	}
+
+	if err := json.Unmarshal([]byte(proofString), &proof); err != nil {
+		return nil, errors.New(fmt.Sprintf("cannot unmarshaling proof: %s", err.Error()))
+	}
+	if len(proof) > merkleMaxDepth {
+		return nil, errors.New(fmt.Sprintf("proof must contain at most %d items", merkleMaxDepth))
+	}
+
+	return proof, nil
+}
+
+func VerifyMerkleProof(sample []byte, proof []MerkleProofItem, merkleRoot string) (bool, error) {
+	root, err := hex.DecodeString(merkleRoot)
+	if err != nil {
+		return false, errors.New(fmt.Sprintf("unable to parse the merkle root: %s", err.Error()))
+	}
+
+	current := MerkleLeafHash(sample)
+	for i, item := range proof {
+		sibling, err := hex.DecodeString(item.Hash)
+		if err != nil || len(sibling) != merkleHashSize {
+			return false, errors.New(fmt.Sprintf("proof item %d must be a %d bytes hex hash", i, merkleHashSize))
+		}
+
+		if item.Left {
+			current = MerkleNodeHash(sibling, current)
+		} else {
+			current = MerkleNodeHash(current, sibling)
+		}
+	}
+
+	return bytes.Equal(current, root), nil
+}
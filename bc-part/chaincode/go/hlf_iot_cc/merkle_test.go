@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// merkleTestTree builds the levels of the tree the way the raspberry-iot anchor helper does
+func merkleTestTree(samples []string) [][][]byte {
+	level := [][]byte{}
+	for _, sample := range samples {
+		level = append(level, MerkleLeafHash([]byte(sample)))
+	}
+
+	tree := [][][]byte{level}
+	for len(level) > 1 {
+		next := [][]byte{}
+		for i := 0; i < len(level); i += 2 {
+			if i+1 < len(level) {
+				next = append(next, MerkleNodeHash(level[i], level[i+1]))
+			} else {
+				next = append(next, level[i])
+			}
+		}
+		tree = append(tree, next)
+		level = next
+	}
+
+	return tree
+}
+
+func merkleTestProof(tree [][][]byte, index int) []MerkleProofItem {
+	proof := []MerkleProofItem{}
+	for _, level := range tree[:len(tree)-1] {
+		if index%2 == 1 {
+			proof = append(proof, MerkleProofItem{Hash: hex.EncodeToString(level[index-1]), Left: true})
+		} else if index+1 < len(level) {
+			proof = append(proof, MerkleProofItem{Hash: hex.EncodeToString(level[index+1]), Left: false})
+		}
+		index = index / 2
+	}
+
+	return proof
+}
+
+func TestVerifyMerkleProof(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []string
+	}{
+		{"single leaf", []string{"a"}},
+		{"two leaves", []string{"a", "b"}},
+		{"odd leaf count", []string{"a", "b", "c"}},
+		{"odd leaf count on an upper level", []string{"a", "b", "c", "d", "e"}},
+		{"full tree", []string{"a", "b", "c", "d", "e", "f", "g", "h"}},
+		{"empty sample", []string{"", "b", "c"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tree := merkleTestTree(test.samples)
+			root := hex.EncodeToString(tree[len(tree)-1][0])
+
+			for index, sample := range test.samples {
+				proof := merkleTestProof(tree, index)
+				ok, err := VerifyMerkleProof([]byte(sample), proof, root)
+				if err != nil || !ok {
+					t.Fatalf("sample %d is not verified: %v", index, err)
+				}
+
+				ok, err = VerifyMerkleProof([]byte(sample+"x"), proof, root)
+				if err != nil || ok {
+					t.Fatalf("changed sample %d is verified", index)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyMerkleProofLayout(t *testing.T) {
+	// the node without a sibling is promoted, not hashed with itself
+	root := hex.EncodeToString(MerkleNodeHash(MerkleNodeHash(MerkleLeafHash([]byte("a")), MerkleLeafHash([]byte("b"))),
+		MerkleLeafHash([]byte("c"))))
+	proof := []MerkleProofItem{{Hash: hex.EncodeToString(MerkleNodeHash(MerkleLeafHash([]byte("a")), MerkleLeafHash([]byte("b")))), Left: true}}
+
+	if ok, err := VerifyMerkleProof([]byte("c"), proof, root); err != nil || !ok {
+		t.Fatalf("promoted leaf is not verified: %v", err)
+	}
+
+	// a leaf must not pass as a node
+	if ok, _ := VerifyMerkleProof([]byte("c"), nil, hex.EncodeToString(MerkleLeafHash([]byte("c")))); !ok {
+		t.Fatal("single leaf is not its own root")
+	}
+	if ok, _ := VerifyMerkleProof([]byte("c"), nil, root); ok {
+		t.Fatal("leaf is verified against the root without proof")
+	}
+}
+
+func TestVerifyMerkleProofErrors(t *testing.T) {
+	root := hex.EncodeToString(MerkleLeafHash([]byte("a")))
+
+	tests := []struct {
+		name  string
+		proof []MerkleProofItem
+		root  string
+	}{
+		{"root is not hex", nil, "xyz"},
+		{"proof item is not hex", []MerkleProofItem{{Hash: "xyz"}}, root},
+		{"proof item is too short", []MerkleProofItem{{Hash: "abcd"}}, root},
+		{"empty proof item", []MerkleProofItem{{Hash: ""}}, root},
+	}
+
+	for _, test := range tests {
+		if _, err := VerifyMerkleProof([]byte("a"), test.proof, test.root); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
+
+func TestParseMerkleProof(t *testing.T) {
+	tooLong := "[" + strings.TrimSuffix(strings.Repeat(`{"hash":"","left":false},`, merkleMaxDepth+1), ",") + "]"
+
+	tests := []struct {
+		name  string
+		proof string
+		items int
+		valid bool
+	}{
+		{"empty", "", 0, true},
+		{"empty array", "[]", 0, true},
+		{"one item", `[{"hash":"ab","left":true}]`, 1, true},
+		{"not json", "[", 0, false},
+		{"not an array", `{"hash":"ab"}`, 0, false},
+		{"too long", tooLong, 0, false},
+	}
+
+	for _, test := range tests {
+		proof, err := ParseMerkleProof(test.proof)
+		if test.valid && (err != nil || len(proof) != test.items) {
+			t.Errorf("%s: got %d items, %v; want %d items", test.name, len(proof), err, test.items)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"strings"
+)
+
+const (
+	queryDefaultPageSize = 100
+	queryMaxPageSize     = 1000
+	// the largest unicode code point, used as the upper bound of a composite key range
+	maxUnicodeRuneValue = '\U0010FFFF'
+)
+
+type iotSensorType struct {
+	Index   string
+	Create  FactoryMethod
+	Formats map[string]MeasurementFormat
+	Fields  []string
+	// leading composite key parts of the readings, set for sensor types registered at runtime
+	KeyParts []string
+}
+
+// Built-in sensor types with the value fields each of them may be filtered by; addCalibration accepts these only.
+// Measurements are compared by their scaled integer values
+var iotSensorTypes = map[string]iotSensorType{
+	"gps":       {iotGpsIndex, CreateGps, gpsMeasurementFormats, measurementQueryFields(gpsMeasurementFormats), nil},
+	"barometer": {iotBarometerIndex, CreateBarometer, barometerMeasurementFormats, measurementQueryFields(barometerMeasurementFormats), nil},
+	"gyroscope": {iotGyroscopeIndex, CreateGyroscope, gyroscopeMeasurementFormats, append(measurementQueryFields(gyroscopeMeasurementFormats),
+		append(measurementQueryFields(gyroscopeDerivedMeasurementFormats), "shock")...), nil},
+	"humidity":  {iotHumidityIndex, CreateHumidity, humidityMeasurementFormats, measurementQueryFields(humidityMeasurementFormats), nil},
+	"vibration": {iotVibrationIndex, CreateVibration, nil, []string{"vibration"}, nil},
+	"light":     {iotLightIndex, CreateLight, nil, []string{"light"}, nil},
+}
+
+// Fields common to all readings, indexed by META-INF/statedb/couchdb/indexes
+var iotCommonQueryFields = []string{"timestamp", "customfield", "valid", "mspid", "enrollmentid", "fingerprint", "owner"}
+
+var queryCombinationOperators = map[string]bool{"$and": true, "$or": true, "$nor": true}
+
+var queryConditionOperators = map[string]bool{"$eq": true, "$ne": true, "$gt": true, "$gte": true, "$lt": true, "$lte": true,
+	"$in": true, "$nin": true, "$exists": true, "$not": true}
+
+func measurementQueryFields(formats map[string]MeasurementFormat) []string {
+	fields := []string{}
+	for field := range formats {
+		fields = append(fields, field+".value")
+	}
+
+	return fields
+}
+
+// GetIotSensorType looks up a built-in sensor type or, failing that, a sensor type registered at runtime
+func GetIotSensorType(stub shim.ChaincodeStubInterface, name string) (iotSensorType, error) {
+	if sensorType, ok := iotSensorTypes[name]; ok {
+		return sensorType, nil
+	}
+
+	registered, err := GetSensorType(stub, name)
+	if err != nil {
+		return iotSensorType{}, err
+	}
+
+	return registered.IotSensorType(), nil
+}
+
+// keyRangeStart returns the prefix of the composite keys of the readings of the sensor type
+func (sensorType iotSensorType) keyRangeStart() string {
+	prefix := "\x00" + sensorType.Index + "\x00"
+	for _, part := range sensorType.KeyParts {
+		prefix += part + "\x00"
+	}
+
+	return prefix
+}
+
+// BuildIotQuery checks the Mango selector against the allowed fields and operators
+// and restricts it to the keys of the sensor type
+func BuildIotQuery(sensorType iotSensorType, selectorString string) (string, error) {
+	selector := map[string]interface{}{}
+	if selectorString != "" {
+		if err := json.Unmarshal([]byte(selectorString), &selector); err != nil {
+			return "", errors.New(fmt.Sprintf("cannot unmarshaling selector: %s", err.Error()))
+		}
+	}
+
+	fields := map[string]bool{}
+	for _, field := range iotCommonQueryFields {
+		fields[field] = true
+	}
+	for _, field := range sensorType.Fields {
+		fields[field] = true
+	}
+
+	if err := checkSelector(selector, fields); err != nil {
+		return "", err
+	}
+
+	keyRange := map[string]interface{}{
+		"$gt": sensorType.keyRangeStart(),
+		"$lt": sensorType.keyRangeStart() + string(maxUnicodeRuneValue),
+	}
+
+	query := map[string]interface{}{
+		"selector": map[string]interface{}{
+			"$and": []interface{}{
+				map[string]interface{}{"_id": keyRange},
+				selector,
+			},
+		},
+	}
+
+	queryBytes, err := json.Marshal(query)
+	if err != nil {
+		return "", err
+	}
+
+	return string(queryBytes), nil
+}
+
+func checkSelector(selector map[string]interface{}, fields map[string]bool) error {
+	for key, value := range selector {
+		if strings.HasPrefix(key, "$") {
+			if !queryCombinationOperators[key] {
+				return errors.New(fmt.Sprintf("operator %s is not allowed at the selector level", key))
+			}
+
+			items, ok := value.([]interface{})
+			if !ok {
+				return errors.New(fmt.Sprintf("operator %s requires an array of selectors", key))
+			}
+			for _, item := range items {
+				itemSelector, ok := item.(map[string]interface{})
+				if !ok {
+					return errors.New(fmt.Sprintf("operator %s requires an array of selectors", key))
+				}
+				if err := checkSelector(itemSelector, fields); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if !fields[key] {
+			return errors.New(fmt.Sprintf("field %s is not allowed in the selector", key))
+		}
+		if err := checkCondition(key, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func checkCondition(field string, condition interface{}) error {
+	operators, ok := condition.(map[string]interface{})
+	if !ok {
+		return checkScalar(field, condition)
+	}
+
+	for operator, value := range operators {
+		if !queryConditionOperators[operator] {
+			return errors.New(fmt.Sprintf("operator %s is not allowed for field %s", operator, field))
+		}
+
+		switch operator {
+		case "$not":
+			if err := checkCondition(field, value); err != nil {
+				return err
+			}
+		case "$in", "$nin":
+			items, ok := value.([]interface{})
+			if !ok {
+				return errors.New(fmt.Sprintf("operator %s requires an array for field %s", operator, field))
+			}
+			for _, item := range items {
+				if err := checkScalar(field, item); err != nil {
+					return err
+				}
+			}
+		case "$exists":
+			if _, ok := value.(bool); !ok {
+				return errors.New(fmt.Sprintf("operator %s requires a boolean for field %s", operator, field))
+			}
+		default:
+			if err := checkScalar(field, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func checkScalar(field string, value interface{}) error {
+	switch value.(type) {
+	case string, float64, bool, nil:
+		return nil
+	}
+
+	return errors.New(fmt.Sprintf("field %s must be compared with a string, number or boolean", field))
+}
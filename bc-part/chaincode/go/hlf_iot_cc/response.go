@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Codes of the error body
+const (
+	errorCodeBadRequest = "badRequest"
+	errorCodeForbidden  = "forbidden"
+	errorCodeNotFound   = "notFound"
+	errorCodeConflict   = "conflict"
+	errorCodeInternal   = "internal"
+)
+
+var errorCodes = map[int32]string{
+	400: errorCodeBadRequest,
+	403: errorCodeForbidden,
+	404: errorCodeNotFound,
+	409: errorCodeConflict,
+	500: errorCodeInternal,
+}
+
+// ErrorBody is returned by all functions on failure, so that clients do not have to parse messages
+type ErrorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// argument which failed validation, if it is known
+	Field string `json:"field,omitempty"`
+	// whether the same request can succeed later; validation, authorization and state errors are permanent
+	Retryable bool `json:"retryable"`
+	// structured description of the failure, e.g. results of the items of a rejected batch
+	Details interface{} `json:"details,omitempty"`
+}
+
+// ErrorResponse builds a failed response with the error body. Peers pass the message of a failed
+// response to the client and drop the payload, so the body is set as both
+func ErrorResponse(status int32, field string, message string) pb.Response {
+	return ErrorResponseWithDetails(status, field, message, nil)
+}
+
+// ErrorResponseWithDetails builds a failed response with the details set in the error body
+func ErrorResponseWithDetails(status int32, field string, message string, details interface{}) pb.Response {
+	code, ok := errorCodes[status]
+	if !ok {
+		status = 500
+		code = errorCodeInternal
+	}
+
+	body := ErrorBody{Code: code, Message: message, Field: field, Retryable: status >= 500, Details: details}
+	bodyBytes, err := json.Marshal(body)
+	if err != nil {
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	return pb.Response{Status: status, Message: string(bodyBytes), Payload: bodyBytes}
+}
+
+// internalError marks failures of the peer, e.g. reading the ledger or the transaction, as opposed to invalid arguments
+type internalError struct {
+	error
+}
+
+// InternalError marks the error as internal, so that it is reported with the retryable status 500
+func InternalError(err error) error {
+	return internalError{err}
+}
+
+// identityError marks failures to identify the creator from its certificate, e.g. a missing device ID attribute
+type identityError struct {
+	error
+}
+
+// IdentityError marks the error as an identity one, so that it is reported with the status 403
+func IdentityError(err error) error {
+	return identityError{err}
+}
+
+// argumentError marks an error of one argument, so that the argument is reported in the field of the error body
+type argumentError struct {
+	error
+	field string
+}
+
+// ArgumentError marks the error as caused by the argument named field
+func ArgumentError(field string, err error) error {
+	return argumentError{err, field}
+}
+
+// ErrorField returns the argument an error of filling an entity is caused by, or an empty string if it is unknown
+func ErrorField(err error) string {
+	if argument, ok := err.(argumentError); ok {
+		return argument.field
+	}
+
+	return ""
+}
+
+// FillErrorStatus returns the status of an error of filling an entity: 500 for internal errors,
+// 403 for identity errors, 400 otherwise
+func FillErrorStatus(err error) int32 {
+	if argument, ok := err.(argumentError); ok {
+		err = argument.error
+	}
+
+	switch err.(type) {
+	case internalError:
+		return 500
+	case identityError:
+		return 403
+	}
+
+	return 400
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFillErrorStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int32
+		field  string
+	}{
+		{"invalid argument", ArgumentError("timestamp", errors.New("timestamp must be not empty")), 400, "timestamp"},
+		{"argument count", errors.New("arguments array must contain at least 2 items"), 400, ""},
+		{"identity", IdentityError(errors.New("certificate has no iot.deviceId attribute")), 403, ""},
+		{"internal", InternalError(errors.New("unable to get transaction timestamp")), 500, ""},
+		{"internal error of an argument", ArgumentError("sensorType", InternalError(errors.New("unable to get state"))), 500, "sensorType"},
+	}
+
+	for _, test := range tests {
+		if status := FillErrorStatus(test.err); status != test.status {
+			t.Errorf("%s: FillErrorStatus() = %d, want %d", test.name, status, test.status)
+		}
+		if field := ErrorField(test.err); field != test.field {
+			t.Errorf("%s: ErrorField() = %q, want %q", test.name, field, test.field)
+		}
+	}
+}
+
+func TestFillFromArgumentsReportsField(t *testing.T) {
+	stub := newCommittedStub()
+
+	stub.MockTransactionStart("fill")
+	defer stub.MockTransactionEnd("fill")
+
+	humidity := Humidity{}
+	err := humidity.FillFromArguments(stub, []string{"50.5", "hot", "100"})
+	if err == nil || FillErrorStatus(err) != 400 || ErrorField(err) != "temperature" {
+		t.Errorf("FillFromArguments() = %v with field %q, want an error of the temperature", err, ErrorField(err))
+	}
+}
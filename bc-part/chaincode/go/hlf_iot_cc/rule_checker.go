@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// RuleChecker applies the tamper and geofence rules to the readings of one transaction.
+// A transaction does not read its own writes, so the states the rules change are kept in memory
+// once they are loaded, and readings of a batch see the effects of the readings before them
+type RuleChecker struct {
+	stub shim.ChaincodeStubInterface
+	// by device ID
+	lightStates map[string]*LightState
+	incidents   map[string][]*TamperIncident
+	vibrations  map[string][]*Vibration
+	geofences   map[string][]Geofence
+	// by device ID and geofence ID
+	geofenceStates map[string]*geofenceState
+}
+
+// latest transition of a device for a geofence
+type geofenceState struct {
+	Inside    bool
+	Timestamp int64
+}
+
+func NewRuleChecker(stub shim.ChaincodeStubInterface) *RuleChecker {
+	return &RuleChecker{
+		stub:           stub,
+		lightStates:    map[string]*LightState{},
+		incidents:      map[string][]*TamperIncident{},
+		vibrations:     map[string][]*Vibration{},
+		geofences:      map[string][]Geofence{},
+		geofenceStates: map[string]*geofenceState{},
+	}
+}
+
+func (checker *RuleChecker) lightState(deviceID string) (*LightState, error) {
+	if state, ok := checker.lightStates[deviceID]; ok {
+		return state, nil
+	}
+
+	state, err := GetLightState(checker.stub, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	checker.lightStates[deviceID] = state
+
+	return state, nil
+}
+
+// openIncidents loads the open incidents of the device from the device index
+func (checker *RuleChecker) openIncidents(deviceID string) ([]*TamperIncident, error) {
+	if incidents, ok := checker.incidents[deviceID]; ok {
+		return incidents, nil
+	}
+
+	entries, err := getIndexEntries(checker.stub, openTamperIncidentIndex, []string{deviceID})
+	if err != nil {
+		return nil, err
+	}
+
+	incidents := []*TamperIncident{}
+	for _, entry := range entries {
+		incident := &TamperIncident{}
+		if err := incident.FillFromCompositeKeyParts([]string{entry.KeyParts[1], deviceID, entry.KeyParts[2]}); err != nil {
+			return nil, err
+		}
+		if err := LoadFrom(checker.stub, incident, tamperIncidentIndex); err != nil {
+			return nil, err
+		}
+		if incident.IsOpen() {
+			incidents = append(incidents, incident)
+		}
+	}
+	checker.incidents[deviceID] = incidents
+
+	return incidents, nil
+}
+
+func (checker *RuleChecker) assignedGeofences(deviceID string) ([]Geofence, error) {
+	if geofences, ok := checker.geofences[deviceID]; ok {
+		return geofences, nil
+	}
+
+	geofences := []Geofence{}
+	geofencesBytes, err := Query(checker.stub, iotGeofenceIndex, []string{}, CreateGeofence, func(data LedgerData) bool {
+		return data.(*Geofence).IsAssignedTo(deviceID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(geofencesBytes, &geofences); err != nil {
+		return nil, err
+	}
+	checker.geofences[deviceID] = geofences
+
+	return geofences, nil
+}
+
+// geofenceState finds the last transition of the device for the geofence
+func (checker *RuleChecker) geofenceState(deviceID string, geofenceID string) (*geofenceState, error) {
+	key := deviceID + "\x00" + geofenceID
+	if state, ok := checker.geofenceStates[key]; ok {
+		return state, nil
+	}
+
+	transitions := []GeofenceTransition{}
+	transitionsBytes, err := Query(checker.stub, iotGeofenceTransitionIndex, []string{deviceID, geofenceID}, CreateGeofenceTransition, EmptyFilter)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(transitionsBytes, &transitions); err != nil {
+		return nil, err
+	}
+
+	state := &geofenceState{}
+	for _, transition := range transitions {
+		if transition.Value.Timestamp >= state.Timestamp {
+			state.Timestamp = transition.Value.Timestamp
+			state.Inside = transition.Value.Action == eventGeofenceEnter
+		}
+	}
+	checker.geofenceStates[key] = state
+
+	return state, nil
+}
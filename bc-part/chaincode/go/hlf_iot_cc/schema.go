@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"sort"
+)
+
+const schemaMigrationBatchSize = 500
+
+// Upcaster converts a decoded ledger value of a version to the next one
+type Upcaster func(value map[string]interface{}) error
+
+type SchemaEntity struct {
+	Index     string
+	Create    FactoryMethod
+	Version   int
+	Upcasters map[int]Upcaster
+}
+
+// Stored entities in migration order. Bump Version and register an upcaster
+// from the previous version whenever a value struct changes.
+// Values written before versioning was introduced have version 0.
+var schemaEntities = []SchemaEntity{
+	{configIndex, CreateConfig, configSchemaVersion, map[int]Upcaster{
+		1: upcastIdentitySource,
+	}},
+	{eventIndex, CreateEvent, eventSchemaVersion, map[int]Upcaster{
+		1: upcastEventPriority,
+	}},
+	{iotGpsIndex, CreateGps, iotGpsSchemaVersion, map[int]Upcaster{
+		1: upcastToMeasurements(gpsMeasurementFormats),
+	}},
+	{iotBarometerIndex, CreateBarometer, iotBarometerSchemaVersion, map[int]Upcaster{
+		1: upcastToMeasurements(barometerMeasurementFormats),
+	}},
+	{iotGyroscopeIndex, CreateGyroscope, iotGyroscopeSchemaVersion, map[int]Upcaster{
+		1: upcastToMeasurements(gyroscopeMeasurementFormats),
+		4: upcastGyroscopeDerivedMetrics,
+	}},
+	{iotHumidityIndex, CreateHumidity, iotHumiditySchemaVersion, map[int]Upcaster{
+		1: upcastToMeasurements(humidityMeasurementFormats),
+	}},
+	{iotVibrationIndex, CreateVibration, iotVibrationSchemaVersion, map[int]Upcaster{}},
+	{iotLightIndex, CreateLight, iotLightSchemaVersion, map[int]Upcaster{}},
+	{lightStateIndex, CreateLightState, lightStateSchemaVersion, map[int]Upcaster{}},
+	{sensorTypeIndex, CreateSensorType, sensorTypeSchemaVersion, map[int]Upcaster{}},
+	{iotReadingIndex, CreateReading, iotReadingSchemaVersion, map[int]Upcaster{}},
+	{iotCalibrationIndex, CreateCalibration, iotCalibrationSchemaVersion, map[int]Upcaster{}},
+	{iotCertificateIndex, CreateCertificate, iotCertificateSchemaVersion, map[int]Upcaster{
+		1: upcastCertificateState,
+		2: upcastCertificateDetails,
+	}},
+	{iotAnchorIndex, CreateAnchor, iotAnchorSchemaVersion, map[int]Upcaster{}},
+	{deviceIndex, CreateDevice, deviceSchemaVersion, map[int]Upcaster{}},
+	{deviceLastSeenIndex, CreateDeviceLastSeen, deviceLastSeenSchemaVersion, map[int]Upcaster{}},
+	{deviceTwinIndex, CreateDeviceTwin, deviceTwinSchemaVersion, map[int]Upcaster{}},
+	{deviceCommandIndex, CreateDeviceCommand, deviceCommandSchemaVersion, map[int]Upcaster{}},
+	{accessGrantIndex, CreateAccessGrant, accessGrantSchemaVersion, map[int]Upcaster{}},
+	{iotGeofenceIndex, CreateGeofence, iotGeofenceSchemaVersion, map[int]Upcaster{}},
+	{iotGeofenceTransitionIndex, CreateGeofenceTransition, iotGeofenceTransitionSchemaVersion, map[int]Upcaster{
+		1: upcastToMeasurements(geofenceTransitionMeasurementFormats),
+	}},
+	{shipmentIndex, CreateShipment, shipmentSchemaVersion, map[int]Upcaster{}},
+	{tamperIncidentIndex, CreateTamperIncident, tamperIncidentSchemaVersion, map[int]Upcaster{}},
+	{schemaMigrationIndex, CreateSchemaMigration, schemaMigrationSchemaVersion, map[int]Upcaster{}},
+}
+
+// Indexer records a stored entry in a secondary index introduced after the entry was written
+type Indexer func(stub shim.ChaincodeStubInterface, entry LedgerData) error
+
+type IndexStep struct {
+	Name    string
+	Index   string
+	Create  FactoryMethod
+	Indexer Indexer
+}
+
+// Secondary indexes filled by the migration after the entities are migrated.
+// Steps are part of the migration versions, so adding one restarts the migration.
+func schemaIndexSteps() []IndexStep {
+	steps := []IndexStep{}
+
+	// readings are indexed by certificate on write since the certificate index was introduced
+	sensors := []string{}
+	for sensor := range iotSensorTypes {
+		sensors = append(sensors, sensor)
+	}
+	sort.Strings(sensors)
+	for _, sensor := range sensors {
+		steps = append(steps, IndexStep{"certificateUsage." + sensor, iotSensorTypes[sensor].Index, iotSensorTypes[sensor].Create,
+			indexCertificateUsageOf(sensor)})
+	}
+	steps = append(steps, IndexStep{"certificateUsage.reading", iotReadingIndex, CreateReading, indexReadingCertificateUsage})
+
+	// certificates are indexed by device on registration since devices are registered by proof of enrollment
+	steps = append(steps, IndexStep{"certificateDevice", iotCertificateIndex, CreateCertificate, IndexCertificateDevice})
+
+	// indexes of the tamper rules are written on write since they were introduced
+	steps = append(steps, IndexStep{"tamperRules.shipment", shipmentIndex, CreateShipment, indexShipmentTamperRules})
+	steps = append(steps, IndexStep{"tamperRules.openIncident", tamperIncidentIndex, CreateTamperIncident, indexOpenTamperIncident})
+
+	// persisted events are indexed by time since the compaction reads expired events by range
+	steps = append(steps, IndexStep{"eventTime", eventIndex, CreateEvent, IndexEventTime})
+
+	return steps
+}
+
+type schemaVersionValue struct {
+	SchemaVersion int `json:"schemaversion"`
+}
+
+func GetSchemaEntity(index string) (SchemaEntity, error) {
+	for _, entity := range schemaEntities {
+		if entity.Index == index {
+			return entity, nil
+		}
+	}
+
+	return SchemaEntity{}, errors.New(fmt.Sprintf("unknown schema of %s", index))
+}
+
+func GetSchemaVersion(index string) int {
+	entity, err := GetSchemaEntity(index)
+	if err != nil {
+		return 0
+	}
+
+	return entity.Version
+}
+
+func CurrentSchemaVersions() map[string]int {
+	versions := map[string]int{}
+	for _, entity := range schemaEntities {
+		versions[entity.Index] = entity.Version
+	}
+	for _, step := range schemaIndexSteps() {
+		versions[step.Name] = 1
+	}
+
+	return versions
+}
+
+// ReadSchemaVersion returns the version a ledger value was written with
+func ReadSchemaVersion(ledgerValue []byte) (int, error) {
+	value := schemaVersionValue{}
+	if err := json.Unmarshal(ledgerValue, &value); err != nil {
+		return 0, err
+	}
+
+	return value.SchemaVersion, nil
+}
+
+// UpcastLedgerValue brings a ledger value of an older version up to the current one
+// so that it can be unmarshaled into the current value struct
+func UpcastLedgerValue(index string, ledgerValue []byte) ([]byte, error) {
+	if len(ledgerValue) == 0 {
+		return ledgerValue, nil
+	}
+
+	entity, err := GetSchemaEntity(index)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := ReadSchemaVersion(ledgerValue)
+	if err != nil {
+		return nil, err
+	}
+	if version == entity.Version {
+		return ledgerValue, nil
+	}
+	if version > entity.Version {
+		return nil, errors.New(fmt.Sprintf("%s value version %d is newer than supported version %d", index, version, entity.Version))
+	}
+
+	// keeping numbers as they are stored
+	value := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(ledgerValue))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	for ; version < entity.Version; version++ {
+		if upcaster, ok := entity.Upcasters[version]; ok {
+			if err := upcaster(value); err != nil {
+				return nil, errors.New(fmt.Sprintf("unable to upcast %s value from version %d: %s", index, version, err.Error()))
+			}
+		}
+	}
+	value["schemaversion"] = entity.Version
+
+	return json.Marshal(value)
+}
+
+// MigrateSchema rewrites values stored with older versions, at most batchSize records per call.
+// Paginated queries are not allowed in update transactions, so the progress is kept
+// as the last visited key and the migration resumes from it on the next call.
+// Only the world state is migrated; private data is upcasted on read.
+// The config is skipped, since Init stores it in the current version in the same transaction
+// and the migration would overwrite it with the committed value.
+// The index steps follow the entities and share the position and the last key with them.
+func MigrateSchema(stub shim.ChaincodeStubInterface, batchSize int) (*SchemaMigration, error) {
+	migration := SchemaMigration{}
+	if ExistsIn(stub, &migration, schemaMigrationIndex) {
+		if err := LoadFrom(stub, &migration, schemaMigrationIndex); err != nil {
+			return nil, err
+		}
+	}
+
+	//getting transaction Timestamp
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to get transaction timestamp: %s", err.Error()))
+	}
+
+	// restarting when the chaincode was upgraded with other versions
+	versions := CurrentSchemaVersions()
+	if !migration.IsTargeting(versions) {
+		migration.Value = schemaMigrationValue{}
+		migration.Value.Versions = versions
+		migration.Value.StartTimestamp = timestamp.Seconds
+	}
+
+	if migration.Value.Completed {
+		return &migration, nil
+	}
+
+	steps := schemaIndexSteps()
+	visited := 0
+	for migration.Value.Position < len(schemaEntities)+len(steps) {
+		completed := true
+		if migration.Value.Position < len(schemaEntities) {
+			entity := schemaEntities[migration.Value.Position]
+			if entity.Index != schemaMigrationIndex && entity.Index != configIndex {
+				completed, err = migrateIndex(stub, entity, &migration, batchSize, &visited)
+			}
+		} else {
+			completed, err = fillIndex(stub, steps[migration.Value.Position-len(schemaEntities)], &migration, batchSize, &visited)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !completed {
+			break
+		}
+
+		migration.Value.Position++
+		migration.Value.LastKey = ""
+	}
+
+	migration.Value.Completed = migration.Value.Position >= len(schemaEntities)+len(steps)
+	migration.Value.Timestamp = timestamp.Seconds
+
+	if err := UpdateOrInsertIn(stub, &migration, schemaMigrationIndex, []string{""}, ""); err != nil {
+		return nil, err
+	}
+
+	return &migration, nil
+}
+
+func migrateIndex(stub shim.ChaincodeStubInterface, entity SchemaEntity, migration *SchemaMigration,
+	batchSize int, visited *int) (bool, error) {
+
+	return visitIndex(stub, entity.Index, migration, batchSize, visited, func(key string, ledgerValue []byte) error {
+		version, err := ReadSchemaVersion(ledgerValue)
+		if err != nil {
+			return errors.New(fmt.Sprintf("cannot read schema version of %s: %s", key, err.Error()))
+		}
+		if version >= entity.Version {
+			return nil
+		}
+
+		entry := entity.Create()
+		if err := entry.FillFromLedgerValue(ledgerValue); err != nil {
+			return errors.New(fmt.Sprintf("cannot fill entry value of %s: %s", key, err.Error()))
+		}
+
+		value, err := entry.ToLedgerValue()
+		if err != nil {
+			return err
+		}
+
+		if err := stub.PutState(key, value); err != nil {
+			return err
+		}
+		migration.Value.Migrated++
+
+		return nil
+	})
+}
+
+func fillIndex(stub shim.ChaincodeStubInterface, step IndexStep, migration *SchemaMigration,
+	batchSize int, visited *int) (bool, error) {
+
+	return visitIndex(stub, step.Index, migration, batchSize, visited, func(key string, ledgerValue []byte) error {
+		entry := step.Create()
+		if err := entry.FillFromLedgerValue(ledgerValue); err != nil {
+			return errors.New(fmt.Sprintf("cannot fill entry value of %s: %s", key, err.Error()))
+		}
+
+		_, compositeKeyParts, err := stub.SplitCompositeKey(key)
+		if err != nil {
+			return errors.New(fmt.Sprintf("cannot split %s into composite key parts: %s", key, err.Error()))
+		}
+		if err := entry.FillFromCompositeKeyParts(compositeKeyParts); err != nil {
+			return errors.New(fmt.Sprintf("cannot fill entry key of %s: %s", key, err.Error()))
+		}
+
+		if err := step.Indexer(stub, entry); err != nil {
+			return errors.New(fmt.Sprintf("cannot fill %s of %s: %s", step.Name, key, err.Error()))
+		}
+
+		return nil
+	})
+}
+
+// visitIndex calls visit for the records of the index after the last key, at most batchSize records in total;
+// it reports whether the index is completed
+func visitIndex(stub shim.ChaincodeStubInterface, index string, migration *SchemaMigration,
+	batchSize int, visited *int, visit func(key string, ledgerValue []byte) error) (bool, error) {
+
+	it, err := stub.GetStateByPartialCompositeKey(index, []string{})
+	if err != nil {
+		return false, errors.New(fmt.Sprintf("unable to get state by partial composite key %s: %s", index, err.Error()))
+	}
+	defer it.Close()
+
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			return false, errors.New(fmt.Sprintf("unable to get an element next to a query iterator: %s", err.Error()))
+		}
+
+		// skipping keys migrated by previous calls
+		if migration.Value.LastKey != "" && response.Key <= migration.Value.LastKey {
+			continue
+		}
+
+		if *visited >= batchSize {
+			return false, nil
+		}
+		*visited++
+		migration.Value.LastKey = response.Key
+
+		if err := visit(response.Key, response.Value); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+const (
+	schemaMigrationIndex = "SchemaMigration"
+)
+
+const (
+	schemaMigrationSchemaVersion = 1
+)
+
+type schemaMigrationKey struct {
+}
+
+type schemaMigrationValue struct {
+	Versions       map[string]int `json:"versions"`
+	Position       int            `json:"position"`
+	LastKey        string         `json:"lastkey"`
+	Migrated       int64          `json:"migrated"`
+	Completed      bool           `json:"completed"`
+	StartTimestamp int64          `json:"starttimestamp"`
+	Timestamp      int64          `json:"timestamp"`
+	SchemaVersion  int            `json:"schemaversion"`
+}
+
+type SchemaMigration struct {
+	Key   schemaMigrationKey   `json:"key"`
+	Value schemaMigrationValue `json:"value"`
+}
+
+func CreateSchemaMigration() LedgerData {
+	return new(SchemaMigration)
+}
+
+// migration state is maintained by MigrateSchema only
+func (entity *SchemaMigration) FillFromArguments(stub shim.ChaincodeStubInterface, args []string) error {
+	return nil
+}
+
+func (entity *SchemaMigration) FillFromCompositeKeyParts(compositeKeyParts []string) error {
+	return nil
+}
+
+func (entity *SchemaMigration) FillFromLedgerValue(ledgerValue []byte) error {
+	ledgerValue, err := UpcastLedgerValue(schemaMigrationIndex, ledgerValue)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(ledgerValue, &entity.Value); err != nil {
+		return err
+	} else {
+		return nil
+	}
+}
+
+func (entity *SchemaMigration) ToCompositeKey(stub shim.ChaincodeStubInterface) (string, error) {
+	compositeKeyParts := []string{""}
+
+	return stub.CreateCompositeKey(schemaMigrationIndex, compositeKeyParts)
+}
+
+func (entity *SchemaMigration) ToLedgerValue() ([]byte, error) {
+	entity.Value.SchemaVersion = schemaMigrationSchemaVersion
+	return json.Marshal(entity.Value)
+}
+
+func (entity *SchemaMigration) IsTargeting(versions map[string]int) bool {
+	if len(entity.Value.Versions) != len(versions) {
+		return false
+	}
+
+	for index, version := range versions {
+		if entity.Value.Versions[index] != version {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// migrate calls MigrateSchema in transactions until it is completed and returns the number of calls
+func migrate(t *testing.T, stub *shim.MockStub, batchSize int) int {
+	for calls := 1; calls <= 100; calls++ {
+		stub.MockTransactionStart("migrate")
+		migration, err := MigrateSchema(stub, batchSize)
+		stub.MockTransactionEnd("migrate")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if migration.Value.Completed {
+			return calls
+		}
+	}
+
+	t.Fatal("migration is not completed")
+	return 0
+}
+
+// putLegacy stores a value as if it had been written by a previous version of the chaincode
+func putLegacy(t *testing.T, stub *shim.MockStub, index string, keyParts []string, value string) {
+	key, err := stub.CreateCompositeKey(index, keyParts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stub.MockTransactionStart("legacy")
+	defer stub.MockTransactionEnd("legacy")
+	if err := stub.PutState(key, []byte(value)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrationIndexesLegacyReadings(t *testing.T) {
+	stub := shim.NewMockStub(chaincodeName, new(SupplyChainChaincode))
+
+	// readings stored before the certificate index was introduced
+	ids := []string{"11111111-1111-4111-8111-111111111111", "21111111-1111-4111-8111-111111111111", "31111111-1111-4111-8111-111111111111"}
+	for _, id := range ids {
+		putLegacy(t, stub, iotLightIndex, []string{id},
+			`{"light":1,"customfield":"device1","mspid":"org1MSP","fingerprint":"ab","valid":1,"timestamp":5,"schemaversion":`+
+				strconv.Itoa(iotLightSchemaVersion)+`}`)
+	}
+
+	if calls := migrate(t, stub, 2); calls < 2 {
+		t.Errorf("migration of %d readings in batches of 2 took %d call", len(ids), calls)
+	}
+
+	entries, err := getIndexEntries(stub, certificateUsageIndex, []string{"ab", "light"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(ids) {
+		t.Fatalf("%d readings indexed by certificate, want %d", len(entries), len(ids))
+	}
+	for i, entry := range entries {
+		if entry.KeyParts[2] != ids[i] {
+			t.Errorf("index entry %d is of reading %s, want %s", i, entry.KeyParts[2], ids[i])
+		}
+	}
+}
+
+func TestMigrationIndexesTamperRules(t *testing.T) {
+	stub := shim.NewMockStub(chaincodeName, new(SupplyChainChaincode))
+
+	// a shipment and incidents stored before the device indexes were introduced
+	putLegacy(t, stub, shipmentIndex, []string{"S1"}, `{"supplier":"org1MSP","buyer":"org2MSP","deviceids":["device1","device2"],"state":2}`)
+	open, closed := "11111111-1111-4111-8111-111111111111", "21111111-1111-4111-8111-111111111111"
+	putLegacy(t, stub, tamperIncidentIndex, []string{"S1", "device1", open}, `{"starttimestamp":10,"endtimestamp":0}`)
+	putLegacy(t, stub, tamperIncidentIndex, []string{"S1", "device2", closed}, `{"starttimestamp":10,"endtimestamp":20}`)
+
+	migrate(t, stub, 1)
+
+	tests := []struct {
+		name       string
+		index      string
+		partialKey []string
+		want       int
+	}{
+		{"shipment of the first device", shipmentDeviceIndex, []string{"device1", "S1"}, 1},
+		{"shipment of the second device", shipmentDeviceIndex, []string{"device2", "S1"}, 1},
+		{"open incident", openTamperIncidentIndex, []string{"device1", "S1", open}, 1},
+		{"closed incident", openTamperIncidentIndex, []string{"device2"}, 0},
+	}
+
+	for _, test := range tests {
+		entries, err := getIndexEntries(stub, test.index, test.partialKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != test.want {
+			t.Errorf("%s: %d index entries, want %d", test.name, len(entries), test.want)
+		}
+	}
+}
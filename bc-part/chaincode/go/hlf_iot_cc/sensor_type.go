@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"regexp"
+	"sort"
+)
+
+const (
+	sensorTypeIndex = "SensorType"
+)
+
+const (
+	sensorTypeKeyFieldsNumber      = 1
+	sensorTypeBasicArgumentsNumber = 2
+	sensorTypeSchemaVersion        = 1
+	sensorTypeMaxFields            = 32
+	sensorTypeMaxScale             = 9
+)
+
+// Types of sensor type fields
+const (
+	SensorFieldTypeNumber  = "number"
+	SensorFieldTypeBoolean = "boolean"
+	SensorFieldTypeString  = "string"
+)
+
+var sensorFieldTypes = []string{SensorFieldTypeNumber, SensorFieldTypeBoolean, SensorFieldTypeString}
+
+// names of the last seen records which are not readings
+var reservedSensorTypeNames = map[string]bool{lastSeenHeartbeat: true, lastSeenAnchor: true}
+
+var sensorNamePattern = regexp.MustCompile("^[a-z][a-zA-Z0-9]{0,31}$")
+
+type sensorTypeKey struct {
+	Name string `json:"name"`
+}
+
+// SensorField describes a value of a reading; numbers are stored as measurements with the scale,
+// and the range bounds are optional
+type SensorField struct {
+	Name  string       `json:"name"`
+	Type  string       `json:"type"`
+	Unit  string       `json:"unit,omitempty"`
+	Scale int          `json:"scale,omitempty"`
+	Min   *Measurement `json:"min,omitempty"`
+	Max   *Measurement `json:"max,omitempty"`
+}
+
+// sensorFieldArgument is a field as passed to registerSensorType, with the bounds in decimal notation
+type sensorFieldArgument struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Unit  string `json:"unit"`
+	Scale int    `json:"scale"`
+	Min   string `json:"min"`
+	Max   string `json:"max"`
+}
+
+type sensorTypeValue struct {
+	Fields        []SensorField `json:"fields"`
+	RegisteredBy  string        `json:"registeredby"`
+	Timestamp     int64         `json:"timestamp"`
+	SchemaVersion int           `json:"schemaversion"`
+}
+
+// SensorType is a sensor type registered at runtime; its readings are stored as Reading entities
+type SensorType struct {
+	Key   sensorTypeKey   `json:"key"`
+	Value sensorTypeValue `json:"value"`
+}
+
+func CreateSensorType() LedgerData {
+	return new(SensorType)
+}
+
+//argument order
+//0		1
+//Name	Fields
+func (entity *SensorType) FillFromArguments(stub shim.ChaincodeStubInterface, args []string) error {
+	if len(args) < sensorTypeBasicArgumentsNumber {
+		return errors.New(fmt.Sprintf("arguments array must contain at least %d items", sensorTypeBasicArgumentsNumber))
+	}
+
+	if err := entity.FillFromCompositeKeyParts(args[:1]); err != nil {
+		return ArgumentError("name", err)
+	}
+	if _, ok := iotSensorTypes[entity.Key.Name]; ok {
+		return ArgumentError("name", errors.New(fmt.Sprintf("%s is a built-in sensor type", entity.Key.Name)))
+	}
+	if reservedSensorTypeNames[entity.Key.Name] {
+		return ArgumentError("name", errors.New(fmt.Sprintf("%s is a reserved name", entity.Key.Name)))
+	}
+
+	fieldArguments := []sensorFieldArgument{}
+	if err := json.Unmarshal([]byte(args[1]), &fieldArguments); err != nil {
+		return ArgumentError("fields", errors.New(fmt.Sprintf("cannot unmarshaling fields: %s", err.Error())))
+	}
+	if len(fieldArguments) == 0 || len(fieldArguments) > sensorTypeMaxFields {
+		return ArgumentError("fields", errors.New(fmt.Sprintf("sensor type must have between 1 and %d fields", sensorTypeMaxFields)))
+	}
+
+	names := map[string]bool{}
+	for _, argument := range fieldArguments {
+		field, err := parseSensorField(argument)
+		if err != nil {
+			return ArgumentError("fields", errors.New(fmt.Sprintf("field %s: %s", argument.Name, err.Error())))
+		}
+		if names[field.Name] {
+			return ArgumentError("fields", errors.New(fmt.Sprintf("field %s is set more than once", field.Name)))
+		}
+		names[field.Name] = true
+		entity.Value.Fields = append(entity.Value.Fields, field)
+	}
+
+	//getting transaction Timestamp
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return InternalError(errors.New(fmt.Sprintf("unable to get transaction timestamp: %s", err.Error())))
+	}
+	entity.Value.Timestamp = timestamp.Seconds
+
+	return nil
+}
+
+func parseSensorField(argument sensorFieldArgument) (SensorField, error) {
+	field := SensorField{Name: argument.Name, Type: argument.Type}
+
+	if !sensorNamePattern.MatchString(argument.Name) {
+		return field, errors.New(fmt.Sprintf("name must match %s", sensorNamePattern.String()))
+	}
+
+	switch argument.Type {
+	case SensorFieldTypeNumber:
+		if argument.Scale < 0 || argument.Scale > sensorTypeMaxScale {
+			return field, errors.New(fmt.Sprintf("scale must be between 0 and %d", sensorTypeMaxScale))
+		}
+		field.Unit = argument.Unit
+		field.Scale = argument.Scale
+
+		format := field.Format()
+		if argument.Min != "" {
+			min, err := ParseMeasurement(argument.Min, format)
+			if err != nil {
+				return field, errors.New(fmt.Sprintf("unable to parse the minimum: %s", err.Error()))
+			}
+			field.Min = &min
+		}
+		if argument.Max != "" {
+			max, err := ParseMeasurement(argument.Max, format)
+			if err != nil {
+				return field, errors.New(fmt.Sprintf("unable to parse the maximum: %s", err.Error()))
+			}
+			field.Max = &max
+		}
+		if field.Min != nil && field.Max != nil && field.Min.Value > field.Max.Value {
+			return field, errors.New("minimum must not be larger than maximum")
+		}
+	case SensorFieldTypeBoolean, SensorFieldTypeString:
+		if argument.Unit != "" || argument.Scale != 0 || argument.Min != "" || argument.Max != "" {
+			return field, errors.New(fmt.Sprintf("unit, scale and range apply to %s fields only", SensorFieldTypeNumber))
+		}
+	default:
+		return field, errors.New(fmt.Sprintf("unknown type %s; expected one of %v", argument.Type, sensorFieldTypes))
+	}
+
+	return field, nil
+}
+
+func (entity *SensorType) FillFromCompositeKeyParts(compositeKeyParts []string) error {
+	if len(compositeKeyParts) < sensorTypeKeyFieldsNumber {
+		return errors.New(fmt.Sprintf("composite key parts array must contain at least %d items", sensorTypeKeyFieldsNumber))
+	}
+
+	if !sensorNamePattern.MatchString(compositeKeyParts[0]) {
+		return errors.New(fmt.Sprintf("sensor type name must match %s", sensorNamePattern.String()))
+	}
+
+	entity.Key.Name = compositeKeyParts[0]
+
+	return nil
+}
+
+func (entity *SensorType) FillFromLedgerValue(ledgerValue []byte) error {
+	ledgerValue, err := UpcastLedgerValue(sensorTypeIndex, ledgerValue)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(ledgerValue, &entity.Value); err != nil {
+		return err
+	} else {
+		return nil
+	}
+}
+
+func (entity *SensorType) ToCompositeKey(stub shim.ChaincodeStubInterface) (string, error) {
+	compositeKeyParts := []string{
+		entity.Key.Name,
+	}
+
+	return stub.CreateCompositeKey(sensorTypeIndex, compositeKeyParts)
+}
+
+func (entity *SensorType) ToLedgerValue() ([]byte, error) {
+	entity.Value.SchemaVersion = sensorTypeSchemaVersion
+	return json.Marshal(entity.Value)
+}
+
+func (field SensorField) Format() MeasurementFormat {
+	return MeasurementFormat{Scale: field.Scale, Unit: field.Unit}
+}
+
+// IotSensorType describes the readings of the sensor type for queries and exports;
+// they are stored as Reading entities under the name of the sensor type
+func (entity *SensorType) IotSensorType() iotSensorType {
+	sensorType := iotSensorType{
+		Index:    iotReadingIndex,
+		Create:   CreateReading,
+		Formats:  map[string]MeasurementFormat{},
+		KeyParts: []string{entity.Key.Name},
+	}
+	for _, field := range entity.Value.Fields {
+		switch field.Type {
+		case SensorFieldTypeNumber:
+			sensorType.Formats[field.Name] = field.Format()
+			sensorType.Fields = append(sensorType.Fields, "measurements."+field.Name+".value")
+		case SensorFieldTypeBoolean:
+			sensorType.Fields = append(sensorType.Fields, "flags."+field.Name)
+		case SensorFieldTypeString:
+			sensorType.Fields = append(sensorType.Fields, "labels."+field.Name)
+		}
+	}
+
+	return sensorType
+}
+
+// ParseValues checks a JSON object of values against the fields; every field must be set.
+// Numbers may be passed as JSON numbers or strings, so that they are not rounded by clients
+func (entity *SensorType) ParseValues(valuesString string) (map[string]Measurement, map[string]bool, map[string]string, error) {
+	measurements := map[string]Measurement{}
+	flags := map[string]bool{}
+	labels := map[string]string{}
+
+	values := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(valuesString)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		return nil, nil, nil, errors.New(fmt.Sprintf("cannot unmarshaling values: %s", err.Error()))
+	}
+
+	for _, field := range entity.Value.Fields {
+		value, ok := values[field.Name]
+		if !ok {
+			return nil, nil, nil, errors.New(fmt.Sprintf("value of %s must be set", field.Name))
+		}
+		delete(values, field.Name)
+
+		switch field.Type {
+		case SensorFieldTypeNumber:
+			var numberString string
+			switch number := value.(type) {
+			case json.Number:
+				numberString = number.String()
+			case string:
+				numberString = number
+			default:
+				return nil, nil, nil, errors.New(fmt.Sprintf("value of %s must be a number", field.Name))
+			}
+			measurement, err := ParseMeasurement(numberString, field.Format())
+			if err != nil {
+				return nil, nil, nil, errors.New(fmt.Sprintf("unable to parse the %s: %s", field.Name, err.Error()))
+			}
+			if (field.Min != nil && measurement.Value < field.Min.Value) || (field.Max != nil && measurement.Value > field.Max.Value) {
+				return nil, nil, nil, errors.New(fmt.Sprintf("%s %s is out of range", field.Name, measurement.String()))
+			}
+			measurements[field.Name] = measurement
+		case SensorFieldTypeBoolean:
+			flag, ok := value.(bool)
+			if !ok {
+				return nil, nil, nil, errors.New(fmt.Sprintf("value of %s must be a boolean", field.Name))
+			}
+			flags[field.Name] = flag
+		case SensorFieldTypeString:
+			label, ok := value.(string)
+			if !ok {
+				return nil, nil, nil, errors.New(fmt.Sprintf("value of %s must be a string", field.Name))
+			}
+			labels[field.Name] = label
+		}
+	}
+
+	if len(values) != 0 {
+		unknown := []string{}
+		for name := range values {
+			unknown = append(unknown, name)
+		}
+		sort.Strings(unknown)
+		return nil, nil, nil, errors.New(fmt.Sprintf("unknown fields %v", unknown))
+	}
+
+	return measurements, flags, labels, nil
+}
+
+// GetSensorType loads a sensor type registered at runtime
+func GetSensorType(stub shim.ChaincodeStubInterface, name string) (*SensorType, error) {
+	sensorType := &SensorType{}
+	if err := sensorType.FillFromCompositeKeyParts([]string{name}); err != nil {
+		return nil, err
+	}
+
+	if !ExistsIn(stub, sensorType, sensorTypeIndex) {
+		return nil, errors.New(fmt.Sprintf("unknown sensor type %s", name))
+	}
+
+	if err := LoadFrom(stub, sensorType, sensorTypeIndex); err != nil {
+		return nil, InternalError(err)
+	}
+
+	return sensorType, nil
+}
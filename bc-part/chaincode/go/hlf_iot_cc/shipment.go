@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+const (
+	shipmentIndex = "Shipment"
+)
+
+const (
+	shipmentKeyFieldsNumber      = 1
+	shipmentBasicArgumentsNumber = 7
+	shipmentSchemaVersion        = 1
+)
+
+// Shipment states
+const (
+	ShipmentStateUnknown = iota
+	ShipmentStateCreated
+	ShipmentStateInTransit
+	ShipmentStateDelivered
+	ShipmentStateAccepted
+	ShipmentStateDisputed
+)
+
+var shipmentStatesAutomaton = map[int][]int{
+	ShipmentStateCreated:   {ShipmentStateInTransit},
+	ShipmentStateInTransit: {ShipmentStateDelivered},
+	ShipmentStateDelivered: {ShipmentStateAccepted, ShipmentStateDisputed},
+}
+
+// Shipment conditions
+const (
+	ConditionHumidity     = "humidity"
+	ConditionTemperature  = "temperature"
+	ConditionVibration    = "vibration"
+	ConditionLight        = "light"
+	ConditionAcceleration = "acceleration"
+)
+
+var shipmentConditions = []string{ConditionHumidity, ConditionTemperature, ConditionVibration, ConditionLight, ConditionAcceleration}
+
+type shipmentKey struct {
+	ID string `json:"id"`
+}
+
+type ConditionRange struct {
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+}
+
+type CustodyTransfer struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+type shipmentValue struct {
+	Supplier           string                    `json:"supplier"`
+	Buyer              string                    `json:"buyer"`
+	Origin             string                    `json:"origin"`
+	Destination        string                    `json:"destination"`
+	DeviceIDs          []string                  `json:"deviceids"`
+	Conditions         map[string]ConditionRange `json:"conditions"`
+	State              int                       `json:"state"`
+	Custodian          string                    `json:"custodian"`
+	PendingCustodian   string                    `json:"pendingcustodian"`
+	CustodyTransfers   []CustodyTransfer         `json:"custodytransfers"`
+	DepartureTimestamp int64                     `json:"departuretimestamp"`
+	DeliveryTimestamp  int64                     `json:"deliverytimestamp"`
+	Timestamp          int64                     `json:"timestamp"`
+	SchemaVersion      int                       `json:"schemaversion"`
+}
+
+type Shipment struct {
+	Key   shipmentKey   `json:"key"`
+	Value shipmentValue `json:"value"`
+}
+
+func CreateShipment() LedgerData {
+	return new(Shipment)
+}
+
+//argument order
+//0		1			2		3		4			5			6
+//ID	Supplier	Buyer	Origin	Destination	DeviceIDs	Conditions
+func (entity *Shipment) FillFromArguments(stub shim.ChaincodeStubInterface, args []string) error {
+	if len(args) < shipmentBasicArgumentsNumber {
+		return errors.New(fmt.Sprintf("arguments array must contain at least %d items", shipmentBasicArgumentsNumber))
+	}
+
+	if err := entity.FillFromCompositeKeyParts(args[:shipmentKeyFieldsNumber]); err != nil {
+		return ArgumentError("id", err)
+	}
+
+	supplier := args[1]
+	if supplier == "" {
+		message := fmt.Sprintf("supplier must be not empty")
+		return ArgumentError("supplier", errors.New(message))
+	}
+	entity.Value.Supplier = supplier
+
+	buyer := args[2]
+	if buyer == "" {
+		message := fmt.Sprintf("buyer must be not empty")
+		return ArgumentError("buyer", errors.New(message))
+	}
+	if buyer == supplier {
+		return ArgumentError("buyer", errors.New("buyer must differ from supplier"))
+	}
+	entity.Value.Buyer = buyer
+
+	origin := args[3]
+	if origin == "" {
+		message := fmt.Sprintf("origin must be not empty")
+		return ArgumentError("origin", errors.New(message))
+	}
+	entity.Value.Origin = origin
+
+	destination := args[4]
+	if destination == "" {
+		message := fmt.Sprintf("destination must be not empty")
+		return ArgumentError("destination", errors.New(message))
+	}
+	entity.Value.Destination = destination
+
+	// checking device IDs
+	if len(args[5]) == 0 {
+		return ArgumentError("deviceIDs", errors.New(fmt.Sprintf("device IDs must be not empty")))
+	}
+	deviceIDs := []string{}
+	if err := json.Unmarshal([]byte(args[5]), &deviceIDs); err != nil {
+		return ArgumentError("deviceIDs", errors.New(fmt.Sprintf("cannot unmarshaling device IDs: %s", err.Error())))
+	}
+	if len(deviceIDs) == 0 {
+		return ArgumentError("deviceIDs", errors.New("shipment must be bound to at least one device"))
+	}
+	entity.Value.DeviceIDs = deviceIDs
+
+	// checking conditions
+	conditions := map[string]ConditionRange{}
+	if len(args[6]) != 0 {
+		if err := json.Unmarshal([]byte(args[6]), &conditions); err != nil {
+			return ArgumentError("conditions", errors.New(fmt.Sprintf("cannot unmarshaling conditions: %s", err.Error())))
+		}
+	}
+	for name, condition := range conditions {
+		known := false
+		for _, shipmentCondition := range shipmentConditions {
+			if name == shipmentCondition {
+				known = true
+			}
+		}
+		if !known {
+			return ArgumentError("conditions", errors.New(fmt.Sprintf("unknown condition %s; expected one of %v", name, shipmentConditions)))
+		}
+		if condition.Min == nil && condition.Max == nil {
+			return ArgumentError("conditions", errors.New(fmt.Sprintf("condition %s must contain min or max", name)))
+		}
+		if condition.Min != nil && condition.Max != nil && *condition.Min > *condition.Max {
+			return ArgumentError("conditions", errors.New(fmt.Sprintf("condition %s min must be less than or equal to max", name)))
+		}
+	}
+	entity.Value.Conditions = conditions
+
+	//getting transaction Timestamp
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return InternalError(errors.New(fmt.Sprintf("unable to get transaction timestamp: %s", err.Error())))
+	}
+	entity.Value.Timestamp = timestamp.Seconds
+
+	entity.Value.State = ShipmentStateCreated
+	entity.Value.Custodian = supplier
+	entity.Value.CustodyTransfers = []CustodyTransfer{}
+
+	return nil
+}
+
+func (entity *Shipment) FillFromCompositeKeyParts(compositeKeyParts []string) error {
+	if len(compositeKeyParts) < shipmentKeyFieldsNumber {
+		return errors.New(fmt.Sprintf("composite key parts array must contain at least %d items", shipmentKeyFieldsNumber))
+	}
+
+	if compositeKeyParts[0] == "" {
+		return errors.New("shipment ID must be not empty")
+	}
+
+	entity.Key.ID = compositeKeyParts[0]
+
+	return nil
+}
+
+func (entity *Shipment) FillFromLedgerValue(ledgerValue []byte) error {
+	ledgerValue, err := UpcastLedgerValue(shipmentIndex, ledgerValue)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(ledgerValue, &entity.Value); err != nil {
+		return err
+	} else {
+		return nil
+	}
+}
+
+func (entity *Shipment) ToCompositeKey(stub shim.ChaincodeStubInterface) (string, error) {
+	compositeKeyParts := []string{
+		entity.Key.ID,
+	}
+
+	return stub.CreateCompositeKey(shipmentIndex, compositeKeyParts)
+}
+
+func (entity *Shipment) ToLedgerValue() ([]byte, error) {
+	entity.Value.SchemaVersion = shipmentSchemaVersion
+	return json.Marshal(entity.Value)
+}
+
+func (entity *Shipment) IsBoundTo(deviceID string) bool {
+	for _, id := range entity.Value.DeviceIDs {
+		if id == deviceID {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/msp"
+)
+
+// committedStub keeps the writes of a transaction apart from the state like a peer does,
+// so that reads return committed values only
+type committedStub struct {
+	*shim.MockStub
+	args    []string
+	writes  map[string][]byte
+	creator []byte
+}
+
+func newCommittedStub() *committedStub {
+	return &committedStub{MockStub: shim.NewMockStub(chaincodeName, new(SupplyChainChaincode))}
+}
+
+func (stub *committedStub) GetFunctionAndParameters() (string, []string) {
+	return "init", stub.args
+}
+
+func (stub *committedStub) GetCreator() ([]byte, error) {
+	return stub.creator, nil
+}
+
+func (stub *committedStub) PutState(key string, value []byte) error {
+	stub.writes[key] = value
+	return nil
+}
+
+func (stub *committedStub) DelState(key string) error {
+	stub.writes[key] = nil
+	return nil
+}
+
+// init runs Init with the arguments in a transaction and commits its writes
+func (stub *committedStub) init(t *testing.T, args ...string) {
+	stub.args = args
+	stub.writes = map[string][]byte{}
+
+	stub.MockTransactionStart("init")
+	defer stub.MockTransactionEnd("init")
+	if response := new(SupplyChainChaincode).Init(stub); response.Status != shim.OK {
+		t.Fatalf("Init failed: %s", response.Message)
+	}
+	for key, value := range stub.writes {
+		if value == nil {
+			stub.MockStub.DelState(key)
+		} else {
+			stub.MockStub.PutState(key, value)
+		}
+	}
+}
+
+// putCommitted stores a value as if it had been written by a previous transaction
+func (stub *committedStub) putCommitted(t *testing.T, key string, value []byte) {
+	stub.MockTransactionStart("put")
+	defer stub.MockTransactionEnd("put")
+	if err := stub.MockStub.PutState(key, value); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testCA is a self-signed CA which issues device certificates
+type testCA struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+	PEM         string
+}
+
+func newTestCA(t *testing.T, organization string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca." + organization, Organization: []string{organization}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCA{certificate: certificate, key: key, PEM: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))}
+}
+
+// Issue returns a PEM certificate of the common name signed by the CA
+func (ca *testCA) Issue(t *testing.T, commonName string) string {
+	return ca.issue(t, commonName, nil)
+}
+
+// IssueWithAttributes returns a PEM certificate carrying the attributes the way the Fabric CA stores them
+func (ca *testCA) IssueWithAttributes(t *testing.T, commonName string, attributes map[string]string) string {
+	value, err := json.Marshal(map[string]interface{}{"attrs": attributes})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ca.issue(t, commonName, []pkix.Extension{{Id: []int{1, 2, 3, 4, 5, 6, 7, 8, 1}, Value: value}})
+}
+
+// Identity returns a serialized identity of the MSP with a certificate carrying the attributes
+func (ca *testCA) Identity(t *testing.T, mspid string, commonName string, attributes map[string]string) []byte {
+	identity, err := proto.Marshal(&msp.SerializedIdentity{Mspid: mspid, IdBytes: []byte(ca.IssueWithAttributes(t, commonName, attributes))})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return identity
+}
+
+func (ca *testCA) issue(t *testing.T, commonName string, extensions []pkix.Extension) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:    big.NewInt(2),
+		Subject:         pkix.Name{CommonName: commonName},
+		NotBefore:       time.Now().Add(-time.Hour),
+		NotAfter:        time.Now().Add(time.Hour),
+		ExtraExtensions: extensions,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.certificate, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/satori/go.uuid"
+	"strconv"
+)
+
+const (
+	tamperIncidentIndex = "TamperIncident"
+)
+
+const (
+	tamperIncidentKeyFieldsNumber      = 3
+	tamperIncidentBasicArgumentsNumber = 0
+	tamperIncidentSchemaVersion        = 1
+)
+
+// vibration up to this number of seconds before the light turns on is taken as handling of the package
+const tamperVibrationWindowSeconds = 300
+
+// Indexes of the tamper rules keyed by the device ID first
+const (
+	vibrationDeviceIndex    = "VibrationByDevice"
+	shipmentDeviceIndex     = "ShipmentByDevice"
+	openTamperIncidentIndex = "OpenTamperIncidentByDevice"
+)
+
+// vibrations are indexed by hour, so that the window is looked up in one or two buckets
+const vibrationBucketSeconds = 3600
+
+type tamperIncidentKey struct {
+	ShipmentID string `json:"shipmentid"`
+	DeviceID   string `json:"deviceid"`
+	ID         string `json:"id"`
+}
+
+type tamperIncidentValue struct {
+	LightID        string   `json:"lightid"`
+	VibrationIDs   []string `json:"vibrationids"`
+	StartTimestamp int64    `json:"starttimestamp"`
+	// zero while the package is open
+	EndTimestamp  int64 `json:"endtimestamp"`
+	Timestamp     int64 `json:"timestamp"`
+	SchemaVersion int   `json:"schemaversion"`
+}
+
+type TamperIncident struct {
+	Key   tamperIncidentKey   `json:"key"`
+	Value tamperIncidentValue `json:"value"`
+}
+
+func CreateTamperIncident() LedgerData {
+	return new(TamperIncident)
+}
+
+// incidents are recorded by addIotLight only
+func (entity *TamperIncident) FillFromArguments(stub shim.ChaincodeStubInterface, args []string) error {
+	if len(args) < tamperIncidentBasicArgumentsNumber {
+		return errors.New(fmt.Sprintf("arguments array must contain at least %d items", tamperIncidentBasicArgumentsNumber))
+	}
+	return nil
+}
+
+func (entity *TamperIncident) FillFromCompositeKeyParts(compositeKeyParts []string) error {
+	if len(compositeKeyParts) < tamperIncidentKeyFieldsNumber {
+		return errors.New(fmt.Sprintf("composite key parts array must contain at least %d items", tamperIncidentKeyFieldsNumber))
+	}
+
+	if id, err := uuid.FromString(compositeKeyParts[2]); err != nil {
+		return errors.New(fmt.Sprintf("unable to parse an ID from \"%s\"", compositeKeyParts[2]))
+	} else if id.Version() != uuid.V4 {
+		return errors.New("wrong ID format; expected UUID version 4")
+	}
+
+	entity.Key.ShipmentID = compositeKeyParts[0]
+	entity.Key.DeviceID = compositeKeyParts[1]
+	entity.Key.ID = compositeKeyParts[2]
+
+	return nil
+}
+
+func (entity *TamperIncident) FillFromLedgerValue(ledgerValue []byte) error {
+	ledgerValue, err := UpcastLedgerValue(tamperIncidentIndex, ledgerValue)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(ledgerValue, &entity.Value); err != nil {
+		return err
+	} else {
+		return nil
+	}
+}
+
+func (entity *TamperIncident) ToCompositeKey(stub shim.ChaincodeStubInterface) (string, error) {
+	compositeKeyParts := []string{
+		entity.Key.ShipmentID,
+		entity.Key.DeviceID,
+		entity.Key.ID,
+	}
+
+	return stub.CreateCompositeKey(tamperIncidentIndex, compositeKeyParts)
+}
+
+func (entity *TamperIncident) ToLedgerValue() ([]byte, error) {
+	entity.Value.SchemaVersion = tamperIncidentSchemaVersion
+	return json.Marshal(entity.Value)
+}
+
+func (entity *TamperIncident) IsOpen() bool {
+	return entity.Value.EndTimestamp == 0
+}
+
+// CheckTamper applies the tamper rules to a light reading of the device:
+// a light-on transition with vibration shortly before it opens an incident for every sealed shipment
+// the device is bound to, and a light-off transition closes the open incidents of the device.
+// Shipments are sealed while they are in transit. Readings older than the latest transition are late
+// and do not change the state. Only keys prefixed with the device ID are read, so readings of other
+// devices neither slow the check down nor conflict with it. Returns the event values to emit
+func CheckTamper(stub shim.ChaincodeStubInterface, deviceID string, light *Light) ([]EventValue, error) {
+	return NewRuleChecker(stub).CheckTamper(deviceID, light)
+}
+
+func (checker *RuleChecker) CheckTamper(deviceID string, light *Light) ([]EventValue, error) {
+	eventValues := []EventValue{}
+	if deviceID == "" {
+		return eventValues, nil
+	}
+
+	state, err := checker.lightState(deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	isOn := light.Value.Light != 0
+	if isOn == state.Value.On || (state.Value.LightID != "" && light.Value.Timestamp < state.Value.Timestamp) {
+		return eventValues, nil
+	}
+
+	state.Value.On = isOn
+	state.Value.LightID = light.Key.ID
+	state.Value.Timestamp = light.Value.Timestamp
+	if err := UpdateOrInsertIn(checker.stub, state, lightStateIndex, []string{""}, ""); err != nil {
+		return nil, err
+	}
+
+	if !isOn {
+		return checker.closeTamperIncidents(deviceID, light)
+	}
+
+	shipmentIDs, err := findSealedShipments(checker.stub, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if len(shipmentIDs) == 0 {
+		return eventValues, nil
+	}
+
+	vibrationIDs, err := checker.findVibrations(deviceID, light.Value.Timestamp-tamperVibrationWindowSeconds, light.Value.Timestamp)
+	if err != nil {
+		return nil, err
+	}
+	if len(vibrationIDs) == 0 {
+		return eventValues, nil
+	}
+
+	//getting transaction Timestamp
+	timestamp, err := checker.stub.GetTxTimestamp()
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to get transaction timestamp: %s", err.Error()))
+	}
+
+	incidents, err := checker.openIncidents(deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, shipmentID := range shipmentIDs {
+		u, err := uuid.NewV4()
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("unable to generate uuid: %s", err.Error()))
+		}
+
+		incident := &TamperIncident{}
+		incident.Key.ShipmentID = shipmentID
+		incident.Key.DeviceID = deviceID
+		incident.Key.ID = u.String()
+		incident.Value.LightID = light.Key.ID
+		incident.Value.VibrationIDs = vibrationIDs
+		incident.Value.StartTimestamp = light.Value.Timestamp
+		incident.Value.Timestamp = timestamp.Seconds
+
+		if err := UpdateOrInsertIn(checker.stub, incident, tamperIncidentIndex, []string{""}, ""); err != nil {
+			return nil, err
+		}
+		if err := putIndexEntry(checker.stub, openTamperIncidentIndex, []string{deviceID, shipmentID, incident.Key.ID}, ""); err != nil {
+			return nil, err
+		}
+		incidents = append(incidents, incident)
+
+		eventValue := EventValue{}
+		eventValue.EntityType = tamperIncidentIndex
+		eventValue.EntityID = incident.Key.ID
+		eventValue.Other = *incident
+		eventValue.Action = eventTamperIncident
+		eventValue.Priority = EventPriorityHigh
+
+		eventValues = append(eventValues, eventValue)
+	}
+	checker.incidents[deviceID] = incidents
+
+	return eventValues, nil
+}
+
+func (checker *RuleChecker) closeTamperIncidents(deviceID string, light *Light) ([]EventValue, error) {
+	eventValues := []EventValue{}
+
+	incidents, err := checker.openIncidents(deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	stillOpen := []*TamperIncident{}
+	for _, incident := range incidents {
+		if incident.Value.StartTimestamp > light.Value.Timestamp {
+			stillOpen = append(stillOpen, incident)
+			continue
+		}
+
+		incident.Value.EndTimestamp = light.Value.Timestamp
+
+		if err := UpdateOrInsertIn(checker.stub, incident, tamperIncidentIndex, []string{""}, ""); err != nil {
+			return nil, err
+		}
+		if err := deleteIndexEntry(checker.stub, openTamperIncidentIndex, []string{deviceID, incident.Key.ShipmentID, incident.Key.ID}); err != nil {
+			return nil, err
+		}
+
+		eventValue := EventValue{}
+		eventValue.EntityType = tamperIncidentIndex
+		eventValue.EntityID = incident.Key.ID
+		eventValue.Other = *incident
+		eventValue.Action = eventTamperIncidentEnd
+		eventValue.Priority = EventPriorityHigh
+
+		eventValues = append(eventValues, eventValue)
+	}
+	checker.incidents[deviceID] = stillOpen
+
+	return eventValues, nil
+}
+
+// findSealedShipments returns IDs of the shipments in transit the device is bound to
+func findSealedShipments(stub shim.ChaincodeStubInterface, deviceID string) ([]string, error) {
+	entries, err := getIndexEntries(stub, shipmentDeviceIndex, []string{deviceID})
+	if err != nil {
+		return nil, err
+	}
+
+	shipmentIDs := []string{}
+	for _, entry := range entries {
+		shipment := Shipment{}
+		if err := shipment.FillFromCompositeKeyParts(entry.KeyParts[1:]); err != nil {
+			return nil, err
+		}
+		if err := LoadFrom(stub, &shipment, shipmentIndex); err != nil {
+			return nil, err
+		}
+		if shipment.Value.State == ShipmentStateInTransit {
+			shipmentIDs = append(shipmentIDs, shipment.Key.ID)
+		}
+	}
+
+	return shipmentIDs, nil
+}
+
+// findVibrations returns IDs of the vibrations of the device between the device timestamps
+func findVibrations(stub shim.ChaincodeStubInterface, deviceID string, from int64, to int64) ([]string, error) {
+	if from < 0 {
+		from = 0
+	}
+
+	vibrationIDs := []string{}
+	for bucket := from / vibrationBucketSeconds; bucket <= to/vibrationBucketSeconds; bucket++ {
+		entries, err := getIndexEntries(stub, vibrationDeviceIndex, []string{deviceID, strconv.FormatInt(bucket, 10)})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			timestamp, err := strconv.ParseInt(string(entry.Value), 10, 64)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("unable to parse the timestamp of %s: %s", entry.Key, err.Error()))
+			}
+			if from <= timestamp && timestamp <= to {
+				vibrationIDs = append(vibrationIDs, entry.KeyParts[2])
+			}
+		}
+	}
+
+	return vibrationIDs, nil
+}
+
+// findVibrations adds vibrations recorded earlier in the transaction to the indexed ones
+func (checker *RuleChecker) findVibrations(deviceID string, from int64, to int64) ([]string, error) {
+	vibrationIDs, err := findVibrations(checker.stub, deviceID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, vibration := range checker.vibrations[deviceID] {
+		if from <= vibration.Value.Timestamp && vibration.Value.Timestamp <= to {
+			vibrationIDs = append(vibrationIDs, vibration.Key.ID)
+		}
+	}
+
+	return vibrationIDs, nil
+}
+
+// IndexVibration records a vibration under the device for the tamper rules; readings without vibration are not needed
+func IndexVibration(stub shim.ChaincodeStubInterface, vibration *Vibration) error {
+	if vibration.Value.CustomField == "" || vibration.Value.Vibration == 0 {
+		return nil
+	}
+
+	bucket := strconv.FormatInt(vibration.Value.Timestamp/vibrationBucketSeconds, 10)
+	return putIndexEntry(stub, vibrationDeviceIndex, []string{vibration.Value.CustomField, bucket, vibration.Key.ID},
+		strconv.FormatInt(vibration.Value.Timestamp, 10))
+}
+
+// IndexVibration records the vibration for the rules checked later in the transaction as well
+func (checker *RuleChecker) IndexVibration(vibration *Vibration) error {
+	if err := IndexVibration(checker.stub, vibration); err != nil {
+		return err
+	}
+
+	if vibration.Value.CustomField != "" && vibration.Value.Vibration != 0 {
+		deviceID := vibration.Value.CustomField
+		checker.vibrations[deviceID] = append(checker.vibrations[deviceID], vibration)
+	}
+
+	return nil
+}
+
+// IndexShipmentDevices records the shipment under every device it is bound to
+func IndexShipmentDevices(stub shim.ChaincodeStubInterface, shipment *Shipment) error {
+	for _, deviceID := range shipment.Value.DeviceIDs {
+		if err := putIndexEntry(stub, shipmentDeviceIndex, []string{deviceID, shipment.Key.ID}, ""); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// indexShipmentTamperRules indexes a shipment stored before the device indexes were introduced;
+// it is a step of the schema migration
+func indexShipmentTamperRules(stub shim.ChaincodeStubInterface, entry LedgerData) error {
+	return IndexShipmentDevices(stub, entry.(*Shipment))
+}
+
+// indexOpenTamperIncident indexes an open incident stored before the device indexes were introduced;
+// it is a step of the schema migration
+func indexOpenTamperIncident(stub shim.ChaincodeStubInterface, entry LedgerData) error {
+	incident := entry.(*TamperIncident)
+	if !incident.IsOpen() {
+		return nil
+	}
+
+	return putIndexEntry(stub, openTamperIncidentIndex, []string{incident.Key.DeviceID, incident.Key.ShipmentID, incident.Key.ID}, "")
+}
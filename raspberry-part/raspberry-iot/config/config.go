@@ -8,7 +8,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"hlf-iot/helpers/httpwrapper"
+	"io/ioutil"
 	"math/big"
+	"os"
 	"path"
 	"strings"
 	"time"
@@ -78,6 +80,31 @@ const (
 	CALLBACK_SENSORS_DELAY_TIME_SECONDS       = 10
 	DELAY_FOR_GATHERING_DATA_IN_CYCLE_SECONDS = 30
 	DELAY_FOR_DAEMON_MILLISECONDS             = 500
+	DELAY_FOR_SAMPLING_GYROSCOPE_MILLISECONDS = 100
+	DELAY_FOR_ANCHORING_SAMPLES_SECONDS       = 300
+	DELAY_FOR_SYNCING_CONFIGURATION_SECONDS   = 60
+	DELAY_FOR_POLLING_COMMANDS_SECONDS        = 30
+	DELAY_FOR_BLINKING_LED_MILLISECONDS       = 250
+	MAX_BLINKING_LED_TIMES                    = 20
+)
+
+// Sources of the device identity, must match the identity source of the chaincode
+const (
+	IDENTITY_SOURCE_EMAIL     = "email"
+	IDENTITY_SOURCE_ATTRIBUTE = "attribute"
+)
+
+const (
+	IDENTITY_SOURCE   = IDENTITY_SOURCE_EMAIL
+	CA_ATTR_DEVICE_ID = "iot.deviceId"
+	CA_ATTR_OWNER     = "iot.owner"
+	// the device ID and the owner are read from the environment; without them the ID is derived
+	// from the serial number of the board and the owner is the default one
+	CA_DEVICE_ID_ENV        = "IOT_DEVICE_ID"
+	CA_DEVICE_OWNER_ENV     = "IOT_DEVICE_OWNER"
+	CA_DEVICE_ID_PREFIX     = "raspberry-"
+	CA_DEVICE_OWNER_DEFAULT = "hlfiot"
+	CPU_INFO_FILE           = "/proc/cpuinfo"
 )
 
 const (
@@ -98,9 +125,26 @@ const (
 	FCN_NAME_GPS                   = "addIotGps"
 	FCN_NAME_VIBRATION             = "addIotVibration"
 	FCN_NAME_LIGHT                 = "addIotLight"
+	FCN_NAME_ANCHOR                = "addIotAnchor"
+	FCN_NAME_HEARTBEAT             = "heartbeat"
+	FCN_NAME_GET_DEVICE_TWIN       = "getDeviceTwin"
+	FCN_NAME_REPORT_CONFIGURATION  = "reportConfiguration"
+	FCN_NAME_LIST_PENDING_COMMANDS = "listPendingCommands"
+	FCN_NAME_ACKNOWLEDGE_COMMAND   = "acknowledgeCommand"
 	FCN_NAME_CHECK_IOT_CERTIFICATE = "checkIotCertificate"
+	FCN_NAME_BATCH                 = "addIotBatch"
 )
 
+// Sensor types of the readings sent with FCN_NAME_BATCH
+var BatchSensors = map[string]string{
+	FCN_NAME_HUMIDITY:  "humidity",
+	FCN_NAME_BAROMETER: "barometer",
+	FCN_NAME_GYROSCOPE: "gyroscope",
+	FCN_NAME_GPS:       "gps",
+	FCN_NAME_VIBRATION: "vibration",
+	FCN_NAME_LIGHT:     "light",
+}
+
 const (
 	LED_PIN_SUCCESS_ENROLL  = 27
 	LED_PIN_BAD_GPS_DATA    = 25
@@ -110,6 +154,8 @@ const (
 const (
 	MEDIA_ROOT_PATH            = "/media/usb/"
 	CERTIFICATE_FILE_EXTENSION = "pem"
+	SAMPLES_ROOT_PATH          = "/home/pi/hlf-iot/samples/"
+	SAMPLES_FILE_EXTENSION     = "samples"
 )
 
 func B2i(b bool) uint {
@@ -119,9 +165,9 @@ func B2i(b bool) uint {
 	return 0
 }
 
-func ItsTime(time1, time2 time.Time) bool {
+func ItsTime(time1, time2 time.Time, delaySeconds int) bool {
 	diff := time2.Sub(time1).Seconds()
-	return diff > CALLBACK_SENSORS_DELAY_TIME_SECONDS
+	return diff > float64(delaySeconds)
 }
 
 func B64Decode(str string) (buf []byte, err error) {
@@ -165,6 +211,39 @@ func GetCustomField(defaultField string) string {
 	}
 }
 
+// Identity of the device for the attribute identity source, unique per board
+func GetDeviceID() string {
+	if deviceID := os.Getenv(CA_DEVICE_ID_ENV); deviceID != "" {
+		return deviceID
+	}
+
+	if cpuInfo, err := ioutil.ReadFile(CPU_INFO_FILE); err == nil {
+		for _, line := range strings.Split(string(cpuInfo), "\n") {
+			fields := strings.SplitN(line, ":", 2)
+			if len(fields) == 2 && strings.TrimSpace(fields[0]) == "Serial" {
+				if serial := strings.TrimSpace(fields[1]); serial != "" {
+					return CA_DEVICE_ID_PREFIX + serial
+				}
+			}
+		}
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		panic(fmt.Sprintf("cannot derive the device ID, set %s: %s", CA_DEVICE_ID_ENV, err.Error()))
+	}
+
+	return CA_DEVICE_ID_PREFIX + hostname
+}
+
+func GetDeviceOwner() string {
+	if owner := os.Getenv(CA_DEVICE_OWNER_ENV); owner != "" {
+		return owner
+	}
+
+	return CA_DEVICE_OWNER_DEFAULT
+}
+
 func HexToPrivateKey(hexStr string) (*ecdsa.PrivateKey, error) {
 	bytes, err := hex.DecodeString(hexStr)
 	if err != nil {
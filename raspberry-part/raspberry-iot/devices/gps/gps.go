@@ -26,9 +26,9 @@ const (
 type Gps struct {
 	Serial    *serial.Port
 	BufferStr bytes.Buffer
-	Longitude float32 `json:"longitude"`
-	Latitude  float32 `json:"latitude"`
-	Altitude  float32 `json:"altitude"`
+	Longitude float64 `json:"longitude"`
+	Latitude  float64 `json:"latitude"`
+	Altitude  float64 `json:"altitude"`
 	Timestamp int64   `json:"timestamp"`
 	Led       *led.Led
 }
@@ -89,8 +89,9 @@ func (gps *Gps) GetGpsDataInJsonString() (*queuewrapper.SendData, error) {
 	gps.Timestamp = int64(now.Unix())
 	sendData := &queuewrapper.SendData{}
 	sendData.Fcn = config.FCN_NAME_GPS
-	sendData.Args = []string{fmt.Sprintf("%f", gps.Longitude), fmt.Sprintf("%f", gps.Latitude),
-		fmt.Sprintf("%f", gps.Altitude), fmt.Sprintf("%d", gps.Timestamp)}
+	// the shortest representation keeps all decimal places reported by the module
+	sendData.Args = []string{strconv.FormatFloat(gps.Longitude, 'f', -1, 64), strconv.FormatFloat(gps.Latitude, 'f', -1, 64),
+		strconv.FormatFloat(gps.Altitude, 'f', -1, 64), fmt.Sprintf("%d", gps.Timestamp)}
 	if gps.Longitude*gps.Latitude*gps.Altitude == 0 {
 		gps.Led.SetOn()
 	}
@@ -117,24 +118,24 @@ func (gps *Gps) GetGpsData() error {
 	geoMeta := geoRegex.FindAllStringSubmatch(buffer, -1)
 	for i := 0; i < len(geoMeta); i++ {
 		if len(geoMeta[i]) >= ALTITUDE {
-			longitude, err := strconv.ParseFloat(geoMeta[i][LONGITUDE], 32)
+			longitude, err := strconv.ParseFloat(geoMeta[i][LONGITUDE], 64)
 			if err != nil {
 				return err
 			}
 
-			latitude, err := strconv.ParseFloat(geoMeta[i][LATITUDE], 32)
+			latitude, err := strconv.ParseFloat(geoMeta[i][LATITUDE], 64)
 			if err != nil {
 				return err
 			}
 
-			altitude, err := strconv.ParseFloat(geoMeta[i][ALTITUDE], 32)
+			altitude, err := strconv.ParseFloat(geoMeta[i][ALTITUDE], 64)
 			if err != nil {
 				return err
 			}
 
-			gps.Longitude = float32(longitude)
-			gps.Latitude = float32(latitude)
-			gps.Altitude = float32(altitude)
+			gps.Longitude = longitude
+			gps.Latitude = latitude
+			gps.Altitude = altitude
 		}
 	}
 
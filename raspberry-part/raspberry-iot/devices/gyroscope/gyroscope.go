@@ -6,6 +6,8 @@ import (
 	"hlf-iot/config"
 	"hlf-iot/devices/led"
 	"hlf-iot/helpers/queuewrapper"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -24,6 +26,7 @@ const (
 
 type Gyroscope struct {
 	i2c                    *i2c.I2C
+	mutex                  sync.Mutex
 	Xout                   float32 `json:"xout"`
 	XoutScaled             float32 `json:"xoutscaled"`
 	Yout                   float32 `json:"yout"`
@@ -63,6 +66,9 @@ func (gyroscope *Gyroscope) Activate() error {
 func (gyroscope *Gyroscope) GetDataInJsonString() (*queuewrapper.SendData, error) {
 	var err error
 
+	gyroscope.mutex.Lock()
+	defer gyroscope.mutex.Unlock()
+
 	err = gyroscope.GetData()
 	if err != nil {
 		return nil, err
@@ -72,13 +78,7 @@ func (gyroscope *Gyroscope) GetDataInJsonString() (*queuewrapper.SendData, error
 	gyroscope.Timestamp = int64(now.Unix())
 	sendData := &queuewrapper.SendData{}
 	sendData.Fcn = config.FCN_NAME_GYROSCOPE
-	sendData.Args = []string{fmt.Sprintf("%f", gyroscope.Xout), fmt.Sprintf("%f", gyroscope.XoutScaled),
-		fmt.Sprintf("%f", gyroscope.Yout), fmt.Sprintf("%f", gyroscope.YoutScaled),
-		fmt.Sprintf("%f", gyroscope.Zout), fmt.Sprintf("%f", gyroscope.ZoutScaled),
-		fmt.Sprintf("%f", gyroscope.AccelerationXout), fmt.Sprintf("%f", gyroscope.AccelerationXoutScaled),
-		fmt.Sprintf("%f", gyroscope.AccelerationYout), fmt.Sprintf("%f", gyroscope.AccelerationYoutScaled),
-		fmt.Sprintf("%f", gyroscope.AccelerationZout), fmt.Sprintf("%f", gyroscope.AccelerationZoutScaled),
-		fmt.Sprintf("%d", gyroscope.Timestamp)}
+	sendData.Args = gyroscope.getArgs(fmt.Sprintf("%d", gyroscope.Timestamp))
 
 	if gyroscope.Xout*gyroscope.Yout*gyroscope.Zout*gyroscope.AccelerationXout*gyroscope.AccelerationYout*gyroscope.AccelerationZout == 0 {
 		gyroscope.Led.SetOn()
@@ -91,6 +91,33 @@ func (gyroscope *Gyroscope) GetQueueElement() *queuewrapper.QueueStructure {
 	return &queuewrapper.QueueStructure{GetDataFcn: gyroscope.GetDataInJsonString}
 }
 
+// Reads a raw sample for anchoring: the addIotGyroscope arguments joined by comma,
+// with the timestamp in milliseconds. The second result is the timestamp in seconds
+func (gyroscope *Gyroscope) GetSample() (string, int64, error) {
+	gyroscope.mutex.Lock()
+	defer gyroscope.mutex.Unlock()
+
+	err := gyroscope.GetData()
+	if err != nil {
+		return "", 0, err
+	}
+
+	now := time.Now()
+	args := gyroscope.getArgs(fmt.Sprintf("%d", now.UnixNano()/int64(time.Millisecond)))
+
+	return strings.Join(args, ","), now.Unix(), nil
+}
+
+func (gyroscope *Gyroscope) getArgs(timestamp string) []string {
+	return []string{fmt.Sprintf("%f", gyroscope.Xout), fmt.Sprintf("%f", gyroscope.XoutScaled),
+		fmt.Sprintf("%f", gyroscope.Yout), fmt.Sprintf("%f", gyroscope.YoutScaled),
+		fmt.Sprintf("%f", gyroscope.Zout), fmt.Sprintf("%f", gyroscope.ZoutScaled),
+		fmt.Sprintf("%f", gyroscope.AccelerationXout), fmt.Sprintf("%f", gyroscope.AccelerationXoutScaled),
+		fmt.Sprintf("%f", gyroscope.AccelerationYout), fmt.Sprintf("%f", gyroscope.AccelerationYoutScaled),
+		fmt.Sprintf("%f", gyroscope.AccelerationZout), fmt.Sprintf("%f", gyroscope.AccelerationZoutScaled),
+		timestamp}
+}
+
 func (gyroscope *Gyroscope) GetData() error {
 	var err error
 
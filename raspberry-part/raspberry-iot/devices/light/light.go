@@ -5,6 +5,7 @@ import (
 	"github.com/davecheney/gpio"
 	"hlf-iot/config"
 	"hlf-iot/helpers/queuewrapper"
+	"hlf-iot/helpers/twinwrapper"
 	"sync"
 	"time"
 )
@@ -41,7 +42,8 @@ func callBackBoth() {
 	}
 
 	newTime := time.Now()
-	if config.ItsTime(light.CurrentTime, newTime) {
+	twin := twinwrapper.GetInstance()
+	if twin.IsEnabled(twinwrapper.SENSOR_LIGHT) && config.ItsTime(light.CurrentTime, newTime, twin.CallbackDelaySeconds()) {
 		light.CurrentTime = newTime
 		light.CurrentState = light.GetPinData()
 		light.QueueEntity.AddToQueue(light.GetQueueElement())
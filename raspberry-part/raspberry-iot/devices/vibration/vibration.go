@@ -5,6 +5,7 @@ import (
 	"github.com/davecheney/gpio"
 	"hlf-iot/config"
 	"hlf-iot/helpers/queuewrapper"
+	"hlf-iot/helpers/twinwrapper"
 	"sync"
 	"time"
 )
@@ -41,7 +42,8 @@ func callBackBoth() {
 	}
 
 	newTime := time.Now()
-	if config.ItsTime(vibration.CurrentTime, newTime) {
+	twin := twinwrapper.GetInstance()
+	if twin.IsEnabled(twinwrapper.SENSOR_VIBRATION) && config.ItsTime(vibration.CurrentTime, newTime, twin.CallbackDelaySeconds()) {
 		vibration.CurrentTime = newTime
 		vibration.CurrentState = vibration.GetPinData()
 		vibration.QueueEntity.AddToQueue(vibration.GetQueueElement())
@@ -0,0 +1,78 @@
+package anchorwrapper
+
+import (
+	"fmt"
+	"hlf-iot/config"
+	"hlf-iot/helpers/fswrapper"
+	"hlf-iot/helpers/merkle"
+	"hlf-iot/helpers/queuewrapper"
+	"sync"
+)
+
+type AnchorWrapper struct {
+	mutex   sync.Mutex
+	Samples []string `json:"samples"`
+	From    int64    `json:"from"`
+	To      int64    `json:"to"`
+}
+
+func Init() *AnchorWrapper {
+	anchorWrapper := &AnchorWrapper{}
+	anchorWrapper.Samples = []string{}
+
+	return anchorWrapper
+}
+
+func (anchorWrapper *AnchorWrapper) AddSample(sample string, timestamp int64) {
+	anchorWrapper.mutex.Lock()
+	defer anchorWrapper.mutex.Unlock()
+
+	if len(anchorWrapper.Samples) == 0 {
+		anchorWrapper.From = timestamp
+	}
+	anchorWrapper.To = timestamp
+	anchorWrapper.Samples = append(anchorWrapper.Samples, sample)
+}
+
+// Takes collected samples, keeps them in the local storage and prepares the anchor transaction.
+// Returns nil if there is nothing to anchor. The samples are kept for the next call if they cannot be stored,
+// so that no anchored sample is missing from the local storage
+func (anchorWrapper *AnchorWrapper) GetQueueElement() (*queuewrapper.QueueStructure, error) {
+	anchorWrapper.mutex.Lock()
+	defer anchorWrapper.mutex.Unlock()
+
+	samples := anchorWrapper.Samples
+	from := anchorWrapper.From
+	to := anchorWrapper.To
+
+	if len(samples) == 0 {
+		return nil, nil
+	}
+
+	root := merkle.Root(samples)
+	fileName := fmt.Sprintf("%d-%d-%s.%s", from, to, root, config.SAMPLES_FILE_EXTENSION)
+	if err := fswrapper.WriteLines(config.SAMPLES_ROOT_PATH, fileName, samples); err != nil {
+		return nil, err
+	}
+	anchorWrapper.Samples = []string{}
+
+	sendData := &queuewrapper.SendData{}
+	sendData.Fcn = config.FCN_NAME_ANCHOR
+	sendData.Args = []string{fmt.Sprintf("%d", from), fmt.Sprintf("%d", to), fmt.Sprintf("%d", len(samples)), root}
+
+	return &queuewrapper.QueueStructure{GetDataFcn: nil, PreparedData: sendData}, nil
+}
+
+// Reads anchored samples back from the local storage and builds the proof for verifyIotSample
+func GetProof(fileName string, index int) (string, []merkle.ProofItem, error) {
+	samples, err := fswrapper.ReadLines(config.SAMPLES_ROOT_PATH + fileName)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if index < 0 || index >= len(samples) {
+		return "", nil, fmt.Errorf("sample index %d is out of range", index)
+	}
+
+	return samples[index], merkle.Proof(samples, index), nil
+}
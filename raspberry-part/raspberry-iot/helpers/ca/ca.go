@@ -12,6 +12,7 @@ import (
 	"hlf-iot/helpers/fswrapper"
 	"hlf-iot/helpers/httpwrapper"
 	"net/url"
+	"strings"
 	"sync"
 )
 
@@ -19,13 +20,22 @@ type caCreds struct {
 	Login    string
 	Password string
 	Email    string
+	Attrs    []Attribute
+}
+
+// Attribute is put into the certificate by Fabric CA when ECert is set
+type Attribute struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	ECert bool   `json:"ecert"`
 }
 
 type TbsCsrReq struct {
-	X     string `json:"x"`
-	Y     string `json:"y"`
-	Login string `json:"login"`
-	Email string `json:"email"`
+	X     string      `json:"x"`
+	Y     string      `json:"y"`
+	Login string      `json:"login"`
+	Email string      `json:"email,omitempty"`
+	Attrs []Attribute `json:"attrs,omitempty"`
 }
 
 type EnrollCsrReq struct {
@@ -82,6 +92,14 @@ type BroadcastPayload struct {
 	BroadcastPayloadHash  string `json:"payload_hash"`
 }
 
+// Error body returned by the chaincode when it rejects a request
+type ChaincodeError struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Field     string `json:"field"`
+	Retryable bool   `json:"retryable"`
+}
+
 type Ca struct {
 	PrivateKey                *ecdsa.PrivateKey `json:"privatekey"`
 	CaCreds                   caCreds           `json:"cacreds"`
@@ -92,6 +110,7 @@ type Ca struct {
 	UserCertificate           *UserCertificate  `json:"usercertificate"`
 	Proposal                  *Proposal         `json:"proposal"`
 	BroadcastPayload          *BroadcastPayload `json:"broadcastpayload"`
+	ChaincodeError            *ChaincodeError   `json:"chaincodeerror"`
 }
 
 var instance *Ca
@@ -102,11 +121,29 @@ func GetInstance() *Ca {
 		instance = &Ca{}
 		instance.CaCreds.Login = config.CA_LOGIN
 		instance.CaCreds.Password = config.CA_PASSWORD
-		instance.CaCreds.Email = config.GetCustomField(config.CA_CUSTOM_FIELD)
+		if config.IDENTITY_SOURCE == config.IDENTITY_SOURCE_ATTRIBUTE {
+			instance.CaCreds.Attrs = []Attribute{
+				{Name: config.CA_ATTR_DEVICE_ID, Value: config.GetDeviceID(), ECert: true},
+				{Name: config.CA_ATTR_OWNER, Value: config.GetDeviceOwner(), ECert: true},
+			}
+		} else {
+			instance.CaCreds.Email = config.GetCustomField(config.CA_CUSTOM_FIELD)
+		}
 	})
 	return instance
 }
 
+// Identity of the device in the chaincode, depends on the identity source
+func (ca *Ca) DeviceID() string {
+	for _, attr := range ca.CaCreds.Attrs {
+		if attr.Name == config.CA_ATTR_DEVICE_ID {
+			return attr.Value
+		}
+	}
+
+	return ca.CaCreds.Email
+}
+
 // Private key generation
 func (ca *Ca) GeneratePrivateKey() error {
 	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
@@ -125,7 +162,7 @@ func (ca *Ca) TbsCsr() (*httpwrapper.SendElementStructure, error) {
 		return nil, errors.New("privateKey error")
 	}
 
-	if len(ca.CaCreds.Login) == 0 || len(ca.CaCreds.Email) == 0 {
+	if len(ca.CaCreds.Login) == 0 || (len(ca.CaCreds.Email) == 0 && len(ca.CaCreds.Attrs) == 0) {
 		return nil, errors.New("ca credentials are not initialized")
 	}
 
@@ -134,6 +171,7 @@ func (ca *Ca) TbsCsr() (*httpwrapper.SendElementStructure, error) {
 		Y:     ca.PrivateKey.Y.Text(16),
 		Login: ca.CaCreds.Login,
 		Email: ca.CaCreds.Email,
+		Attrs: ca.CaCreds.Attrs,
 	})
 
 	return &httpwrapper.SendElementStructure{
@@ -350,10 +388,12 @@ func (ca *Ca) CheckRequestBroadcastPayloadToBC(buffer string) (bool, error) {
 	}
 
 	ca.BroadcastPayload = broadcastPayload
+	ca.ChaincodeError = nil
 	if len(ca.BroadcastPayload.BroadcastPayloadHash) > 0 {
 		check = true
 	} else {
 		check = false
+		ca.ChaincodeError = ParseChaincodeError(buffer)
 	}
 
 	return check, nil
@@ -373,11 +413,15 @@ func (ca *Ca) GetCertificateFromKeyStorage() (bool, error) {
 			return check, err
 		}
 
-		var result map[string]interface{}
+		var result struct {
+			Result struct {
+				Valid  int    `json:"valid"`
+				Status string `json:"status"`
+			} `json:"result"`
+		}
 		json.Unmarshal([]byte(responseJson), &result)
-		response := result["result"].(float64)
 
-		if response == 1 {
+		if result.Result.Valid == 1 {
 			userCertificate := &UserCertificate{}
 			userCertificate.Certificate = key.Certificate
 			ca.UserCertificate = userCertificate
@@ -397,7 +441,49 @@ func (ca *Ca) GetCertificateFromKeyStorage() (bool, error) {
 
 			break
 		}
+		fmt.Println("Certificate is " + result.Result.Status)
 	}
 
 	return check, nil
 }
+
+// Finds the error body of the chaincode in a response of the API, which embeds the message of the failed proposal
+// either as is or as a JSON string. Returns nil if the response has no error body
+func ParseChaincodeError(buffer string) *ChaincodeError {
+	candidates := []string{buffer}
+	var response interface{}
+	if err := json.Unmarshal([]byte(buffer), &response); err == nil {
+		candidates = append(candidates, collectStrings(response)...)
+	}
+
+	for _, candidate := range candidates {
+		start := strings.Index(candidate, `{"code"`)
+		if start < 0 {
+			continue
+		}
+		chaincodeError := &ChaincodeError{}
+		if err := json.NewDecoder(strings.NewReader(candidate[start:])).Decode(chaincodeError); err == nil {
+			return chaincodeError
+		}
+	}
+
+	return nil
+}
+
+func collectStrings(value interface{}) []string {
+	strs := []string{}
+	switch typed := value.(type) {
+	case string:
+		strs = append(strs, typed)
+	case []interface{}:
+		for _, item := range typed {
+			strs = append(strs, collectStrings(item)...)
+		}
+	case map[string]interface{}:
+		for _, item := range typed {
+			strs = append(strs, collectStrings(item)...)
+		}
+	}
+
+	return strs
+}
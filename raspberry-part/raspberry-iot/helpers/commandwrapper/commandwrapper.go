@@ -0,0 +1,113 @@
+package commandwrapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"hlf-iot/config"
+	"hlf-iot/helpers/httpwrapper"
+	"hlf-iot/helpers/queuewrapper"
+	"net/url"
+)
+
+// Names of commands, must match the commands of the chaincode
+const (
+	COMMAND_FLUSH_QUEUE       = "flushQueue"
+	COMMAND_REREAD_KEYS       = "rereadKeys"
+	COMMAND_BLINK_LED         = "blinkLed"
+	COMMAND_SWITCH_SENSOR_OFF = "switchSensorOff"
+	COMMAND_SWITCH_SENSOR_ON  = "switchSensorOn"
+)
+
+// States of commands acknowledged by the device
+const (
+	COMMAND_STATE_ACKNOWLEDGED = 2
+	COMMAND_STATE_FAILED       = 3
+)
+
+// Handler executes the command and returns its output
+type Handler func(parameters []string) (string, error)
+
+type Command struct {
+	Key struct {
+		DeviceID string `json:"deviceid"`
+		ID       string `json:"id"`
+	} `json:"key"`
+	Value struct {
+		Command    string   `json:"command"`
+		Parameters []string `json:"parameters"`
+	} `json:"value"`
+}
+
+type commandsResponse struct {
+	Result []Command `json:"result"`
+}
+
+// Executes commands issued by operators; only commands with a registered handler are run
+type CommandWrapper struct {
+	handlers map[string]Handler
+	// commands stay pending until the acknowledgement is committed, they must not be run twice meanwhile
+	executed map[string]bool
+}
+
+func Init() *CommandWrapper {
+	commandWrapper := &CommandWrapper{}
+	commandWrapper.handlers = map[string]Handler{}
+	commandWrapper.executed = map[string]bool{}
+
+	return commandWrapper
+}
+
+func (commandWrapper *CommandWrapper) Register(command string, handler Handler) {
+	commandWrapper.handlers[command] = handler
+}
+
+// Queries pending commands of the device and executes them in the order they were issued.
+// Returns acknowledgements to send through the queue
+func (commandWrapper *CommandWrapper) Poll(deviceID string) ([]*queuewrapper.QueueStructure, error) {
+	responseJson, err := httpwrapper.GetReq(config.API_BASE_URL + "channels/" + config.CHANNEL_ID + "/chaincodes/" + config.CHAINCODE_ID + "?fcn=" + config.FCN_NAME_LIST_PENDING_COMMANDS + "&peer=" + config.EndorsementPeers[0] + "&args=" + url.QueryEscape(deviceID))
+	if err != nil {
+		return nil, err
+	}
+
+	response := &commandsResponse{}
+	if err := json.Unmarshal([]byte(responseJson), response); err != nil {
+		return nil, err
+	}
+
+	pending := map[string]bool{}
+	queueElements := []*queuewrapper.QueueStructure{}
+	for _, command := range response.Result {
+		pending[command.Key.ID] = true
+		if commandWrapper.executed[command.Key.ID] {
+			continue
+		}
+		commandWrapper.executed[command.Key.ID] = true
+
+		state := COMMAND_STATE_ACKNOWLEDGED
+		var result string
+		handler, ok := commandWrapper.handlers[command.Value.Command]
+		if !ok {
+			state = COMMAND_STATE_FAILED
+			result = fmt.Sprintf("command %s is not supported by the device", command.Value.Command)
+		} else if result, err = handler(command.Value.Parameters); err != nil {
+			state = COMMAND_STATE_FAILED
+			result = err.Error()
+		}
+		fmt.Printf("Command %s %s: %s\n", command.Key.ID, command.Value.Command, result)
+
+		sendData := &queuewrapper.SendData{}
+		sendData.Fcn = config.FCN_NAME_ACKNOWLEDGE_COMMAND
+		sendData.Args = []string{command.Key.ID, fmt.Sprintf("%d", state), result}
+
+		queueElements = append(queueElements, &queuewrapper.QueueStructure{GetDataFcn: nil, PreparedData: sendData})
+	}
+
+	// acknowledged commands are not listed anymore
+	for id := range commandWrapper.executed {
+		if !pending[id] {
+			delete(commandWrapper.executed, id)
+		}
+	}
+
+	return queueElements, nil
+}
@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 type SendElementStructure struct {
@@ -88,3 +89,20 @@ func ReadFile(path string) (config.Key, error) {
 
 	return fileData, nil
 }
+
+func WriteLines(path, fileName string, lines []string) error {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(path, fileName), []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+func ReadLines(path string) ([]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"), nil
+}
@@ -0,0 +1,17 @@
+package heartbeatwrapper
+
+import (
+	"fmt"
+	"hlf-iot/config"
+	"hlf-iot/helpers/queuewrapper"
+	"time"
+)
+
+// Tells the chaincode the device is alive while no sensor readings are sent
+func GetQueueElement() *queuewrapper.QueueStructure {
+	sendData := &queuewrapper.SendData{}
+	sendData.Fcn = config.FCN_NAME_HEARTBEAT
+	sendData.Args = []string{fmt.Sprintf("%d", time.Now().Unix())}
+
+	return &queuewrapper.QueueStructure{GetDataFcn: nil, PreparedData: sendData}
+}
@@ -0,0 +1,86 @@
+package merkle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Tree layout shared with the chaincode verifyIotSample function:
+// leaf = sha256(0x00 || sample), node = sha256(0x01 || left || right),
+// a node without a sibling is promoted to the next level unchanged.
+const (
+	leafPrefix = 0x00
+	nodePrefix = 0x01
+)
+
+type ProofItem struct {
+	Hash string `json:"hash"`
+	Left bool   `json:"left"`
+}
+
+func LeafHash(sample []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{leafPrefix})
+	h.Write(sample)
+	return h.Sum(nil)
+}
+
+func NodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{nodePrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// Builds all levels of the tree, from leaves up to the root
+func levels(samples []string) [][][]byte {
+	level := make([][]byte, 0, len(samples))
+	for _, sample := range samples {
+		level = append(level, LeafHash([]byte(sample)))
+	}
+
+	result := [][][]byte{level}
+	for len(level) > 1 {
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 < len(level) {
+				next = append(next, NodeHash(level[i], level[i+1]))
+			} else {
+				next = append(next, level[i])
+			}
+		}
+		result = append(result, next)
+		level = next
+	}
+
+	return result
+}
+
+func Root(samples []string) string {
+	if len(samples) == 0 {
+		return ""
+	}
+
+	tree := levels(samples)
+	return hex.EncodeToString(tree[len(tree)-1][0])
+}
+
+func Proof(samples []string, index int) []ProofItem {
+	proof := []ProofItem{}
+	if index < 0 || index >= len(samples) {
+		return proof
+	}
+
+	tree := levels(samples)
+	for _, level := range tree[:len(tree)-1] {
+		if index%2 == 1 {
+			proof = append(proof, ProofItem{Hash: hex.EncodeToString(level[index-1]), Left: true})
+		} else if index+1 < len(level) {
+			proof = append(proof, ProofItem{Hash: hex.EncodeToString(level[index+1]), Left: false})
+		}
+		index = index / 2
+	}
+
+	return proof
+}
@@ -0,0 +1,100 @@
+package merkle
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// verify folds the proof the way the chaincode verifyIotSample function does
+func verify(sample string, proof []ProofItem, root string) bool {
+	current := LeafHash([]byte(sample))
+	for _, item := range proof {
+		sibling, err := hex.DecodeString(item.Hash)
+		if err != nil {
+			return false
+		}
+		if item.Left {
+			current = NodeHash(sibling, current)
+		} else {
+			current = NodeHash(current, sibling)
+		}
+	}
+
+	expected, err := hex.DecodeString(root)
+	return err == nil && bytes.Equal(current, expected)
+}
+
+func TestRoot(t *testing.T) {
+	a, b, c := LeafHash([]byte("a")), LeafHash([]byte("b")), LeafHash([]byte("c"))
+
+	tests := []struct {
+		name    string
+		samples []string
+		want    string
+	}{
+		{"empty", []string{}, ""},
+		{"nil", nil, ""},
+		{"single leaf", []string{"a"}, hex.EncodeToString(a)},
+		{"two leaves", []string{"a", "b"}, hex.EncodeToString(NodeHash(a, b))},
+		// the leaf without a sibling is promoted unchanged
+		{"odd leaf count", []string{"a", "b", "c"}, hex.EncodeToString(NodeHash(NodeHash(a, b), c))},
+	}
+
+	for _, test := range tests {
+		if got := Root(test.samples); got != test.want {
+			t.Errorf("%s: Root() = %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestProof(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []string
+		depth   []int
+	}{
+		{"single leaf", []string{"a"}, []int{0}},
+		{"two leaves", []string{"a", "b"}, []int{1, 1}},
+		{"odd leaf count", []string{"a", "b", "c"}, []int{2, 2, 1}},
+		{"odd leaf count on an upper level", []string{"a", "b", "c", "d", "e"}, []int{3, 3, 3, 3, 1}},
+		{"full tree", []string{"a", "b", "c", "d", "e", "f", "g", "h"}, []int{3, 3, 3, 3, 3, 3, 3, 3}},
+		{"equal samples", []string{"a", "a", "a"}, []int{2, 2, 1}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root := Root(test.samples)
+			for index, sample := range test.samples {
+				proof := Proof(test.samples, index)
+				if len(proof) != test.depth[index] {
+					t.Fatalf("proof of sample %d has %d items, want %d", index, len(proof), test.depth[index])
+				}
+				if !verify(sample, proof, root) {
+					t.Fatalf("sample %d is not verified", index)
+				}
+				if verify(sample+"x", proof, root) {
+					t.Fatalf("changed sample %d is verified", index)
+				}
+			}
+		})
+	}
+}
+
+func TestProofOutOfRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []string
+		index   int
+	}{
+		{"empty", []string{}, 0},
+		{"negative index", []string{"a", "b"}, -1},
+		{"index past the end", []string{"a", "b", "c"}, 3},
+	}
+
+	for _, test := range tests {
+		if proof := Proof(test.samples, test.index); len(proof) != 0 {
+			t.Errorf("%s: Proof() = %v, want an empty proof", test.name, proof)
+		}
+	}
+}
@@ -2,15 +2,19 @@ package queuewrapper
 
 import (
 	"container/list"
+	"encoding/json"
 	"fmt"
 	"hlf-iot/config"
 	"hlf-iot/helpers/ca"
 	"hlf-iot/helpers/httpwrapper"
+	"sync"
 	"time"
 )
 
+// The queue is shared by the daemon and the gathering, syncing and command goroutines, so it is accessed under the mutex only
 type QueueWrapper struct {
 	Queue *list.List `json:"queue"`
+	mutex sync.Mutex
 }
 
 type SendData struct {
@@ -31,18 +35,81 @@ func Init() *QueueWrapper {
 }
 
 func (queueWrapper *QueueWrapper) AddToQueue(queueElement *QueueStructure) {
+	queueWrapper.mutex.Lock()
 	queueWrapper.Queue.PushBack(queueElement)
+	length := queueWrapper.Queue.Len()
+	queueWrapper.mutex.Unlock()
 	fmt.Printf("Queue add\n")
-	fmt.Printf("Queue length +1: %d\n", queueWrapper.Queue.Len())
+	fmt.Printf("Queue length +1: %d\n", length)
 	fmt.Println("========================================")
 }
 
+type batchItem struct {
+	Sensor string   `json:"sensor"`
+	Args   []string `json:"args"`
+}
+
+// Combines reading elements into one element, so that they are sent in a single transaction
+func Batch(elements ...*QueueStructure) *QueueStructure {
+	return &QueueStructure{GetDataFcn: func() (*SendData, error) {
+		items := []batchItem{}
+		for _, element := range elements {
+			sendData := element.PreparedData
+			if element.GetDataFcn != nil {
+				var err error
+				sendData, err = element.GetDataFcn()
+				if err != nil {
+					return nil, err
+				}
+			}
+			if sendData == nil {
+				continue
+			}
+			sensor, ok := config.BatchSensors[sendData.Fcn]
+			if !ok {
+				return nil, fmt.Errorf("%s cannot be sent in a batch", sendData.Fcn)
+			}
+			items = append(items, batchItem{Sensor: sensor, Args: sendData.Args})
+		}
+		if len(items) == 0 {
+			return nil, nil
+		}
+
+		itemsJson, err := json.Marshal(items)
+		if err != nil {
+			return nil, err
+		}
+
+		return &SendData{Fcn: config.FCN_NAME_BATCH, Args: []string{string(itemsJson)}}, nil
+	}}
+}
+
+// Takes the first element off the queue, nil if the queue is empty
+func (queueWrapper *QueueWrapper) pop() *QueueStructure {
+	queueWrapper.mutex.Lock()
+	defer queueWrapper.mutex.Unlock()
+
+	element := queueWrapper.Queue.Front()
+	if element == nil {
+		return nil
+	}
+	queueWrapper.Queue.Remove(element)
+
+	return element.Value.(*QueueStructure)
+}
+
+func (queueWrapper *QueueWrapper) Len() int {
+	queueWrapper.mutex.Lock()
+	defer queueWrapper.mutex.Unlock()
+
+	return queueWrapper.Queue.Len()
+}
+
 func (queueWrapper *QueueWrapper) StartDaemon() {
 	for {
-		element := queueWrapper.Queue.Front()
-		if element != nil {
+		queue := queueWrapper.pop()
+		if queue != nil {
 			var err error
-			queue := element.Value.(*QueueStructure)
 			var sendData *SendData
 			if queue.GetDataFcn != nil {
 				sendData, err = queue.GetDataFcn()
@@ -54,7 +121,6 @@ func (queueWrapper *QueueWrapper) StartDaemon() {
 				sendData = queue.PreparedData
 			}
 			fmt.Println("========================================")
-			queueWrapper.Queue.Remove(element)
 			if sendData != nil {
 				fmt.Println()
 				fmt.Printf("Sending data: %s", sendData)
@@ -67,7 +133,7 @@ func (queueWrapper *QueueWrapper) StartDaemon() {
 			} else {
 				fmt.Println("Remove without sending")
 			}
-			fmt.Printf("Queue length -1: %d\n", queueWrapper.Queue.Len())
+			fmt.Printf("Queue length -1: %d\n", queueWrapper.Len())
 			fmt.Println("========================================")
 		}
 		time.Sleep(config.DELAY_FOR_DAEMON_MILLISECONDS * time.Millisecond)
@@ -107,6 +173,11 @@ func (queueWrapper *QueueWrapper) PrepareRequest(data *SendData) error {
 			return err
 		}
 		if !success {
+			// requests rejected by the chaincode for good are dropped instead of being sent forever
+			if fabricCa.ChaincodeError != nil && !fabricCa.ChaincodeError.Retryable {
+				fmt.Printf("Request %s rejected: %s %s\n", data.Fcn, fabricCa.ChaincodeError.Code, fabricCa.ChaincodeError.Message)
+				return nil
+			}
 			continue
 		}
 
@@ -135,3 +206,31 @@ func (queueWrapper *QueueWrapper) PrepareRequest(data *SendData) error {
 
 	return nil
 }
+
+// Drops queued elements except the prepared ones with the given function names; returns the number of dropped elements
+func (queueWrapper *QueueWrapper) Flush(keepFcns ...string) int {
+	queueWrapper.mutex.Lock()
+	defer queueWrapper.mutex.Unlock()
+
+	dropped := 0
+	for element := queueWrapper.Queue.Front(); element != nil; {
+		next := element.Next()
+		queue := element.Value.(*QueueStructure)
+		keep := false
+		if queue.PreparedData != nil {
+			for _, fcn := range keepFcns {
+				if queue.PreparedData.Fcn == fcn {
+					keep = true
+				}
+			}
+		}
+		if !keep {
+			queueWrapper.Queue.Remove(element)
+			dropped++
+		}
+		element = next
+	}
+	fmt.Printf("Queue flush: %d dropped, length %d\n", dropped, queueWrapper.Queue.Len())
+
+	return dropped
+}
@@ -0,0 +1,152 @@
+package twinwrapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"hlf-iot/config"
+	"hlf-iot/helpers/httpwrapper"
+	"hlf-iot/helpers/queuewrapper"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Names of sensors in the configuration, as sensor types of the chaincode
+const (
+	SENSOR_GPS       = "gps"
+	SENSOR_HUMIDITY  = "humidity"
+	SENSOR_BAROMETER = "barometer"
+	SENSOR_GYROSCOPE = "gyroscope"
+	SENSOR_VIBRATION = "vibration"
+	SENSOR_LIGHT     = "light"
+)
+
+type Configuration struct {
+	GatheringIntervalSeconds int             `json:"gatheringintervalseconds"`
+	CallbackDelaySeconds     int             `json:"callbackdelayseconds"`
+	Sensors                  map[string]bool `json:"sensors"`
+}
+
+type twinResponse struct {
+	Result struct {
+		Value struct {
+			Desired        Configuration `json:"desired"`
+			DesiredVersion int           `json:"desiredversion"`
+		} `json:"value"`
+	} `json:"result"`
+}
+
+// Keeps the configuration applied by the device, desired configuration is stored in the chaincode
+type TwinWrapper struct {
+	mutex         sync.RWMutex
+	Configuration Configuration `json:"configuration"`
+	Version       int           `json:"version"`
+}
+
+var instance *TwinWrapper
+var once sync.Once
+
+// Version 0 is the configuration the device was built with
+func GetInstance() *TwinWrapper {
+	once.Do(func() {
+		instance = &TwinWrapper{}
+		instance.Configuration.GatheringIntervalSeconds = config.DELAY_FOR_GATHERING_DATA_IN_CYCLE_SECONDS
+		instance.Configuration.CallbackDelaySeconds = config.CALLBACK_SENSORS_DELAY_TIME_SECONDS
+		instance.Configuration.Sensors = map[string]bool{}
+	})
+	return instance
+}
+
+func (twin *TwinWrapper) GatheringInterval() time.Duration {
+	twin.mutex.RLock()
+	defer twin.mutex.RUnlock()
+
+	return time.Duration(twin.Configuration.GatheringIntervalSeconds) * time.Second
+}
+
+func (twin *TwinWrapper) CallbackDelaySeconds() int {
+	twin.mutex.RLock()
+	defer twin.mutex.RUnlock()
+
+	return twin.Configuration.CallbackDelaySeconds
+}
+
+// Sensors which are not listed in the configuration are enabled
+func (twin *TwinWrapper) IsEnabled(sensor string) bool {
+	twin.mutex.RLock()
+	defer twin.mutex.RUnlock()
+
+	enabled, ok := twin.Configuration.Sensors[sensor]
+	return !ok || enabled
+}
+
+// Switches off sensors disabled by the configuration; sensors which failed to initialize stay off
+func (twin *TwinWrapper) Apply(grid config.SensorsActivityGrid) config.SensorsActivityGrid {
+	grid.GpsSensor = grid.GpsSensor && twin.IsEnabled(SENSOR_GPS)
+	grid.HumiditySensor = grid.HumiditySensor && twin.IsEnabled(SENSOR_HUMIDITY)
+	grid.BarometerSensor = grid.BarometerSensor && twin.IsEnabled(SENSOR_BAROMETER)
+	grid.GyroscopeSensor = grid.GyroscopeSensor && twin.IsEnabled(SENSOR_GYROSCOPE)
+	grid.VibrationSensor = grid.VibrationSensor && twin.IsEnabled(SENSOR_VIBRATION)
+	grid.LightSensor = grid.LightSensor && twin.IsEnabled(SENSOR_LIGHT)
+
+	return grid
+}
+
+// Queries the desired configuration of the device and applies it if it is newer than the applied one.
+// Returns the report of the applied configuration or nil if nothing changed
+func (twin *TwinWrapper) Sync(deviceID string) (*queuewrapper.QueueStructure, error) {
+	responseJson, err := httpwrapper.GetReq(config.API_BASE_URL + "channels/" + config.CHANNEL_ID + "/chaincodes/" + config.CHAINCODE_ID + "?fcn=" + config.FCN_NAME_GET_DEVICE_TWIN + "&peer=" + config.EndorsementPeers[0] + "&args=" + url.QueryEscape(deviceID))
+	if err != nil {
+		return nil, err
+	}
+
+	// there is no twin until the desired configuration is set for the device
+	response := &twinResponse{}
+	if err := json.Unmarshal([]byte(responseJson), response); err != nil {
+		return nil, nil
+	}
+
+	desired := response.Result.Value.Desired
+	version := response.Result.Value.DesiredVersion
+	if desired.GatheringIntervalSeconds <= 0 || desired.CallbackDelaySeconds <= 0 {
+		return nil, nil
+	}
+	if desired.Sensors == nil {
+		desired.Sensors = map[string]bool{}
+	}
+
+	twin.mutex.Lock()
+	if version <= twin.Version {
+		twin.mutex.Unlock()
+		return nil, nil
+	}
+	twin.Configuration = desired
+	twin.Version = version
+	twin.mutex.Unlock()
+
+	fmt.Printf("Applied configuration version %d\n", version)
+
+	configurationJson, err := json.Marshal(desired)
+	if err != nil {
+		return nil, err
+	}
+
+	sendData := &queuewrapper.SendData{}
+	sendData.Fcn = config.FCN_NAME_REPORT_CONFIGURATION
+	sendData.Args = []string{fmt.Sprintf("%d", version), string(configurationJson)}
+
+	return &queuewrapper.QueueStructure{GetDataFcn: nil, PreparedData: sendData}, nil
+}
+
+// Switches the sensor until the next desired configuration is applied
+func (twin *TwinWrapper) SetEnabled(sensor string, enabled bool) {
+	twin.mutex.Lock()
+	defer twin.mutex.Unlock()
+
+	sensors := map[string]bool{}
+	for name, value := range twin.Configuration.Sensors {
+		sensors[name] = value
+	}
+	sensors[sensor] = enabled
+	twin.Configuration.Sensors = sensors
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"hlf-iot/config"
 	"hlf-iot/devices/barometer"
@@ -10,10 +11,16 @@ import (
 	"hlf-iot/devices/led"
 	"hlf-iot/devices/light"
 	"hlf-iot/devices/vibration"
+	"hlf-iot/helpers/anchorwrapper"
 	"hlf-iot/helpers/ca"
+	"hlf-iot/helpers/commandwrapper"
+	"hlf-iot/helpers/heartbeatwrapper"
 	"hlf-iot/helpers/queuewrapper"
+	"hlf-iot/helpers/twinwrapper"
 	"os"
 	"os/signal"
+	"strconv"
+	"sync"
 	"syscall"
 	"time"
 )
@@ -94,6 +101,9 @@ func execute() {
 	if success && sensorsActivityGrid.LedSuccessEnroll {
 		ledSuccessEnroll.SetOn()
 	}
+	// the enrolment state is changed by the command handlers, so it is accessed under the lock only
+	var enrolledMutex sync.Mutex
+	enrolled := success
 
 	humiditySensor, err := humidity.Init(ledBadSensorData)
 	if err != nil {
@@ -184,26 +194,158 @@ func execute() {
 	// Start queue daemon
 	go queue.StartDaemon()
 
+	// Keep raw gyroscope samples locally and anchor them periodically
+	if sensorsActivityGrid.GyroscopeSensor {
+		anchor := anchorwrapper.Init()
+
+		go func() {
+			for {
+				sample, timestamp, err := gyroscopeSensor.GetSample()
+				if err != nil {
+					fmt.Println("Error: ", err.Error())
+				} else {
+					anchor.AddSample(sample, timestamp)
+				}
+				time.Sleep(config.DELAY_FOR_SAMPLING_GYROSCOPE_MILLISECONDS * time.Millisecond)
+			}
+		}()
+
+		go func() {
+			for {
+				time.Sleep(config.DELAY_FOR_ANCHORING_SAMPLES_SECONDS * time.Second)
+				queueElement, err := anchor.GetQueueElement()
+				if err != nil {
+					fmt.Println("Error: ", err.Error())
+					continue
+				}
+				if queueElement != nil {
+					queue.AddToQueue(queueElement)
+				}
+			}
+		}()
+	}
+
+	// Apply desired configuration from the chaincode and report it back
+	twin := twinwrapper.GetInstance()
+	go func() {
+		for {
+			queueElement, err := twin.Sync(fabricCa.DeviceID())
+			if err != nil {
+				fmt.Println("Error: ", err.Error())
+			} else if queueElement != nil {
+				queue.AddToQueue(queueElement)
+			}
+			time.Sleep(config.DELAY_FOR_SYNCING_CONFIGURATION_SECONDS * time.Second)
+		}
+	}()
+
+	// Execute commands issued by operators and acknowledge them through the queue
+	commands := commandwrapper.Init()
+	commands.Register(commandwrapper.COMMAND_FLUSH_QUEUE, func(parameters []string) (string, error) {
+		dropped := queue.Flush(config.FCN_NAME_ACKNOWLEDGE_COMMAND, config.FCN_NAME_REPORT_CONFIGURATION)
+		return fmt.Sprintf("%d queue elements dropped", dropped), nil
+	})
+	commands.Register(commandwrapper.COMMAND_REREAD_KEYS, func(parameters []string) (string, error) {
+		loaded, err := fabricCa.GetCertificateFromKeyStorage()
+		if err != nil {
+			return "", err
+		}
+		enrolledMutex.Lock()
+		enrolled = loaded
+		if sensorsActivityGrid.LedSuccessEnroll {
+			if loaded {
+				ledSuccessEnroll.SetOn()
+			} else {
+				ledSuccessEnroll.SetOff()
+			}
+		}
+		enrolledMutex.Unlock()
+		return fmt.Sprintf("certificate loaded: %t", loaded), nil
+	})
+	commands.Register(commandwrapper.COMMAND_BLINK_LED, func(parameters []string) (string, error) {
+		if !sensorsActivityGrid.LedSuccessEnroll {
+			return "", fmt.Errorf("LED is not available")
+		}
+		times := 10
+		if len(parameters) > 0 {
+			parsed, err := strconv.Atoi(parameters[0])
+			if err != nil {
+				return "", err
+			}
+			times = parsed
+		}
+		// commands are not polled while blinking
+		if times < 1 || times > config.MAX_BLINKING_LED_TIMES {
+			return "", fmt.Errorf("number of blinks must be from 1 to %d", config.MAX_BLINKING_LED_TIMES)
+		}
+		enrolledMutex.Lock()
+		defer enrolledMutex.Unlock()
+		for j := 0; j < times; j++ {
+			ledSuccessEnroll.SetOff()
+			time.Sleep(config.DELAY_FOR_BLINKING_LED_MILLISECONDS * time.Millisecond)
+			ledSuccessEnroll.SetOn()
+			time.Sleep(config.DELAY_FOR_BLINKING_LED_MILLISECONDS * time.Millisecond)
+		}
+		if !enrolled {
+			ledSuccessEnroll.SetOff()
+		}
+		return fmt.Sprintf("blinked %d times", times), nil
+	})
+	commands.Register(commandwrapper.COMMAND_SWITCH_SENSOR_OFF, func(parameters []string) (string, error) {
+		if len(parameters) != 1 {
+			return "", fmt.Errorf("sensor is not specified")
+		}
+		twin.SetEnabled(parameters[0], false)
+		return fmt.Sprintf("%s switched off", parameters[0]), nil
+	})
+	commands.Register(commandwrapper.COMMAND_SWITCH_SENSOR_ON, func(parameters []string) (string, error) {
+		if len(parameters) != 1 {
+			return "", fmt.Errorf("sensor is not specified")
+		}
+		twin.SetEnabled(parameters[0], true)
+		return fmt.Sprintf("%s switched on", parameters[0]), nil
+	})
+	go func() {
+		for {
+			queueElements, err := commands.Poll(fabricCa.DeviceID())
+			if err != nil {
+				fmt.Println("Error: ", err.Error())
+			}
+			for _, queueElement := range queueElements {
+				queue.AddToQueue(queueElement)
+			}
+			time.Sleep(config.DELAY_FOR_POLLING_COMMANDS_SECONDS * time.Second)
+		}
+	}()
+
 	// Gathering data in cycle
 	i := 0
 	for {
 		fmt.Printf("**************** UPDATES %d ****************\n", i)
 
-		if sensorsActivityGrid.GpsSensor {
-			queue.AddToQueue(gpsSensor.GetQueueElement())
+		// readings of a cycle are sent in one transaction
+		activeSensors := twin.Apply(sensorsActivityGrid)
+		readings := []*queuewrapper.QueueStructure{}
+		if activeSensors.GpsSensor {
+			readings = append(readings, gpsSensor.GetQueueElement())
 		}
-		if sensorsActivityGrid.HumiditySensor {
-			queue.AddToQueue(humiditySensor.GetQueueElement())
+		if activeSensors.HumiditySensor {
+			readings = append(readings, humiditySensor.GetQueueElement())
 		}
-		if sensorsActivityGrid.BarometerSensor {
-			queue.AddToQueue(barometerSensor.GetQueueElement())
+		if activeSensors.BarometerSensor {
+			readings = append(readings, barometerSensor.GetQueueElement())
 		}
-		if sensorsActivityGrid.GyroscopeSensor {
-			queue.AddToQueue(gyroscopeSensor.GetQueueElement())
+		if activeSensors.GyroscopeSensor {
+			readings = append(readings, gyroscopeSensor.GetQueueElement())
+		}
+		if len(readings) != 0 {
+			queue.AddToQueue(queuewrapper.Batch(readings...))
+		} else {
+			queue.AddToQueue(heartbeatwrapper.GetQueueElement())
 		}
 
 		i++
-		time.Sleep(config.DELAY_FOR_GATHERING_DATA_IN_CYCLE_SECONDS * time.Second)
+		time.Sleep(twin.GatheringInterval())
 		if sensorsActivityGrid.LedBad {
 			ledBadSensorData.SetOff()
 		}
@@ -215,7 +357,37 @@ func execute() {
 	fmt.Println("**************** END ****************")
 }
 
+// Prints a sample of a samples file with its proof, as taken by verifyIotSample
+func printProof(fileName, indexString string) {
+	index, err := strconv.Atoi(indexString)
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		os.Exit(1)
+	}
+
+	sample, proof, err := anchorwrapper.GetProof(fileName, index)
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		os.Exit(1)
+	}
+
+	proofBytes, err := json.Marshal(proof)
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		os.Exit(1)
+	}
+
+	fmt.Println(sample)
+	fmt.Println(string(proofBytes))
+}
+
 func main() {
+	// proof <samples file> <index>
+	if len(os.Args) == 4 && os.Args[1] == "proof" {
+		printProof(os.Args[2], os.Args[3])
+		return
+	}
+
 	defer func() {
 		fmt.Println("Main defer")
 		if r := recover(); r != nil {